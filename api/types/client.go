@@ -11,39 +11,100 @@ type SiteConfig struct {
 }
 
 type SiteConfigSpec struct {
-	SkupperName         string
-	SkupperNamespace    string
-	IsEdge              bool
-	EnableController    bool
-	EnableServiceSync   bool
-	EnableRouterConsole bool
-	EnableConsole       bool
-	AuthMode            string
-	User                string
-	Password            string
-	MapToHost           bool
-	Replicas            int32
-	TraceLog            bool
+	SkupperName         string `json:"skupperName,omitempty"`
+	SkupperNamespace    string `json:"skupperNamespace,omitempty"`
+	IsEdge              bool   `json:"isEdge,omitempty"`
+	EnableController    bool   `json:"enableController,omitempty"`
+	EnableServiceSync   bool   `json:"enableServiceSync,omitempty"`
+	EnableRouterConsole bool   `json:"enableRouterConsole,omitempty"`
+	EnableConsole       bool   `json:"enableConsole,omitempty"`
+	AuthMode            string `json:"authMode,omitempty"`
+	User                string `json:"user,omitempty"`
+	Password            string `json:"password,omitempty"`
+	MapToHost           bool   `json:"mapToHost,omitempty"`
+	Replicas            int32  `json:"replicas,omitempty"`
+	TraceLog            bool   `json:"traceLog,omitempty"`
+	SharedBridge        bool   `json:"sharedBridge,omitempty"`
+	Storage             string `json:"storage,omitempty"`
 }
 
 type ServiceInterfaceCreateOptions struct {
-	Protocol   string
-	Address    string
-	Port       int
-	TargetPort int
-	Headless   bool
+	Protocol    string
+	Address     string
+	Ports       []int
+	TargetPorts []int
+	Headless    bool
 }
 
+// RouterInspectResponse is the result of inspecting a site, it is also the
+// schema of 'skupper-docker status --output json|yaml'
 type RouterInspectResponse struct {
-	Status            RouterStatusSpec
-	TransportVersion  string
-	ControllerVersion string
-	ExposedServices   int
+	Status            RouterStatusSpec `json:"status"`
+	TransportVersion  string           `json:"transportVersion"`
+	ControllerVersion string           `json:"controllerVersion"`
+	ExposedServices   int              `json:"exposedServices"`
+	ConsoleUrl        string           `json:"consoleUrl,omitempty"`
 }
 
+// ConnectorInspectResponse is the result of inspecting a connection, a list of
+// them is the schema of 'skupper-docker check-connection --output json|yaml'
 type ConnectorInspectResponse struct {
-	Connector *Connector
-	Connected bool
+	Connector *Connector `json:"connector"`
+	Connected bool       `json:"connected"`
+}
+
+// VersionInspectResponse is the schema of 'skupper-docker version --output json|yaml'
+type VersionInspectResponse struct {
+	ClientVersion     string `json:"clientVersion"`
+	TransportVersion  string `json:"transportVersion"`
+	ControllerVersion string `json:"controllerVersion"`
+	Error             string `json:"error,omitempty"`
+}
+
+// SiteManifest declares the desired state of a site for 'skupper-docker apply'
+type SiteManifest struct {
+	Site        *SiteConfigSpec      `json:"site,omitempty"`
+	Services    []ServiceInterface   `json:"services,omitempty"`
+	Connections []ConnectionManifest `json:"connections,omitempty"`
+}
+
+// ConnectionManifest declares an outgoing connection made with a connection token
+type ConnectionManifest struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Cost  int32  `json:"cost,omitempty"`
+}
+
+type SiteManifestApplyOptions struct {
+	Prune  bool
+	DryRun bool
+}
+
+// SiteManifestChange describes one change planned or made by 'skupper-docker apply'
+type SiteManifestChange struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+	Detail  string `json:"detail,omitempty"`
+	Applied bool   `json:"applied,omitempty"`
+}
+
+// ComposeFile holds the parts of a docker-compose file read by 'skupper-docker compose'
+type ComposeFile struct {
+	Name     string                    `json:"name,omitempty"`
+	Services map[string]ComposeService `json:"services"`
+}
+
+type ComposeService struct {
+	Skupper *ComposeServiceExtension `json:"x-skupper,omitempty"`
+}
+
+// ComposeServiceExtension is the x-skupper block of a compose service, it
+// exposes the containers of the service through a Skupper address
+type ComposeServiceExtension struct {
+	Address  string `json:"address,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
 }
 
 type RouterStatusSpec struct {
@@ -53,20 +114,110 @@ type RouterStatusSpec struct {
 	BindingsCount  int                     `json:"bindingsCount,omitempty"`
 }
 
+type RouterUpdateOptions struct {
+	RouterImage     string
+	ControllerImage string
+}
+
+// ComponentUpdate reports the version of a site component before and after
+// an update
+type ComponentUpdate struct {
+	Name          string `json:"name"`
+	Component     string `json:"component"`
+	BeforeVersion string `json:"beforeVersion"`
+	AfterVersion  string `json:"afterVersion"`
+	Updated       bool   `json:"updated"`
+}
+
+// CertRotationOptions controls how the internal CA is replaced. With KeepOldCA
+// the previous CA stays trusted until a later rotation with Finish.
+type CertRotationOptions struct {
+	KeepOldCA bool
+	Finish    bool
+}
+
+// IssuedToken records a connection token generated by this site
+type IssuedToken struct {
+	File     string `json:"file"`
+	Subject  string `json:"subject"`
+	Issued   string `json:"issued"`
+	IssuerCA string `json:"issuerCa"`
+}
+
+type CertRotationResult struct {
+	RotatedCAs        []string      `json:"rotatedCAs"`
+	Credentials       []string      `json:"credentials"`
+	Restarted         []string      `json:"restarted"`
+	InvalidatedTokens []IssuedToken `json:"invalidatedTokens"`
+	TrustedTokens     []IssuedToken `json:"trustedTokens"`
+	OldCATrusted      bool          `json:"oldCaTrusted"`
+	// UntrackedTokens is set when the site issued tokens before it recorded
+	// them, these are affected by the rotation without being listed
+	UntrackedTokens bool `json:"untrackedTokens,omitempty"`
+}
+
+// ServiceInterfaceStats is the traffic seen by the site for a service, a list
+// of them is the schema of 'skupper-docker stats --output json|yaml'
+type ServiceInterfaceStats struct {
+	Address           string `json:"address"`
+	Protocol          string `json:"protocol"`
+	ActiveConnections int    `json:"activeConnections"`
+	TotalConnections  int    `json:"totalConnections"`
+	BytesIn           int64  `json:"bytesIn"`
+	BytesOut          int64  `json:"bytesOut"`
+	Requests          int64  `json:"requests"`
+	Links             int    `json:"links"`
+}
+
+// NetworkRouterStatus describes a router of the network as seen from this site
+type NetworkRouterStatus struct {
+	Id        string   `json:"id"`
+	SiteId    string   `json:"siteId"`
+	SiteName  string   `json:"siteName,omitempty"`
+	NextHop   string   `json:"nextHop,omitempty"`
+	Cost      int      `json:"cost"`
+	Local     bool     `json:"local,omitempty"`
+	LinkState []string `json:"linkState,omitempty"`
+}
+
+// NetworkSiteStatus lists the routers of a site and the services it provides
+type NetworkSiteStatus struct {
+	SiteId   string   `json:"siteId"`
+	SiteName string   `json:"siteName,omitempty"`
+	Routers  []string `json:"routers"`
+	Services []string `json:"services"`
+}
+
+// NetworkStatusResponse is the schema of 'skupper-docker network status --output json|yaml'
+type NetworkStatusResponse struct {
+	Routers []NetworkRouterStatus `json:"routers"`
+	Sites   []NetworkSiteStatus   `json:"sites"`
+}
+
 type VanClientInterface interface {
 	ConnectorCreate(secretFile string, options ConnectorCreateOptions) (string, error)
 	ConnectorInspect(name string) (*ConnectorInspectResponse, error)
 	ConnectorList() ([]*Connector, error)
 	ConnectorRemove(name string) error
 	ConnectorTokenCreate(subject string, secretFile string) error
+	ConsoleUserAdd(user string, password string) (string, error)
+	ConsoleUserList() ([]string, error)
+	ConsoleUserRemove(user string) error
+	ConsoleUserSetPassword(user string, password string) (string, error)
+	NetworkStatus() (*NetworkStatusResponse, error)
 	RouterCreate(options SiteConfigSpec) error
 	RouterInspect() (*RouterInspectResponse, error)
 	RouterRemove() []error
-	ServiceInterfaceBind(service *ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error
+	RouterRotateCerts(options CertRotationOptions) (*CertRotationResult, error)
+	RouterUpdate(options RouterUpdateOptions) ([]ComponentUpdate, error)
+	ServiceInterfaceBind(service *ServiceInterface, targetType string, targetName string, protocol string, targetPorts []int) error
 	ServiceInterfaceCreate(service *ServiceInterface) error
 	ServiceInterfaceInspect(address string) (*ServiceInterface, error)
 	ServiceInterfaceList() ([]ServiceInterface, error)
 	ServiceInterfaceRemove(address string) error
+	ServiceInterfaceStats() ([]ServiceInterfaceStats, error)
 	ServiceInterfaceUnbind(targetType string, targetName string, address string, deleteIfNoTargets bool) error
 	SiteConfigInspect(name string) (*SiteConfig, error)
+	SiteManifestApply(manifest *SiteManifest, options SiteManifestApplyOptions) ([]SiteManifestChange, error)
+	SkupperDump(tarName string, version string) (string, error)
 }
@@ -15,8 +15,12 @@ limitations under the License.
 package types
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/docker/go-connections/nat"
 )
@@ -24,6 +28,9 @@ import (
 const (
 	DefaultVanName    string = "skupper"
 	DefaultBridgeName string = "skupper0"
+	IssuedTokensFile  string = "issued-tokens.json"
+	// UntrackedTokensFile marks a site that issued tokens before it recorded them
+	UntrackedTokensFile string = "issued-tokens-untracked"
 )
 
 type Path int
@@ -51,7 +58,85 @@ var skupperPaths = map[Path]string{
 }
 
 func GetSkupperPath(p Path) string {
-	return filepath.Join(os.Getenv("SKUPPER_TMPDIR"), "skupper", skupperPaths[p])
+	return filepath.Join(os.Getenv("SKUPPER_TMPDIR"), GetSiteScopedName("skupper"), skupperPaths[p])
+}
+
+// GetSiteName returns the site selected with SKUPPER_SITE, several sites can
+// share a daemon as long as they have different names. The default site has
+// no name.
+func GetSiteName() string {
+	return os.Getenv("SKUPPER_SITE")
+}
+
+// GetSiteScopedName prefixes the name of a container, network, volume or
+// state directory with the name of the site it belongs to, the default site
+// keeps the bare names
+func GetSiteScopedName(name string) string {
+	if site := GetSiteName(); site != "" {
+		return site + "-" + name
+	}
+	return name
+}
+
+// GetSiteLocalName is the reverse of GetSiteScopedName
+func GetSiteLocalName(name string) string {
+	if site := GetSiteName(); site != "" {
+		return strings.TrimPrefix(name, site+"-")
+	}
+	return name
+}
+
+// GetTransportDeploymentName returns the name of the router container of the site
+func GetTransportDeploymentName() string {
+	return GetSiteScopedName(TransportDeploymentName)
+}
+
+// GetTransportNetworkName returns the name of the network of the site
+func GetTransportNetworkName() string {
+	return GetSiteScopedName(TransportNetworkName)
+}
+
+// GetControllerDeploymentName returns the name of the controller container of the site
+func GetControllerDeploymentName() string {
+	return GetSiteScopedName(ControllerDeploymentName)
+}
+
+// GetBridgeDeploymentName returns the name of the shared bridge container of the site
+func GetBridgeDeploymentName() string {
+	return GetSiteScopedName(BridgeDeploymentName)
+}
+
+// StatePaths are the areas of the site state shared with its containers
+var StatePaths = []Path{CertsPath, ConnectionsPath, ConfigPath, ConsoleUsersPath, SaslConfigPath, ServicesPath, SitesPath}
+
+// Storage modes of the site state
+const (
+	// StorageHost bind-mounts the directories under SKUPPER_TMPDIR
+	StorageHost string = "host"
+	// StorageVolume keeps each area in a named volume on the daemon, the
+	// directories under SKUPPER_TMPDIR being a working copy for the client
+	StorageVolume string = "volume"
+)
+
+func GetSkupperStorage() string {
+	if os.Getenv("SKUPPER_STORAGE") == StorageVolume {
+		return StorageVolume
+	}
+	return StorageHost
+}
+
+// GetSkupperVolume returns the name of the volume holding an area of the site state
+func GetSkupperVolume(p Path) string {
+	return GetSiteScopedName("skupper-" + skupperPaths[p])
+}
+
+// GetSkupperMountSource returns what to mount for an area of the site state,
+// a host directory or a volume name depending on the storage mode
+func GetSkupperMountSource(p Path) string {
+	if GetSkupperStorage() == StorageVolume {
+		return GetSkupperVolume(p)
+	}
+	return GetSkupperPath(p)
 }
 
 // TransportMode describes how a qdr is intended to be deployed, either interior or edge
@@ -90,13 +175,30 @@ const (
 	DefaultControllerImage   string = "quay.io/skupper/skupper-docker-controller"
 	ControllerContainerName  string = "service-controller"
 	ControllerConfigPath     string = "/etc/messaging/"
+	ControllerMetricsPort    int32  = 9091
+)
+
+// Shared bridge router constants
+const (
+	BridgeDeploymentName string = "skupper-bridge"
+	BridgeConfigFile     string = "skupper-bridge.json"
 )
 
 // Skupper qualifiers
 const (
-	BaseQualifier    string = "skupper.io"
-	TokenGeneratedBy string = BaseQualifier + "/generated-by"
-	TokenCost        string = BaseQualifier + "/cost"
+	BaseQualifier     string = "skupper.io"
+	TokenGeneratedBy  string = BaseQualifier + "/generated-by"
+	TokenCost         string = BaseQualifier + "/cost"
+	AddressQualifier  string = BaseQualifier + "/address"
+	PortQualifier     string = BaseQualifier + "/port"
+	ProtocolQualifier string = BaseQualifier + "/protocol"
+	SiteQualifier     string = BaseQualifier + "/site"
+)
+
+// Labels set by docker compose on the containers of a project
+const (
+	ComposeProjectLabel string = "com.docker.compose.project"
+	ComposeServiceLabel string = "com.docker.compose.service"
 )
 
 // Console constants
@@ -109,6 +211,7 @@ const (
 	ConsoleOpenShiftOauthServicePort       int32  = 443
 	ConsoleOpenShiftOuathServiceTargetPort int32  = 8443
 	ConsoleOpenShiftServingCerts           string = "skupper-proxy-certs"
+	ConsoleUsersMountPath                  string = "/etc/skupper-console-users"
 )
 
 type ConsoleAuthMode string
@@ -134,8 +237,17 @@ const (
 // Controller Service Interface constants
 const (
 	ServiceSyncAddress = "mc/$skupper-service-sync"
+	// services exposed through container labels, named after the kubernetes
+	// annotations skupper sites use for the same purpose
+	ServiceLabelOrigin = "annotation"
 )
 
+// IsLocalOrigin reports whether a service with the given origin is provided
+// by this site rather than synced from another one
+func IsLocalOrigin(origin string) bool {
+	return origin == "" || origin == ServiceLabelOrigin
+}
+
 // TODO: what is possiblity of using types from skupper itself (e.g. no namespace for docker
 // or we change the name to endpoint, etc.
 // RouterSpec is the specification of VAN network with router, controller and assembly
@@ -157,8 +269,10 @@ type DeploymentSpec struct {
 	Labels       map[string]string `json:"labels,omitempty"`
 	EnvVar       []string          `json:"envVar,omitempty"`
 	Ports        nat.PortSet       `json:"ports,omitempty"`
-	Volumes      []string          `json:"volumes,omitempty"`
-	Mounts       map[string]string `json:"mounts,omitempty"`
+	// the host address the ports are published on, all of them when empty
+	HostIP  string            `json:"hostIP,omitempty"`
+	Volumes []string          `json:"volumes,omitempty"`
+	Mounts  map[string]string `json:"mounts,omitempty"`
 }
 
 type ConnectorRole string
@@ -200,16 +314,19 @@ type User struct {
 }
 
 type TransportConnectedSites struct {
-	Direct   int
-	Indirect int
-	Total    int
-	Warnings []string
+	Direct   int      `json:"direct"`
+	Indirect int      `json:"indirect"`
+	Total    int      `json:"total"`
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 type ServiceInterface struct {
-	Address      string                   `json:"address"`
-	Protocol     string                   `json:"protocol"`
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+	// Port is the first port of the service, Ports lists them all when there
+	// are several so that sites unaware of Ports still see the first one
 	Port         int                      `json:"port"`
+	Ports        []int                    `json:"ports,omitempty"`
 	EventChannel bool                     `json:"eventchannel,omitempty"`
 	Aggregate    string                   `json:"aggregate,omitempty"`
 	Headless     *Headless                `json:"headless,omitempty"`
@@ -218,11 +335,126 @@ type ServiceInterface struct {
 	Alias        string                   `json:"alias,omitempty"`
 }
 
+// the prefix of the selectors for targets named directly, any other
+// selector is a docker label selector such as app=web
+const InternalSelectorPrefix = "internal.skupper.io/"
+
+// IsLabelSelector reports whether a target selects its containers by label
+func IsLabelSelector(selector string) bool {
+	return selector != "" && !strings.HasPrefix(selector, InternalSelectorPrefix)
+}
+
+// ParsePortLabel reads the value of a skupper.io/port label, several ports
+// can be given as a comma separated list
+func ParsePortLabel(value string) ([]int, bool) {
+	ports := []int{}
+	for _, part := range strings.Split(value, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, false
+		}
+		ports = append(ports, port)
+	}
+	return ports, true
+}
+
+// GetPorts returns every port of the service
+func (si *ServiceInterface) GetPorts() []int {
+	if len(si.Ports) > 0 {
+		return si.Ports
+	}
+	if si.Port != 0 {
+		return []int{si.Port}
+	}
+	return nil
+}
+
+// SetPorts sets the ports of the service, Ports is only kept when there are
+// several of them
+func (si *ServiceInterface) SetPorts(ports []int) {
+	si.Port = 0
+	si.Ports = nil
+	if len(ports) > 0 {
+		si.Port = ports[0]
+	}
+	if len(ports) > 1 {
+		si.Ports = append([]int{}, ports...)
+	}
+}
+
+// GetTargetPort returns the port of the target that a port of the service
+// is mapped to, TargetPort maps the first port of the service
+func (si *ServiceInterface) GetTargetPort(target ServiceInterfaceTarget, port int) int {
+	if targetPort, ok := target.TargetPorts[port]; ok && targetPort != 0 {
+		return targetPort
+	}
+	if port == si.Port && target.TargetPort != 0 {
+		return target.TargetPort
+	}
+	return port
+}
+
+// AssignInstances numbers the container targets of a headless service. A
+// target keeps its instance once it has one and new targets take the lowest
+// free ones in name order, so the address of an instance does not move to
+// another container. The size of the service covers every instance up to the
+// highest in use.
+func (si *ServiceInterface) AssignInstances() {
+	if si.Headless == nil {
+		return
+	}
+	used := map[int]bool{}
+	pending := []int{}
+	for i, t := range si.Targets {
+		if t.Selector != "internal.skupper.io/container" {
+			continue
+		}
+		if t.Instance != nil {
+			used[*t.Instance] = true
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return si.Targets[pending[i]].Name < si.Targets[pending[j]].Name
+	})
+	next := 0
+	for _, i := range pending {
+		for used[next] {
+			next++
+		}
+		instance := next
+		si.Targets[i].Instance = &instance
+		used[instance] = true
+	}
+	size := 0
+	for instance := range used {
+		if instance+1 > size {
+			size = instance + 1
+		}
+	}
+	si.Headless.Size = size
+}
+
+// GetInstanceAddress returns the address of one instance of a headless
+// service, the address is that of a port for services with several
+func (si *ServiceInterface) GetInstanceAddress(instance int, address string) string {
+	name := si.Address
+	if si.Headless != nil && si.Headless.Name != "" {
+		name = si.Headless.Name
+	}
+	return fmt.Sprintf("%s-%d.%s", name, instance, address)
+}
+
 type ServiceInterfaceTarget struct {
-	Name       string `json:"name,omitempty"`
-	Selector   string `json:"selector"`
-	TargetPort int    `json:"targetPort,omitempty"`
-	Service    string `json:"service,omitempty"`
+	Name        string      `json:"name,omitempty"`
+	Selector    string      `json:"selector"`
+	TargetPort  int         `json:"targetPort,omitempty"`
+	TargetPorts map[int]int `json:"targetPorts,omitempty"`
+	Service     string      `json:"service,omitempty"`
+	// Instance is the ordinal of the instance of a headless service the
+	// container stands for
+	Instance *int `json:"instance,omitempty"`
 }
 
 type Headless struct {
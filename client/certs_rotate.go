@@ -0,0 +1,326 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+
+	"github.com/skupperproject/skupper/pkg/certs"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/utils"
+)
+
+// the internal CA signs connection tokens, the previous one is kept while
+// remote sites move over to tokens from the new one
+const (
+	internalCA       = "skupper-internal-ca"
+	previousCASuffix = "-previous"
+)
+
+func getIssuedTokensPath() string {
+	return types.GetSkupperPath(types.SitesPath) + "/" + types.IssuedTokensFile
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("Failed to decode PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func getCASubject(caData certs.CertificateData) (string, error) {
+	cert, err := parseCertificate(caData["tls.crt"])
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse CA certificate: %w", err)
+	}
+	return cert.Subject.CommonName, nil
+}
+
+func getUntrackedTokensPath() string {
+	return types.GetSkupperPath(types.SitesPath) + "/" + types.UntrackedTokensFile
+}
+
+// getIssuedTokens returns the connection tokens recorded by the site and
+// whether it may have issued others. A site without a record predates the
+// recording of tokens, this is remembered until a certificate rotation has
+// invalidated every token it issued.
+func getIssuedTokens() ([]types.IssuedToken, bool, error) {
+	tokens := []types.IssuedToken{}
+	data, err := ioutil.ReadFile(getIssuedTokensPath())
+	if os.IsNotExist(err) {
+		if err := ioutil.WriteFile(getUntrackedTokensPath(), []byte{}, 0755); err != nil {
+			return nil, false, fmt.Errorf("Failed to record untracked tokens: %w", err)
+		}
+		return tokens, true, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("Failed to read issued tokens: %w", err)
+	}
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to decode issued tokens: %w", err)
+	}
+	_, err = os.Stat(getUntrackedTokensPath())
+	return tokens, err == nil, nil
+}
+
+func putIssuedTokens(tokens []types.IssuedToken) error {
+	encoded, err := json.MarshalIndent(tokens, "", "    ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode issued tokens: %w", err)
+	}
+	err = ioutil.WriteFile(getIssuedTokensPath(), encoded, 0755)
+	if err != nil {
+		return fmt.Errorf("Failed to write issued tokens: %w", err)
+	}
+	return nil
+}
+
+func putCertData(name string, certData certs.CertificateData) error {
+	certPath := types.GetSkupperPath(types.CertsPath) + "/" + name
+	if err := os.MkdirAll(certPath, 0755); err != nil {
+		return fmt.Errorf("Failed to create certificate directory: %w", err)
+	}
+	for k, v := range certData {
+		if err := ioutil.WriteFile(certPath+"/"+k, v, 0755); err != nil {
+			return fmt.Errorf("Failed to write certificate file: %w", err)
+		}
+	}
+	return nil
+}
+
+// crossSignCA issues the new CA certificate again, signed by the old CA, so
+// that peers which only trust the old CA can still verify chains ending in
+// the new one
+func crossSignCA(newCA certs.CertificateData, oldCA certs.CertificateData) ([]byte, error) {
+	newCert, err := parseCertificate(newCA["tls.crt"])
+	if err != nil {
+		return nil, err
+	}
+	oldCert, err := parseCertificate(oldCA["tls.crt"])
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(oldCA["tls.key"])
+	if block == nil {
+		return nil, fmt.Errorf("Failed to decode PEM key for %s", oldCert.Subject.CommonName)
+	}
+	oldKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               newCert.Subject,
+		SubjectKeyId:          newCert.SubjectKeyId,
+		NotBefore:             newCert.NotBefore,
+		NotAfter:              oldCert.NotAfter,
+		KeyUsage:              newCert.KeyUsage,
+		ExtKeyUsage:           newCert.ExtKeyUsage,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, oldCert, newCert.PublicKey, oldKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), nil
+}
+
+// trustPreviousCA extends a credential issued by the new internal CA so that
+// it accepts peers holding certificates from the previous CA, and presents a
+// chain those peers can verify
+func trustPreviousCA(name string, newCA certs.CertificateData, previousCA certs.CertificateData) error {
+	certData, err := getCertData(name)
+	if err != nil {
+		return err
+	}
+	crossSigned, err := crossSignCA(newCA, previousCA)
+	if err != nil {
+		return fmt.Errorf("Failed to cross sign CA: %w", err)
+	}
+	certData["tls.crt"] = append(certData["tls.crt"], crossSigned...)
+	certData["ca.crt"] = append(certData["ca.crt"], previousCA["tls.crt"]...)
+	return putCertData(name, certData)
+}
+
+// RouterRotateCerts replaces the site certificate authorities and the
+// credentials derived from them, then restarts the containers using them
+func (cli *VanClient) RouterRotateCerts(options types.CertRotationOptions) (*types.CertRotationResult, error) {
+	if options.KeepOldCA && options.Finish {
+		return nil, fmt.Errorf("Keeping the old CA and finishing a rotation are mutually exclusive")
+	}
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+	}
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve site config data: %w", err)
+	}
+	van, err := cli.GetRouterSpecFromOpts(sc.Spec, sc.UID)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Spec.IsEdge && (options.KeepOldCA || options.Finish) {
+		return nil, fmt.Errorf("Edge sites do not issue connection tokens, there is no old CA to keep trusting")
+	}
+
+	result := &types.CertRotationResult{
+		RotatedCAs:        []string{},
+		Credentials:       []string{},
+		Restarted:         []string{},
+		InvalidatedTokens: []types.IssuedToken{},
+		TrustedTokens:     []types.IssuedToken{},
+	}
+
+	previousPath := types.GetSkupperPath(types.CertsPath) + "/" + internalCA + previousCASuffix
+	previousCA, err := getCertData(internalCA + previousCASuffix)
+	if err != nil {
+		previousCA = nil
+	}
+	currentCA, err := getCertData(internalCA)
+	if err != nil && !sc.Spec.IsEdge {
+		return nil, fmt.Errorf("Unable to retrieve CA data: %w", err)
+	}
+
+	if options.Finish {
+		if previousCA == nil {
+			return nil, fmt.Errorf("No certificate rotation is in progress")
+		}
+	} else {
+		// a unique subject per generation keeps the old and new CA apart when
+		// peers build a chain
+		suffix := utils.RandomId(8)
+		for _, ca := range van.CertAuthoritys {
+			caData := certs.GenerateCACertificateData(ca.Name, ca.Name+"-"+suffix)
+			if err := putCertData(ca.Name, caData); err != nil {
+				return nil, err
+			}
+			result.RotatedCAs = append(result.RotatedCAs, ca.Name)
+		}
+	}
+
+	if options.KeepOldCA {
+		if err := os.RemoveAll(previousPath); err != nil {
+			return nil, fmt.Errorf("Failed to remove previous CA: %w", err)
+		}
+		if err := putCertData(internalCA+previousCASuffix, currentCA); err != nil {
+			return nil, err
+		}
+		previousCA = currentCA
+	} else {
+		if err := os.RemoveAll(previousPath); err != nil {
+			return nil, fmt.Errorf("Failed to remove previous CA: %w", err)
+		}
+		previousCA = nil
+	}
+
+	for _, cred := range van.Credentials {
+		if options.Finish && cred.CA != internalCA {
+			continue
+		}
+		if err := generateCredentials(cred.CA, cred.Name, cred.Subject, cred.Hosts, cred.ConnectJson); err != nil {
+			return nil, err
+		}
+		if cred.CA == internalCA && previousCA != nil {
+			newCA, err := getCertData(internalCA)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to retrieve CA data: %w", err)
+			}
+			if err := trustPreviousCA(cred.Name, newCA, previousCA); err != nil {
+				return nil, err
+			}
+		}
+		result.Credentials = append(result.Credentials, cred.Name)
+	}
+	result.OldCATrusted = previousCA != nil
+
+	// sort out which of the tokens this site handed out still work
+	if !sc.Spec.IsEdge {
+		tokens, untracked, err := getIssuedTokens()
+		if err != nil {
+			return nil, err
+		}
+		result.UntrackedTokens = untracked
+		trusted := map[string]bool{}
+		if newCA, err := getCertData(internalCA); err == nil {
+			subject, _ := getCASubject(newCA)
+			trusted[subject] = true
+		}
+		if previousCA != nil {
+			subject, _ := getCASubject(previousCA)
+			trusted[subject] = true
+		}
+		for _, token := range tokens {
+			if trusted[token.IssuerCA] {
+				result.TrustedTokens = append(result.TrustedTokens, token)
+			} else {
+				result.InvalidatedTokens = append(result.InvalidatedTokens, token)
+			}
+		}
+		if err := putIssuedTokens(result.TrustedTokens); err != nil {
+			return nil, err
+		}
+		// once no CA from before the record is trusted, the record is complete
+		if untracked && previousCA == nil {
+			if err := os.Remove(getUntrackedTokensPath()); err != nil {
+				return nil, fmt.Errorf("Failed to update untracked tokens: %w", err)
+			}
+		}
+	}
+
+	err = cli.saveState(types.CertsPath, types.SitesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// pick up the new certificates
+	err = docker.RestartTransportContainer(cli.DockerInterface)
+	if err != nil {
+		return result, fmt.Errorf("Failed to re-start transport container: %w", err)
+	}
+	result.Restarted = append(result.Restarted, types.GetTransportDeploymentName())
+	if len(result.RotatedCAs) > 0 {
+		err = docker.RestartContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
+		if err != nil {
+			return result, fmt.Errorf("Failed to re-start controller container: %w", err)
+		}
+		result.Restarted = append(result.Restarted, types.GetControllerDeploymentName())
+	}
+	filters := dockerfilters.NewArgs()
+	filters.Add("label", "skupper.io/component=proxy")
+	proxies, err := docker.ListSiteContainers(dockertypes.ContainerListOptions{
+		Filters: filters,
+		All:     true,
+	}, cli.DockerInterface)
+	if err != nil {
+		return result, fmt.Errorf("Failed to list proxy containers: %w", err)
+	}
+	for _, proxy := range proxies {
+		name := strings.TrimPrefix(proxy.Names[0], "/")
+		err = docker.RestartContainer(name, cli.DockerInterface)
+		if err != nil {
+			return result, fmt.Errorf("Failed to re-start proxy container %s: %w", name, err)
+		}
+		result.Restarted = append(result.Restarted, name)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper/pkg/certs"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+func certPool(t *testing.T, data []byte) *x509.CertPool {
+	pool := x509.NewCertPool()
+	assert.Assert(t, pool.AppendCertsFromPEM(data))
+	return pool
+}
+
+// verifyChain checks the first certificate in chain against the roots, using
+// the rest of the chain as intermediates
+func verifyChain(t *testing.T, chain []byte, roots []byte) error {
+	block, rest := pem.Decode(chain)
+	assert.Assert(t, block != nil)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	assert.Assert(t, err)
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(rest)
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         certPool(t, roots),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+func TestRouterRotateCerts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "rotatecerts")
+	assert.Assert(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, _ := newFakeClient()
+
+	_, err = cli.RouterRotateCerts(types.CertRotationOptions{})
+	assert.ErrorContains(t, err, "need init?")
+
+	err = cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"})
+	assert.Assert(t, err)
+
+	_, err = cli.RouterRotateCerts(types.CertRotationOptions{Finish: true})
+	assert.Error(t, err, "No certificate rotation is in progress")
+
+	oldToken := filepath.Join(tmpDir, "old.yaml")
+	assert.Assert(t, cli.ConnectorTokenCreate("remote-a", oldToken))
+	oldSecret, err := certs.GetSecretContent(oldToken)
+	assert.Assert(t, err)
+	oldAmqps, err := getCertData("skupper-amqps")
+	assert.Assert(t, err)
+
+	// transition: remote sites holding the old token keep working
+	result, err := cli.RouterRotateCerts(types.CertRotationOptions{KeepOldCA: true})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, result.RotatedCAs, []string{"skupper-ca", "skupper-internal-ca"})
+	assert.DeepEqual(t, result.Credentials, []string{"skupper-amqps", "skupper", "skupper-internal"})
+	assert.DeepEqual(t, result.Restarted, []string{types.TransportDeploymentName, types.ControllerDeploymentName})
+	assert.Assert(t, result.OldCATrusted)
+	assert.Equal(t, len(result.InvalidatedTokens), 0)
+	assert.Equal(t, len(result.TrustedTokens), 1)
+	assert.Equal(t, result.TrustedTokens[0].Subject, "remote-a")
+
+	amqps, err := getCertData("skupper-amqps")
+	assert.Assert(t, err)
+	assert.Assert(t, string(amqps["ca.crt"]) != string(oldAmqps["ca.crt"]))
+
+	internal, err := getCertData("skupper-internal")
+	assert.Assert(t, err)
+	assert.Check(t, verifyChain(t, internal["tls.crt"], oldSecret["ca.crt"]), "old token cannot verify router")
+	assert.Check(t, verifyChain(t, oldSecret["tls.crt"], internal["ca.crt"]), "router does not accept old token")
+
+	newToken := filepath.Join(tmpDir, "new.yaml")
+	assert.Assert(t, cli.ConnectorTokenCreate("remote-b", newToken))
+	newSecret, err := certs.GetSecretContent(newToken)
+	assert.Assert(t, err)
+	assert.Check(t, verifyChain(t, internal["tls.crt"], newSecret["ca.crt"]), "new token cannot verify router")
+
+	// finishing drops the old CA and the tokens it signed
+	result, err = cli.RouterRotateCerts(types.CertRotationOptions{Finish: true})
+	assert.Assert(t, err)
+	assert.Equal(t, len(result.RotatedCAs), 0)
+	assert.DeepEqual(t, result.Credentials, []string{"skupper-internal"})
+	assert.Assert(t, !result.OldCATrusted)
+	assert.Equal(t, len(result.InvalidatedTokens), 1)
+	assert.Equal(t, result.InvalidatedTokens[0].Subject, "remote-a")
+	assert.Equal(t, len(result.TrustedTokens), 1)
+	assert.Equal(t, result.TrustedTokens[0].Subject, "remote-b")
+
+	internal, err = getCertData("skupper-internal")
+	assert.Assert(t, err)
+	assert.Assert(t, verifyChain(t, oldSecret["tls.crt"], internal["ca.crt"]) != nil, "router still accepts old token")
+	assert.Check(t, verifyChain(t, newSecret["tls.crt"], internal["ca.crt"]))
+
+	// a plain rotation invalidates everything issued so far
+	result, err = cli.RouterRotateCerts(types.CertRotationOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, len(result.InvalidatedTokens), 1)
+	assert.Equal(t, result.InvalidatedTokens[0].Subject, "remote-b")
+	tokens, untracked, err := getIssuedTokens()
+	assert.Assert(t, err)
+	assert.Equal(t, len(tokens), 0)
+	assert.Assert(t, !untracked)
+	assert.Assert(t, !result.UntrackedTokens)
+
+	// a site without a record of its tokens may have issued any
+	assert.Assert(t, os.Remove(getIssuedTokensPath()))
+	result, err = cli.RouterRotateCerts(types.CertRotationOptions{KeepOldCA: true})
+	assert.Assert(t, err)
+	assert.Assert(t, result.UntrackedTokens)
+	assert.Assert(t, cli.ConnectorTokenCreate("remote-c", filepath.Join(tmpDir, "c.yaml")))
+	result, err = cli.RouterRotateCerts(types.CertRotationOptions{Finish: true})
+	assert.Assert(t, err)
+	assert.Assert(t, result.UntrackedTokens, "untracked tokens of the previous CA are dropped")
+	assert.Equal(t, len(result.TrustedTokens), 1)
+	result, err = cli.RouterRotateCerts(types.CertRotationOptions{})
+	assert.Assert(t, err)
+	assert.Assert(t, !result.UntrackedTokens)
+	assert.Equal(t, len(result.InvalidatedTokens), 1)
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"os"
 	"time"
 
 	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
@@ -12,9 +13,33 @@ type VanClient struct {
 }
 
 func NewClient() (*VanClient, error) {
+	return NewClientForRuntime(os.Getenv("SKUPPER_RUNTIME"))
+}
+
+// NewClientForRuntime creates a VAN client for the docker or podman runtime,
+// an empty runtime is detected from the available socket
+func NewClientForRuntime(runtime string) (*VanClient, error) {
+	return NewClientWithOptions(libdocker.ConnectOptions{Runtime: runtime})
+}
+
+// NewClientWithOptions creates a VAN client for the daemon selected by
+// options, which may be on another host
+func NewClientWithOptions(options libdocker.ConnectOptions) (*VanClient, error) {
+	return NewClientWithInterface(libdocker.ConnectOrDie(options, 0, 10*time.Second))
+}
+
+// NewClientWithInterface creates a VAN client on top of the provided docker backend
+func NewClientWithInterface(dd libdocker.Interface) (*VanClient, error) {
 	c := &VanClient{}
 
-	c.DockerInterface = libdocker.ConnectToDockerOrDie(0, 10*time.Second)
+	c.DockerInterface = dd
+
+	if err := useStateVolumes(dd); err != nil {
+		return nil, err
+	}
+	if err := c.loadState(); err != nil {
+		return nil, err
+	}
 
 	return c, nil
 }
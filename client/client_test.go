@@ -5,8 +5,24 @@ import (
 	"testing"
 
 	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker/fake"
 )
 
+// newFakeClient returns a VAN client backed by an in-memory docker whose router
+// answers every management query with an empty result set
+func newFakeClient() (*VanClient, *fake.DockerClient) {
+	dd := fake.NewDockerClient()
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		if len(cmd) > 0 && cmd[0] == "qdmanage" {
+			return fake.ExecResult{Stdout: "[]"}
+		}
+		return fake.ExecResult{}
+	}
+	cli, _ := NewClientWithInterface(dd)
+	return cli, dd
+}
+
 func TestNewClient(t *testing.T) {
 	testCases := []struct {
 		doc             string
@@ -25,6 +41,13 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestNewClientWithInterface(t *testing.T) {
+	dd := fake.NewDockerClient()
+	cli, err := NewClientWithInterface(dd)
+	assert.Check(t, err)
+	assert.Assert(t, cli.DockerInterface == dd)
+}
+
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
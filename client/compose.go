@@ -0,0 +1,108 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+// ComposeBinding is a compose service with an x-skupper block, the label
+// selector of its containers and the Skupper service they are exposed as
+type ComposeBinding struct {
+	Service  string
+	Selector string
+	Options  types.ServiceInterfaceCreateOptions
+}
+
+// ReadComposeFile reads the parts of a docker compose file skupper needs
+func ReadComposeFile(file string) (*types.ComposeFile, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read compose file: %w", err)
+	}
+	compose := &types.ComposeFile{}
+	// compose files carry many more fields than skupper needs
+	err = yaml.Unmarshal(data, compose)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse compose file %s: %w", file, err)
+	}
+	return compose, nil
+}
+
+// GetComposeProjectName follows docker compose: the given project name, then
+// COMPOSE_PROJECT_NAME, then the name in the file, then the directory of the
+// file. Like compose it keeps only lower case letters, digits, '_' and '-'.
+func GetComposeProjectName(file string, project string, compose *types.ComposeFile) (string, error) {
+	name := project
+	if name == "" {
+		name = os.Getenv("COMPOSE_PROJECT_NAME")
+	}
+	if name == "" {
+		name = compose.Name
+	}
+	if name == "" {
+		dir, err := filepath.Abs(filepath.Dir(file))
+		if err != nil {
+			return "", fmt.Errorf("Could not determine compose project name: %w", err)
+		}
+		name = filepath.Base(dir)
+	}
+	normalized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(name))
+	if normalized == "" {
+		return "", fmt.Errorf("Invalid compose project name %q", name)
+	}
+	return normalized, nil
+}
+
+func composeSelector(project string, service string) string {
+	return types.ComposeProjectLabel + "=" + project + "," + types.ComposeServiceLabel + "=" + service
+}
+
+// GetComposeBindings returns the services of the compose project that have
+// an x-skupper block in name order. The address defaults to the name of the
+// compose service and the protocol to tcp.
+func GetComposeBindings(compose *types.ComposeFile, project string) []ComposeBinding {
+	names := []string{}
+	for name, service := range compose.Services {
+		if service.Skupper != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	bindings := []ComposeBinding{}
+	for _, name := range names {
+		extension := compose.Services[name].Skupper
+		binding := ComposeBinding{
+			Service:  name,
+			Selector: composeSelector(project, name),
+			Options: types.ServiceInterfaceCreateOptions{
+				Address:  extension.Address,
+				Protocol: extension.Protocol,
+			},
+		}
+		if binding.Options.Address == "" {
+			binding.Options.Address = name
+		}
+		if binding.Options.Protocol == "" {
+			binding.Options.Protocol = "tcp"
+		}
+		if extension.Port != 0 {
+			binding.Options.Ports = []int{extension.Port}
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings
+}
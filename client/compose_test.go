@@ -0,0 +1,92 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+func TestComposeBindings(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "compose")
+	assert.Assert(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	projectDir := filepath.Join(tmpDir, "My.Shop")
+	assert.Assert(t, os.Mkdir(projectDir, 0755))
+	file := filepath.Join(projectDir, "docker-compose.yml")
+	assert.Assert(t, ioutil.WriteFile(file, []byte(`
+version: "3.8"
+services:
+  web:
+    image: nginx
+    ports:
+      - "8080:80"
+    x-skupper:
+      address: frontend
+      port: 80
+      protocol: http
+  db:
+    image: postgres
+    x-skupper:
+      port: 5432
+  cache:
+    image: redis
+volumes:
+  data: {}
+`), 0644))
+
+	compose, err := ReadComposeFile(file)
+	assert.Assert(t, err)
+
+	_, err = ReadComposeFile(filepath.Join(tmpDir, "missing.yml"))
+	assert.ErrorContains(t, err, "Could not read compose file")
+
+	os.Unsetenv("COMPOSE_PROJECT_NAME")
+	project, err := GetComposeProjectName(file, "", compose)
+	assert.Assert(t, err)
+	assert.Equal(t, project, "myshop", "the directory name is normalized")
+
+	compose.Name = "Shop_1"
+	project, err = GetComposeProjectName(file, "", compose)
+	assert.Assert(t, err)
+	assert.Equal(t, project, "shop_1")
+
+	os.Setenv("COMPOSE_PROJECT_NAME", "from-env")
+	defer os.Unsetenv("COMPOSE_PROJECT_NAME")
+	project, err = GetComposeProjectName(file, "", compose)
+	assert.Assert(t, err)
+	assert.Equal(t, project, "from-env")
+
+	project, err = GetComposeProjectName(file, "Shop", compose)
+	assert.Assert(t, err)
+	assert.Equal(t, project, "shop", "the option takes precedence")
+
+	_, err = GetComposeProjectName(file, "...", compose)
+	assert.Error(t, err, `Invalid compose project name "..."`)
+
+	assert.DeepEqual(t, GetComposeBindings(compose, "shop"), []ComposeBinding{
+		{
+			Service:  "db",
+			Selector: "com.docker.compose.project=shop,com.docker.compose.service=db",
+			Options: types.ServiceInterfaceCreateOptions{
+				Address:  "db",
+				Protocol: "tcp",
+				Ports:    []int{5432},
+			},
+		},
+		{
+			Service:  "web",
+			Selector: "com.docker.compose.project=shop,com.docker.compose.service=web",
+			Options: types.ServiceInterfaceCreateOptions{
+				Address:  "frontend",
+				Protocol: "http",
+				Ports:    []int{80},
+			},
+		},
+	})
+}
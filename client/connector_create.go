@@ -3,9 +3,14 @@ package client
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerfilters "github.com/docker/docker/api/types/filters"
 
 	"github.com/skupperproject/skupper-docker/api/types"
 	"github.com/skupperproject/skupper-docker/pkg/docker"
@@ -33,6 +38,62 @@ func generateConnectorName(path string) (string, error) {
 	return "conn" + strconv.Itoa(max), nil
 }
 
+// restartTransport re-creates the router from its config file, along with the
+// controller and proxies that are linked to it
+func (cli *VanClient) restartTransport() error {
+	err := docker.RestartTransportContainer(cli.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to re-start transport container: %w", err)
+	}
+
+	err = docker.RestartContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to re-start controller container: %w", err)
+	}
+
+	// restart proxies, including the shared bridge router
+	filters := dockerfilters.NewArgs()
+	filters.Add("label", "skupper.io/component=proxy")
+	proxies, err := docker.ListSiteContainers(dockertypes.ContainerListOptions{
+		Filters: filters,
+		All:     true,
+	}, cli.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to list proxies to restart: %w", err)
+	}
+	for _, proxy := range proxies {
+		err = docker.RestartContainer(strings.TrimPrefix(proxy.Names[0], "/"), cli.DockerInterface)
+		if err != nil {
+			return fmt.Errorf("Failed to restart proxy container: %w", err)
+		}
+	}
+	return nil
+}
+
+// joinSiteNetwork connects the router to the network of another site on the
+// same daemon, the address in its token is only reachable from there. Tokens
+// of sites on other hosts name networks that do not exist here.
+func joinSiteNetwork(network string, cli *VanClient) error {
+	if network == types.GetTransportNetworkName() {
+		return nil
+	}
+	sn, err := docker.InspectNetwork(network, cli.DockerInterface)
+	if err != nil {
+		return nil
+	}
+	router, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve transport container: %w", err)
+	}
+	if _, ok := sn.Containers[router.ID]; ok {
+		return nil
+	}
+	if err := docker.ConnectContainerToNetwork(network, types.GetTransportDeploymentName(), cli.DockerInterface); err != nil {
+		return fmt.Errorf("Failed to connect transport container to network %s: %w", network, err)
+	}
+	return nil
+}
+
 func (cli *VanClient) ConnectorCreate(secretFile string, options types.ConnectorCreateOptions) (string, error) {
 
 	// TODO certs should return err
@@ -41,7 +102,7 @@ func (cli *VanClient) ConnectorCreate(secretFile string, options types.Connector
 		return "", fmt.Errorf("Failed to make connector: %w", err)
 	}
 
-	_, err = docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err = docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return "", fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -68,6 +129,13 @@ func (cli *VanClient) ConnectorCreate(secretFile string, options types.Connector
 	}
 	connPath := types.GetSkupperPath(types.ConnectionsPath) + "/" + options.Name
 
+	if network, ok := secret["network"]; ok {
+		err = joinSiteNetwork(string(network), cli)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	if err := os.Mkdir(connPath, 0755); err != nil {
 		return "", fmt.Errorf("Failed to create skupper connector directory: %w", err)
 	}
@@ -115,27 +183,22 @@ func (cli *VanClient) ConnectorCreate(secretFile string, options types.Connector
 	if err != nil {
 		return "", fmt.Errorf("Failed to update router config file: %w", err)
 	}
-
-	err = docker.RestartTransportContainer(cli.DockerInterface)
+	err = cli.saveState(types.ConnectionsPath, types.ConfigPath)
 	if err != nil {
-		return "", fmt.Errorf("Failed to re-start transport container: %w", err)
+		return "", err
 	}
 
-	//	err = docker.RestartControllerContainer(cli.DockerInterface)
-	err = docker.RestartContainer(types.ControllerDeploymentName, cli.DockerInterface)
-	if err != nil {
-		return "", fmt.Errorf("Failed to re-start controller container: %w", err)
+	// the connection directory is mounted in the router, so the link can be
+	// added to the running router without disrupting service traffic
+	err = qdr.CreateSslProfile(current.SslProfiles[profileName], cli.DockerInterface)
+	if err == nil {
+		err = qdr.CreateConnector(connector, cli.DockerInterface)
 	}
-
-	// restart proxies
-	vsis, err := cli.ServiceInterfaceList()
 	if err != nil {
-		return "", fmt.Errorf("Failed to list proxies to restart: %w", err)
-	}
-	for _, vs := range vsis {
-		err = docker.RestartContainer(vs.Address, cli.DockerInterface)
+		log.Println("Failed to add connector to running router, restarting it:", err.Error())
+		err = cli.restartTransport()
 		if err != nil {
-			return "", fmt.Errorf("Failed to restart proxy container: %w", err)
+			return "", err
 		}
 	}
 
@@ -14,7 +14,7 @@ func (cli *VanClient) ConnectorInspect(name string) (*types.ConnectorInspectResp
 	var role types.ConnectorRole
 	var suffix string
 
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		// TODO: is not found versus error
 		return vci, fmt.Errorf("Unable to retrieve transport container (need init?): %w", err)
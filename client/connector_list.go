@@ -12,7 +12,7 @@ import (
 func (cli *VanClient) ConnectorList() ([]*types.Connector, error) {
 	var connectors []*types.Connector
 	// verify that the transport is interior mode
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return connectors, fmt.Errorf("Unable to retrieve transport container (need init?): %w", err)
 	}
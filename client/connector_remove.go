@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/skupperproject/skupper-docker/api/types"
@@ -11,7 +12,7 @@ import (
 
 func (cli *VanClient) ConnectorRemove(name string) error {
 
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve transport container: %w", err)
 	}
@@ -25,6 +26,12 @@ func (cli *VanClient) ConnectorRemove(name string) error {
 	if found {
 		current.RemoveConnSslProfile(name)
 
+		// drop the link from the running router before its certificates go
+		liveErr := qdr.DeleteConnector(name, cli.DockerInterface)
+		if liveErr == nil {
+			liveErr = qdr.DeleteSslProfile(name+"-profile", cli.DockerInterface)
+		}
+
 		err = os.RemoveAll(types.GetSkupperPath(types.ConnectionsPath) + "/" + name)
 		if err != nil {
 			return fmt.Errorf("Failed to remove connector file contents: %w", err)
@@ -34,27 +41,14 @@ func (cli *VanClient) ConnectorRemove(name string) error {
 		if err != nil {
 			return fmt.Errorf("Failed to update router config file: %w", err)
 		}
-	}
-
-	err = docker.RestartTransportContainer(cli.DockerInterface)
-	if err != nil {
-		return fmt.Errorf("Failed to restart transport container: %w", err)
-	}
-
-	err = docker.RestartContainer(types.ControllerDeploymentName, cli.DockerInterface)
-	if err != nil {
-		return fmt.Errorf("Failed to restart controller container: %w", err)
-	}
-
-	// restart proxies
-	vsis, err := cli.ServiceInterfaceList()
-	if err != nil {
-		return fmt.Errorf("Failed to list proxies to restart: %w", err)
-	}
-	for _, vs := range vsis {
-		err = docker.RestartContainer(vs.Address, cli.DockerInterface)
+		err = cli.saveState(types.ConnectionsPath, types.ConfigPath)
 		if err != nil {
-			return fmt.Errorf("Failed to restart proxy container: %w", err)
+			return err
+		}
+
+		if liveErr != nil {
+			log.Println("Failed to remove connector from running router, restarting it:", liveErr.Error())
+			return cli.restartTransport()
 		}
 	}
 
@@ -3,10 +3,14 @@ package client
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker/fake"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
 	"gotest.tools/assert"
 )
 
@@ -16,8 +20,7 @@ func TestConnectorCreateTokenInterior(t *testing.T) {
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newFakeClient()
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -47,8 +50,7 @@ func TestConnectorCreateTokenEdge(t *testing.T) {
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newFakeClient()
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -78,8 +80,7 @@ func TestConnectorCreateNoFileError(t *testing.T) {
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newFakeClient()
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -108,8 +109,7 @@ func TestConnectorCreateFakeOut(t *testing.T) {
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newFakeClient()
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -159,3 +159,84 @@ func TestConnectorCreateFakeOut(t *testing.T) {
 	errors = cli.RouterRemove()
 	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
 }
+
+func TestConnectorCreateRemoveLive(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "connector")
+	assert.Check(t, err, "Unable to create temporary directory")
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	managed := []string{}
+	failManagement := false
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		if len(cmd) > 1 && cmd[0] == "qdmanage" {
+			if cmd[1] == "query" {
+				return fake.ExecResult{Stdout: "[]"}
+			}
+			if failManagement {
+				return fake.ExecResult{Stderr: "router not ready", ExitCode: 1}
+			}
+			managed = append(managed, strings.Join(cmd[1:], " "))
+		}
+		return fake.ExecResult{}
+	}
+
+	scs := types.SiteConfigSpec{
+		SkupperName: "skupper",
+	}
+	err = cli.RouterCreate(scs)
+	assert.Assert(t, err, "Unable to create VAN router")
+	err = cli.ConnectorTokenCreate("subject1", tmpDir+"/conn1.yaml")
+	assert.Assert(t, err, "Unable to create token")
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
+
+	err = cli.RouterCreate(scs)
+	assert.Assert(t, err, "Unable to create VAN router")
+	before, err := dd.InspectContainer(types.TransportDeploymentName)
+	assert.Assert(t, err)
+
+	_, err = cli.ConnectorCreate(tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{Name: "link1", Cost: 2})
+	assert.Assert(t, err, "Unable to create connector")
+	err = cli.ConnectorRemove("link1")
+	assert.Assert(t, err, "Unable to remove connector")
+
+	after, err := dd.InspectContainer(types.TransportDeploymentName)
+	assert.Assert(t, err)
+	assert.Equal(t, after.ID, before.ID, "transport container should not be re-created")
+	assert.Equal(t, len(managed), 4)
+	assert.Assert(t, strings.HasPrefix(managed[0], "create --type sslProfile --name link1-profile caCertFile=/etc/qpid-dispatch/connections/link1/ca.crt"), managed[0])
+	assert.Assert(t, strings.HasPrefix(managed[1], "create --type connector --name link1 cost=2 host="), managed[1])
+	assert.Assert(t, strings.HasSuffix(managed[1], "port=55671 role=inter-router sslProfile=link1-profile"), managed[1])
+	assert.Equal(t, managed[2], "delete --type connector --name link1")
+	assert.Equal(t, managed[3], "delete --type sslProfile --name link1-profile")
+
+	config, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
+	assert.Assert(t, err)
+	_, ok := config.Connectors["link1"]
+	assert.Assert(t, !ok)
+
+	// the router is restarted from the config file when it cannot be updated live,
+	// along with every proxy attached to it
+	bridge, err := docker.NewBridgeContainer([]types.ServiceInterface{
+		{Address: "tcp-go-echo", Protocol: "tcp", Port: 9090},
+	}, false, dd)
+	assert.Assert(t, err)
+	failManagement = true
+	_, err = cli.ConnectorCreate(tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{Name: "link2"})
+	assert.Assert(t, err, "Unable to create connector")
+	after, err = dd.InspectContainer(types.TransportDeploymentName)
+	assert.Assert(t, err)
+	assert.Assert(t, after.ID != before.ID, "transport container should be re-created")
+	config, err = qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
+	assert.Assert(t, err)
+	_, ok = config.Connectors["link2"]
+	assert.Assert(t, ok)
+	restarted, err := dd.InspectContainer(bridge.Name)
+	assert.Assert(t, err)
+	assert.Equal(t, restarted.RestartCount, 1)
+
+	errors = cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/skupperproject/skupper-docker/api/types"
 	"github.com/skupperproject/skupper-docker/pkg/docker"
@@ -11,7 +12,7 @@ import (
 
 func (cli *VanClient) ConnectorTokenCreate(subject string, secretFile string) error {
 	// verify that the transport is interior mode
-	router, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	router, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve transport container (need init?): %w", err)
 	}
@@ -30,10 +31,12 @@ func (cli *VanClient) ConnectorTokenCreate(subject string, secretFile string) er
 		return fmt.Errorf("Unable to retrieve CA data: %w", err)
 	}
 
-	ipAddr := string(router.NetworkSettings.Networks["skupper-network"].IPAddress)
+	ipAddr := string(router.NetworkSettings.Networks[types.GetTransportNetworkName()].IPAddress)
 	annotations := make(map[string]string)
 	annotations["inter-router-port"] = "55671"
 	annotations["inter-router-host"] = ipAddr
+	// sites on the same daemon reach the router by joining its network
+	annotations["network"] = types.GetTransportNetworkName()
 
 	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
 	if err != nil {
@@ -45,5 +48,23 @@ func (cli *VanClient) ConnectorTokenCreate(subject string, secretFile string) er
 	certData := certs.GenerateCertificateData(subject, subject, ipAddr, caData)
 	certs.PutCertificateData(subject, secretFile, certData, annotations)
 
-	return nil
+	// keep track of the token so a later certificate rotation can report it
+	caSubject, err := getCASubject(caData)
+	if err != nil {
+		return err
+	}
+	tokens, _, err := getIssuedTokens()
+	if err != nil {
+		return err
+	}
+	tokens = append(tokens, types.IssuedToken{
+		File:     secretFile,
+		Subject:  subject,
+		Issued:   time.Now().UTC().Format(time.RFC3339),
+		IssuerCA: caSubject,
+	})
+	if err := putIssuedTokens(tokens); err != nil {
+		return err
+	}
+	return cli.saveState(types.SitesPath)
 }
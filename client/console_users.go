@@ -0,0 +1,189 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+	"github.com/skupperproject/skupper-docker/pkg/utils"
+)
+
+// where the router finds the console users to build its sasldb from
+const routerSaslUsersPath = "/etc/qpid-dispatch/sasl-users"
+
+var validConsoleUser = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+func consoleUserPath(user string) string {
+	return filepath.Join(types.GetSkupperPath(types.ConsoleUsersPath), user)
+}
+
+// writeConsoleUser stores the password of a console user, hashed unless the
+// router console is enabled, as the router needs it in plain text to build
+// its sasldb
+func writeConsoleUser(user string, password string, routerConsole bool) error {
+	stored := password
+	if !routerConsole {
+		hash, err := utils.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		stored = hash
+	}
+	// only the owner may read the passwords, including files written before
+	// they were restricted
+	if err := ioutil.WriteFile(consoleUserPath(user), []byte(stored), 0600); err != nil {
+		return err
+	}
+	return os.Chmod(consoleUserPath(user), 0600)
+}
+
+// consoleSiteConfig returns the config of the site when its consoles
+// authenticate against the console users
+func (cli *VanClient) consoleSiteConfig() (*types.SiteConfig, error) {
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+	}
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve site config data: %w", err)
+	}
+	if !sc.Spec.EnableConsole && !sc.Spec.EnableRouterConsole {
+		return nil, fmt.Errorf("The site has no console, it must be initialised with --enable-console or --enable-router-console")
+	}
+	if sc.Spec.AuthMode != string(types.ConsoleAuthModeInternal) {
+		return nil, fmt.Errorf("Console users are only used when --console-auth=internal, the site has %q", sc.Spec.AuthMode)
+	}
+	return sc, nil
+}
+
+// updateRouterSasldb brings the sasldb of a running router in line with the
+// stored password of the user, a stopped router rebuilds it when started
+func (cli *VanClient) updateRouterSasldb(user string, remove bool) error {
+	router, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve transport container: %w", err)
+	}
+	db := docker.FindEnvVar(router.Config.Env, "QDROUTERD_AUTO_CREATE_SASLDB_PATH")
+	if db == "" || router.State == nil || !router.State.Running {
+		return nil
+	}
+	realm := docker.FindEnvVar(router.Config.Env, "APPLICATION_NAME")
+	if realm == "" {
+		realm = "qdrouterd"
+	}
+	command := []string{"saslpasswd2", "-d", "-f", db, "-u", realm, user}
+	if !remove {
+		command = []string{"sh", "-c", fmt.Sprintf("saslpasswd2 -c -p -f %s -u %s %s < %s/%s", db, realm, user, routerSaslUsersPath, user)}
+	}
+	result, err := qdr.Exec(cli.DockerInterface, types.GetTransportDeploymentName(), command)
+	if err != nil {
+		return fmt.Errorf("Failed to update router sasldb: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("Failed to update router sasldb: %s", strings.TrimSpace(result.Stderr()))
+	}
+	return nil
+}
+
+// setConsoleUser stores the password of the user, a random one if none is
+// given, and returns it
+func (cli *VanClient) setConsoleUser(user string, password string, sc *types.SiteConfig) (string, error) {
+	if password == "" {
+		password = utils.RandomId(10)
+	}
+	if err := writeConsoleUser(user, password, sc.Spec.EnableRouterConsole); err != nil {
+		return "", fmt.Errorf("Failed to store console user %s: %w", user, err)
+	}
+	if err := cli.saveState(types.ConsoleUsersPath); err != nil {
+		return "", err
+	}
+	if sc.Spec.EnableRouterConsole {
+		if err := cli.updateRouterSasldb(user, false); err != nil {
+			return "", err
+		}
+	}
+	return password, nil
+}
+
+// ConsoleUserAdd adds a user to the consoles of the site and returns its
+// password, which is generated when none is given
+func (cli *VanClient) ConsoleUserAdd(user string, password string) (string, error) {
+	if !validConsoleUser.MatchString(user) {
+		return "", fmt.Errorf("Invalid console user name %q, it must be alphanumeric and may contain '.', '_' or '-'", user)
+	}
+	sc, err := cli.consoleSiteConfig()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(consoleUserPath(user)); err == nil {
+		return "", fmt.Errorf("Console user %s already exists", user)
+	}
+	return cli.setConsoleUser(user, password, sc)
+}
+
+// ConsoleUserSetPassword changes the password of a console user and returns
+// it, a new one is generated when none is given
+func (cli *VanClient) ConsoleUserSetPassword(user string, password string) (string, error) {
+	sc, err := cli.consoleSiteConfig()
+	if err != nil {
+		return "", err
+	}
+	if !validConsoleUser.MatchString(user) {
+		return "", fmt.Errorf("Console user %s not found", user)
+	}
+	if _, err := os.Stat(consoleUserPath(user)); err != nil {
+		return "", fmt.Errorf("Console user %s not found", user)
+	}
+	return cli.setConsoleUser(user, password, sc)
+}
+
+// ConsoleUserRemove removes a user from the consoles of the site
+func (cli *VanClient) ConsoleUserRemove(user string) error {
+	sc, err := cli.consoleSiteConfig()
+	if err != nil {
+		return err
+	}
+	if !validConsoleUser.MatchString(user) {
+		return fmt.Errorf("Console user %s not found", user)
+	}
+	if _, err := os.Stat(consoleUserPath(user)); err != nil {
+		return fmt.Errorf("Console user %s not found", user)
+	}
+	if err := os.Remove(consoleUserPath(user)); err != nil {
+		return fmt.Errorf("Failed to remove console user %s: %w", user, err)
+	}
+	if err := cli.saveState(types.ConsoleUsersPath); err != nil {
+		return err
+	}
+	if sc.Spec.EnableRouterConsole {
+		return cli.updateRouterSasldb(user, true)
+	}
+	return nil
+}
+
+// ConsoleUserList lists the users of the consoles of the site
+func (cli *VanClient) ConsoleUserList() ([]string, error) {
+	if _, err := cli.consoleSiteConfig(); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(types.GetSkupperPath(types.ConsoleUsersPath))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve console users: %w", err)
+	}
+	users := []string{}
+	for _, f := range files {
+		if !f.IsDir() {
+			users = append(users, f.Name())
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker/fake"
+	"github.com/skupperproject/skupper-docker/pkg/utils"
+)
+
+func TestConsoleUsers(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "consoleusers")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, _ := newFakeClient()
+	_, err = cli.ConsoleUserList()
+	assert.ErrorContains(t, err, "need init?")
+
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		EnableConsole:    true,
+		User:             "admin",
+		Password:         "secret",
+	})
+	assert.Assert(t, err)
+	stored := func(user string) string {
+		data, err := ioutil.ReadFile(types.GetSkupperPath(types.ConsoleUsersPath) + "/" + user)
+		assert.Check(t, err)
+		return string(data)
+	}
+	// neither the users store nor the site config keep the password
+	assert.Assert(t, utils.IsPasswordHash(stored("admin")))
+	assert.Assert(t, utils.CheckPassword(stored("admin"), "secret"))
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, sc.Spec.Password, "")
+
+	password, err := cli.ConsoleUserAdd("fred", "flintstone")
+	assert.Check(t, err)
+	assert.Equal(t, password, "flintstone")
+	generated, err := cli.ConsoleUserAdd("barney", "")
+	assert.Check(t, err)
+	assert.Equal(t, len(generated), 10)
+	assert.Assert(t, utils.CheckPassword(stored("barney"), generated))
+	assert.Assert(t, !strings.Contains(stored("barney"), generated))
+
+	_, err = cli.ConsoleUserAdd("fred", "")
+	assert.Error(t, err, "Console user fred already exists")
+	_, err = cli.ConsoleUserAdd("../fred", "")
+	assert.ErrorContains(t, err, "Invalid console user name")
+
+	users, err := cli.ConsoleUserList()
+	assert.Check(t, err)
+	assert.DeepEqual(t, users, []string{"admin", "barney", "fred"})
+
+	_, err = cli.ConsoleUserSetPassword("fred", "wilma")
+	assert.Check(t, err)
+	assert.Assert(t, utils.CheckPassword(stored("fred"), "wilma"))
+	assert.Assert(t, !utils.CheckPassword(stored("fred"), "flintstone"))
+	for _, user := range users {
+		info, err := os.Stat(types.GetSkupperPath(types.ConsoleUsersPath) + "/" + user)
+		assert.Assert(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+	}
+	_, err = cli.ConsoleUserSetPassword("dino", "")
+	assert.Error(t, err, "Console user dino not found")
+
+	assert.Check(t, cli.ConsoleUserRemove("barney"))
+	assert.Error(t, cli.ConsoleUserRemove("barney"), "Console user barney not found")
+	users, err = cli.ConsoleUserList()
+	assert.Check(t, err)
+	assert.DeepEqual(t, users, []string{"admin", "fred"})
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+
+	// without internal auth there are no users to manage
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:   "skupper",
+		EnableConsole: true,
+		AuthMode:      types.ConsoleAuthModeUnsecured,
+	})
+	assert.Assert(t, err)
+	_, err = cli.ConsoleUserAdd("fred", "")
+	assert.Error(t, err, `Console users are only used when --console-auth=internal, the site has "unsecured"`)
+	errors = cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
+
+func TestConsoleUsersWithRouterConsole(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "consoleusers")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:         "skupper",
+		EnableConsole:       true,
+		EnableRouterConsole: true,
+		User:                "admin",
+		Password:            "secret",
+	})
+	assert.Assert(t, err)
+	commands := []string{}
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		commands = append(commands, container+": "+strings.Join(cmd, " "))
+		return fake.ExecResult{}
+	}
+
+	// the router needs the password itself for its sasldb, which is updated
+	// in place rather than restarting the router
+	_, err = cli.ConsoleUserAdd("fred", "flintstone")
+	assert.Check(t, err)
+	data, err := ioutil.ReadFile(types.GetSkupperPath(types.ConsoleUsersPath) + "/fred")
+	assert.Check(t, err)
+	assert.Equal(t, string(data), "flintstone")
+	assert.Check(t, cli.ConsoleUserRemove("fred"))
+	assert.DeepEqual(t, commands, []string{
+		"skupper-router: sh -c saslpasswd2 -c -p -f /tmp/qdrouterd.sasldb -u skupper-router fred < /etc/qpid-dispatch/sasl-users/fred",
+		"skupper-router: saslpasswd2 -d -f /tmp/qdrouterd.sasldb -u skupper-router fred",
+	})
+
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		return fake.ExecResult{ExitCode: 1, Stderr: "saslpasswd2: generic failure"}
+	}
+	_, err = cli.ConsoleUserSetPassword("admin", "")
+	assert.Error(t, err, "Failed to update router sasldb: saslpasswd2: generic failure")
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
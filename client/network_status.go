@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+)
+
+// NetworkStatus lists the routers the site router knows about, with the site
+// each belongs to, and the services provided by each site
+func (cli *VanClient) NetworkStatus() (*types.NetworkStatusResponse, error) {
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+	}
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve site config data: %w", err)
+	}
+	vsis, err := cli.ServiceInterfaceList()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve services: %w", err)
+	}
+	return GetNetworkStatus(sc.UID, vsis, cli.DockerInterface)
+}
+
+// GetNetworkStatus builds the status of the network from the site router of
+// the site with the given id, services are assigned to the sites they
+// originate from
+func GetNetworkStatus(siteId string, vsis []types.ServiceInterface, dd libdocker.Interface) (*types.NetworkStatusResponse, error) {
+	nodes, err := qdr.GetNodes(dd)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve router nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		// an edge router has no view of the network beyond itself
+		local, err := qdr.GetRouterMetadata("", dd)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve router metadata: %w", err)
+		}
+		nodes = append(nodes, qdr.RouterNode{
+			Id:      local.Id,
+			NextHop: "(self)",
+		})
+	}
+
+	status := &types.NetworkStatusResponse{
+		Routers: []types.NetworkRouterStatus{},
+		Sites:   []types.NetworkSiteStatus{},
+	}
+	sites := map[string]*types.NetworkSiteStatus{}
+	getSite := func(siteId string) *types.NetworkSiteStatus {
+		if _, ok := sites[siteId]; !ok {
+			sites[siteId] = &types.NetworkSiteStatus{
+				SiteId:   siteId,
+				Routers:  []string{},
+				Services: []string{},
+			}
+		}
+		return sites[siteId]
+	}
+
+	for _, n := range nodes {
+		router := types.NetworkRouterStatus{
+			Id:        n.Id,
+			Cost:      n.Cost,
+			LinkState: n.LinkState,
+		}
+		if n.NextHop == "(self)" {
+			router.Local = true
+		} else if n.NextHop != "" {
+			router.NextHop = n.NextHop
+		}
+		metadata, err := qdr.GetRouterMetadata(n.Id, dd)
+		if err != nil {
+			log.Printf("Failed to retrieve metadata of router %s: %s", n.Id, err.Error())
+		} else {
+			site := qdr.ParseSiteMetadata(metadata.Metadata)
+			router.SiteId = site.Id
+			router.SiteName = site.Name
+		}
+		if router.Local && router.SiteId == "" {
+			router.SiteId = siteId
+		}
+		status.Routers = append(status.Routers, router)
+		if router.SiteId != "" {
+			site := getSite(router.SiteId)
+			site.Routers = append(site.Routers, router.Id)
+			if site.SiteName == "" {
+				site.SiteName = router.SiteName
+			}
+		}
+	}
+	sort.Slice(status.Routers, func(i, j int) bool {
+		if status.Routers[i].Cost != status.Routers[j].Cost {
+			return status.Routers[i].Cost < status.Routers[j].Cost
+		}
+		return status.Routers[i].Id < status.Routers[j].Id
+	})
+
+	// services synced from other sites carry the id of their site as origin
+	for _, si := range vsis {
+		origin := si.Origin
+		if types.IsLocalOrigin(origin) {
+			origin = siteId
+		}
+		site := getSite(origin)
+		site.Services = append(site.Services, si.Address)
+	}
+
+	siteIds := []string{}
+	for siteId := range sites {
+		siteIds = append(siteIds, siteId)
+	}
+	sort.Strings(siteIds)
+	for _, siteId := range siteIds {
+		sort.Strings(sites[siteId].Services)
+		status.Sites = append(status.Sites, *sites[siteId])
+	}
+	return status, nil
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker/fake"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+)
+
+func TestNetworkStatus(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "networkstatus")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	_, err = cli.NetworkStatus()
+	assert.ErrorContains(t, err, "need init?")
+
+	err = cli.RouterCreate(types.SiteConfigSpec{SkupperName: "site-a"})
+	assert.Assert(t, err)
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	assert.Assert(t, err)
+
+	assert.Assert(t, cli.ServiceInterfaceCreate(&types.ServiceInterface{Address: "local-echo", Protocol: "tcp", Port: 9090}))
+	services := map[string]types.ServiceInterface{}
+	data, err := ioutil.ReadFile(types.GetSkupperPath(types.ServicesPath) + "/skupper-services")
+	assert.Assert(t, err)
+	assert.Assert(t, json.Unmarshal(data, &services))
+	services["remote-echo"] = types.ServiceInterface{Address: "remote-echo", Protocol: "tcp", Port: 9191, Origin: "site-c-id"}
+	services["edge-echo"] = types.ServiceInterface{Address: "edge-echo", Protocol: "http", Port: 8080, Origin: "site-d-id"}
+	data, err = json.Marshal(services)
+	assert.Assert(t, err)
+	assert.Assert(t, ioutil.WriteFile(types.GetSkupperPath(types.ServicesPath)+"/skupper-services", data, 0755))
+
+	nodes := `[
+		{"id": "site-a-router", "nextHop": "(self)", "cost": 0, "linkState": ["site-b-router"]},
+		{"id": "site-b-router", "nextHop": "", "cost": 1, "linkState": ["site-a-router", "site-c-router"]},
+		{"id": "site-c-router", "nextHop": "site-b-router", "cost": 2, "linkState": ["site-b-router"]}
+	]`
+	metadata := map[string]string{
+		"site-a-router": qdr.GetSiteMetadata(sc.UID, "site-a"),
+		"site-b-router": qdr.GetSiteMetadata("site-b-id", "site-b"),
+		"site-c-router": "site-c-id",
+	}
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		if len(cmd) >= 4 && cmd[0] == "qdmanage" && cmd[3] == "node" {
+			return fake.ExecResult{Stdout: nodes}
+		}
+		if len(cmd) == 6 && cmd[0] == "qdmanage" && cmd[3] == "router" {
+			encoded, _ := json.Marshal([]qdr.RouterMetadata{{Id: cmd[5], Metadata: metadata[cmd[5]]}})
+			return fake.ExecResult{Stdout: string(encoded)}
+		}
+		return fake.ExecResult{Stdout: "[]"}
+	}
+
+	status, err := cli.NetworkStatus()
+	assert.Assert(t, err)
+	assert.DeepEqual(t, status.Routers, []types.NetworkRouterStatus{
+		{Id: "site-a-router", SiteId: sc.UID, SiteName: "site-a", Cost: 0, Local: true, LinkState: []string{"site-b-router"}},
+		{Id: "site-b-router", SiteId: "site-b-id", SiteName: "site-b", Cost: 1, LinkState: []string{"site-a-router", "site-c-router"}},
+		{Id: "site-c-router", SiteId: "site-c-id", NextHop: "site-b-router", Cost: 2, LinkState: []string{"site-b-router"}},
+	})
+	sites := map[string]types.NetworkSiteStatus{}
+	for _, site := range status.Sites {
+		sites[site.SiteId] = site
+	}
+	assert.Equal(t, len(sites), 4)
+	assert.DeepEqual(t, sites[sc.UID].Services, []string{"local-echo"})
+	assert.DeepEqual(t, sites[sc.UID].Routers, []string{"site-a-router"})
+	assert.DeepEqual(t, sites["site-b-id"].Services, []string{})
+	assert.DeepEqual(t, sites["site-c-id"].Services, []string{"remote-echo"})
+	assert.DeepEqual(t, sites["site-d-id"].Routers, []string{})
+	assert.DeepEqual(t, sites["site-d-id"].Services, []string{"edge-echo"})
+}
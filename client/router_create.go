@@ -17,6 +17,7 @@ import (
 
 	"github.com/skupperproject/skupper-docker/api/types"
 	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
 	"github.com/skupperproject/skupper-docker/pkg/qdr"
 	"github.com/skupperproject/skupper-docker/pkg/utils"
 	"github.com/skupperproject/skupper-docker/pkg/utils/configs"
@@ -83,7 +84,8 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 	//TODO: think througn van name, router name, secret names, etc.
 	if options.SkupperName == "" {
 		info, _ := cli.DockerInterface.Info()
-		van.Name = info.Name
+		// sites sharing the daemon need router ids of their own
+		van.Name = types.GetSiteScopedName(info.Name)
 	} else {
 		van.Name = options.SkupperName
 	}
@@ -101,9 +103,10 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 		"skupper.io/component": types.TransportComponentName,
 		"prometheus.io/port":   "9090",
 		"prometheus.io/scrape": "true",
+		types.SiteQualifier:    types.GetSiteName(),
 	}
 
-	routerConfig := qdr.InitialConfig(van.Name+"-${HOSTNAME}", siteId, options.IsEdge)
+	routerConfig := qdr.InitialConfig(van.Name+"-${HOSTNAME}", qdr.GetSiteMetadata(siteId, van.Name), options.IsEdge)
 	routerConfig.AddAddress(qdr.Address{
 		Prefix:       "mc",
 		Distribution: "multicast",
@@ -223,11 +226,11 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 
 	// Note: use index to make directory, use index/value to make mount
 	mounts := make(map[string]string)
-	mounts[types.GetSkupperPath(types.CertsPath)] = "/etc/qpid-dispatch-certs"
-	mounts[types.GetSkupperPath(types.ConnectionsPath)] = "/etc/qpid-dispatch/connections"
-	mounts[types.GetSkupperPath(types.ConfigPath)] = "/etc/qpid-dispatch/config"
-	mounts[types.GetSkupperPath(types.ConsoleUsersPath)] = "/etc/qpid-dispatch/sasl-users/"
-	mounts[types.GetSkupperPath(types.SaslConfigPath)] = "/etc/sasl2"
+	mounts[types.GetSkupperMountSource(types.CertsPath)] = "/etc/qpid-dispatch-certs"
+	mounts[types.GetSkupperMountSource(types.ConnectionsPath)] = "/etc/qpid-dispatch/connections"
+	mounts[types.GetSkupperMountSource(types.ConfigPath)] = "/etc/qpid-dispatch/config"
+	mounts[types.GetSkupperMountSource(types.ConsoleUsersPath)] = "/etc/qpid-dispatch/sasl-users/"
+	mounts[types.GetSkupperMountSource(types.SaslConfigPath)] = "/etc/sasl2"
 	van.Transport.Mounts = mounts
 
 	cas := []types.CertAuthority{}
@@ -275,10 +278,17 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 	van.Controller.Labels = map[string]string{
 		"application":          types.ControllerDeploymentName,
 		"skupper.io/component": types.ControllerComponentName,
+		"prometheus.io/port":   strconv.Itoa(int(types.ControllerMetricsPort)),
+		"prometheus.io/scrape": "true",
+		types.SiteQualifier:    types.GetSiteName(),
 	}
+	van.Controller.LivenessPort = types.ControllerMetricsPort
+	containerRuntime := cli.DockerInterface.RuntimeInfo()
 	var skupperHost string
-	if runtime.GOOS == "linux" {
-		skupperHost = utils.GetInternalIP("docker0")
+	if os.Getenv("SKUPPER_HOST") != "" {
+		skupperHost = os.Getenv("SKUPPER_HOST")
+	} else if runtime.GOOS == "linux" || containerRuntime.Name == libdocker.RuntimePodman || containerRuntime.Remote {
+		skupperHost = docker.HostGatewayAddress(cli.DockerInterface)
 	} else {
 		skupperHost = "host-gateway"
 	}
@@ -286,18 +296,53 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 		"SKUPPER_SITE_ID=" + siteId,
 		"SKUPPER_TMPDIR=" + os.Getenv("SKUPPER_TMPDIR"),
 		"SKUPPER_PROXY_IMAGE=" + van.Controller.Image,
+		"QDROUTERD_IMAGE=" + van.Transport.Image,
 		"SKUPPER_HOST=" + skupperHost,
+		"SKUPPER_SITE=" + types.GetSiteName(),
 	}
 	if options.MapToHost {
 		van.Controller.EnvVar = append(van.Controller.EnvVar, "SKUPPER_MAP_TO_HOST=true")
 	}
+	if options.SharedBridge {
+		van.Controller.EnvVar = append(van.Controller.EnvVar, "SKUPPER_SHARED_BRIDGE=true")
+	}
 	if options.TraceLog {
 		van.Controller.EnvVar = append(van.Controller.EnvVar, "PN_TRACE_FRM=1")
 	}
-	van.Controller.Mounts = map[string]string{
-		types.GetSkupperPath(types.CertsPath) + "/" + "skupper": "/etc/messaging",
-		types.GetSkupperPath(types.ServicesPath):                "/etc/messaging/services",
-		"/var/run":                                              "/var/run",
+	if types.GetSkupperStorage() == types.StorageVolume {
+		// the controller finds its credentials below the certs volume
+		van.Controller.Mounts = map[string]string{
+			types.GetSkupperVolume(types.CertsPath):    "/etc/qpid-dispatch-certs",
+			types.GetSkupperVolume(types.ServicesPath): "/etc/messaging/services",
+		}
+		van.Controller.EnvVar = append(van.Controller.EnvVar, "SKUPPER_STORAGE="+types.StorageVolume)
+	} else {
+		van.Controller.Mounts = map[string]string{
+			types.GetSkupperPath(types.CertsPath) + "/" + "skupper": "/etc/messaging",
+			types.GetSkupperPath(types.ServicesPath):                "/etc/messaging/services",
+		}
+	}
+	if options.EnableConsole {
+		// the console is served by the controller on a port of the host, only
+		// on its loopback address unless told otherwise as it is plain http
+		van.Controller.HostIP = "127.0.0.1"
+		if os.Getenv("SKUPPER_CONSOLE_HOST_IP") != "" {
+			van.Controller.HostIP = os.Getenv("SKUPPER_CONSOLE_HOST_IP")
+		}
+		van.Controller.EnvVar = append(van.Controller.EnvVar, "SKUPPER_CONSOLE_AUTH="+options.AuthMode)
+		van.Controller.Ports = nat.PortSet{
+			nat.Port(strconv.Itoa(int(types.ConsoleDefaultServicePort)) + "/tcp"): struct{}{},
+		}
+		if options.AuthMode == string(types.ConsoleAuthModeInternal) {
+			van.Controller.Mounts[types.GetSkupperMountSource(types.ConsoleUsersPath)] = types.ConsoleUsersMountPath
+		}
+	}
+	if containerRuntime.Name == libdocker.RuntimePodman && containerRuntime.Socket != "" {
+		// the podman socket is where the controller expects the docker one
+		van.Controller.Mounts[containerRuntime.Socket] = "/var/run/docker.sock"
+		van.Controller.EnvVar = append(van.Controller.EnvVar, "SKUPPER_RUNTIME="+libdocker.RuntimePodman)
+	} else {
+		van.Controller.Mounts["/var/run"] = "/var/run"
 	}
 
 	return van, nil
@@ -315,6 +360,8 @@ func (cli *VanClient) RouterCreate(options types.SiteConfigSpec) error {
 			if options.Password == "" {
 				options.Password = utils.RandomId(10)
 			}
+		} else if options.AuthMode != types.ConsoleAuthModeUnsecured {
+			return fmt.Errorf("--console-auth must be one of: [%s, %s]", types.ConsoleAuthModeInternal, types.ConsoleAuthModeUnsecured)
 		} else {
 			if options.User != "" {
 				return fmt.Errorf("--router-console-user only valid when --router-console-auth=internal")
@@ -326,6 +373,11 @@ func (cli *VanClient) RouterCreate(options types.SiteConfigSpec) error {
 
 	}
 
+	if err := selectStorage(options.Storage, cli.DockerInterface.RuntimeInfo()); err != nil {
+		return err
+	}
+	options.Storage = types.GetSkupperStorage()
+
 	// TODO check if resources already exist: either delete them all or error out
 	// setup host dirs
 	_ = os.RemoveAll(types.GetSkupperPath(types.HostPath))
@@ -336,8 +388,15 @@ func (cli *VanClient) RouterCreate(options types.SiteConfigSpec) error {
 	if err := os.Mkdir(types.GetSkupperPath(types.SitesPath), 0755); err != nil {
 		return err
 	}
+	// record the tokens of the site from the start
+	if err := putIssuedTokens([]types.IssuedToken{}); err != nil {
+		return err
+	}
 
-	sc, err := cli.SiteConfigCreate(options)
+	// the password is only kept in the console users store
+	spec := options
+	spec.Password = ""
+	sc, err := cli.SiteConfigCreate(spec)
 	if err != nil {
 		return err
 	}
@@ -357,8 +416,8 @@ func (cli *VanClient) RouterCreate(options types.SiteConfigSpec) error {
 		return err
 	}
 
-	for mnt := range van.Transport.Mounts {
-		if err := os.Mkdir(mnt, 0755); err != nil {
+	for _, p := range []types.Path{types.CertsPath, types.ConnectionsPath, types.ConfigPath, types.ConsoleUsersPath, types.SaslConfigPath} {
+		if err := os.Mkdir(types.GetSkupperPath(p), 0755); err != nil {
 			return err
 		}
 	}
@@ -399,14 +458,14 @@ sasldb_path: /tmp/qdrouterd.sasldb
 		if err != nil {
 			return err
 		}
-		err = ioutil.WriteFile(types.GetSkupperPath(types.ConsoleUsersPath)+"/"+options.User, []byte(options.Password), 0755)
+		err = writeConsoleUser(options.User, options.Password, options.EnableRouterConsole)
 		if err != nil {
 			return err
 		}
 	}
 
 	// create user network
-	_, err = docker.NewTransportNetwork(types.TransportNetworkName, cli.DockerInterface)
+	_, err = docker.NewTransportNetwork(types.GetTransportNetworkName(), cli.DockerInterface)
 	if err != nil {
 		return err
 	}
@@ -425,6 +484,11 @@ sasldb_path: /tmp/qdrouterd.sasldb
 		generateCredentials(cred.CA, cred.Name, cred.Subject, cred.Hosts, cred.ConnectJson)
 	}
 
+	err = cli.saveState(types.StatePaths...)
+	if err != nil {
+		return err
+	}
+
 	//TODO : generate certs first?
 	err = docker.StartContainer(transport.Name, cli.DockerInterface)
 	if err != nil {
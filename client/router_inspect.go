@@ -3,17 +3,23 @@ package client
 import (
 	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/docker/go-connections/nat"
+
 	"github.com/skupperproject/skupper-docker/api/types"
 	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
 	"github.com/skupperproject/skupper-docker/pkg/qdr"
 )
 
 func (cli *VanClient) RouterInspect() (*types.RouterInspectResponse, error) {
 	vir := &types.RouterInspectResponse{}
 
-	transport, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	transport, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		log.Println("Failed to retrieve transport container (need init?): ", err.Error())
 		return vir, err
@@ -26,7 +32,7 @@ func (cli *VanClient) RouterInspect() (*types.RouterInspectResponse, error) {
 	}
 	vir.Status.State = transport.State.Status
 
-	controller, err := docker.InspectContainer(types.ControllerDeploymentName, cli.DockerInterface)
+	controller, err := docker.InspectContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		log.Println("Failed to retrieve controller container (need init?): ", err.Error())
 		return vir, err
@@ -38,6 +44,11 @@ func (cli *VanClient) RouterInspect() (*types.RouterInspectResponse, error) {
 		return vir, err
 	}
 
+	consolePort := docker.PublishedPort(controller, nat.Port(strconv.Itoa(int(types.ConsoleDefaultServicePort))+"/tcp"))
+	if consolePort != "" {
+		vir.ConsoleUrl = "http://" + net.JoinHostPort(publishedHost(cli.DockerInterface.RuntimeInfo()), consolePort)
+	}
+
 	routerConfig, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
 	if err != nil {
 		return vir, fmt.Errorf("Failed to retrieve router config: %w", err)
@@ -63,3 +74,13 @@ func (cli *VanClient) RouterInspect() (*types.RouterInspectResponse, error) {
 
 	return vir, err
 }
+
+// publishedHost is the host the ports published by the daemon are reached on
+func publishedHost(runtime libdocker.RuntimeInfo) string {
+	if runtime.Remote {
+		if u, err := url.Parse(runtime.Host); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return "localhost"
+}
@@ -17,14 +17,14 @@ import (
 func (cli *VanClient) RouterRemove() []error {
 	results := []error{}
 
-	_, err := docker.InspectContainer(types.ControllerDeploymentName, cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
 	if err == nil {
 		// stop controller
-		err = docker.StopContainer(types.ControllerDeploymentName, cli.DockerInterface)
+		err = docker.StopContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
 		if err != nil {
 			results = append(results, fmt.Errorf("Could not stop controller container: %w", err))
 		} else {
-			err = docker.RemoveContainer(types.ControllerDeploymentName, cli.DockerInterface)
+			err = docker.RemoveContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
 			if err != nil {
 				results = append(results, fmt.Errorf("Could not remove controller container: %w", err))
 			}
@@ -38,7 +38,7 @@ func (cli *VanClient) RouterRemove() []error {
 		Filters: filters,
 		All:     true,
 	}
-	containers, err := docker.ListContainers(opts, cli.DockerInterface)
+	containers, err := docker.ListSiteContainers(opts, cli.DockerInterface)
 	if err == nil {
 		for _, container := range containers {
 			if value, ok := container.Labels["skupper.io/component"]; ok {
@@ -59,29 +59,36 @@ func (cli *VanClient) RouterRemove() []error {
 		results = append(results, fmt.Errorf("Failed to list proxy containers: %w", err))
 	}
 
-	_, err = docker.InspectContainer(types.TransportDeploymentName, cli.DockerInterface)
+	_, err = docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err == nil {
 		// stop transport
-		err = docker.StopContainer(types.TransportDeploymentName, cli.DockerInterface)
+		err = docker.StopContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 		if err != nil {
 			results = append(results, fmt.Errorf("Could not stop transport container: %w", err))
 		} else {
-			err = docker.RemoveContainer(types.TransportDeploymentName, cli.DockerInterface)
+			err = docker.RemoveContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 			if err != nil {
 				results = append(results, fmt.Errorf("Could not remove controller container: %w", err))
 			}
 		}
 	}
 
-	_, err = docker.InspectNetwork("skupper-network", cli.DockerInterface)
+	_, err = docker.InspectNetwork(types.GetTransportNetworkName(), cli.DockerInterface)
 	if err == nil {
 		// remove network
-		err = docker.RemoveNetwork("skupper-network", cli.DockerInterface)
+		err = docker.RemoveNetwork(types.GetTransportNetworkName(), cli.DockerInterface)
 		if err != nil {
 			results = append(results, fmt.Errorf("Could not remove skupper network: %w", err))
 		}
 	}
 
+	if types.GetSkupperStorage() == types.StorageVolume {
+		err = docker.RemoveStateVolumes(cli.DockerInterface)
+		if err != nil {
+			results = append(results, err)
+		}
+	}
+
 	// remove host files
 	err = os.RemoveAll(types.GetSkupperPath(types.HostPath))
 	if err != nil {
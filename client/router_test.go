@@ -3,10 +3,15 @@ package client
 import (
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/docker/go-connections/nat"
 	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
 	"gotest.tools/assert"
 )
 
@@ -132,8 +137,7 @@ func TestRouterCreateDefaults(t *testing.T) {
 		os.Setenv("SKUPPER_TMPDIR", tmpDir)
 		defer os.RemoveAll(tmpDir)
 
-		cli, err := NewClient()
-		assert.Check(t, err, c.doc)
+		cli, _ := newFakeClient()
 
 		scs := types.SiteConfigSpec{
 			SkupperName:         c.skupperName,
@@ -170,3 +174,127 @@ func TestRouterCreateDefaults(t *testing.T) {
 
 	}
 }
+
+func TestGetRouterSpecForPodman(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	dd.Runtime = libdocker.RuntimeInfo{
+		Name:     libdocker.RuntimePodman,
+		Socket:   "/run/user/1000/podman/podman.sock",
+		Rootless: true,
+	}
+	van, err := cli.GetRouterSpecFromOpts(types.SiteConfigSpec{SkupperName: "skupper"}, "site-a")
+	assert.Check(t, err)
+
+	// the controller reaches podman through the socket mounted in place of docker's
+	assert.Equal(t, van.Controller.Mounts["/run/user/1000/podman/podman.sock"], "/var/run/docker.sock")
+	_, ok := van.Controller.Mounts["/var/run"]
+	assert.Assert(t, !ok)
+	env := map[string]bool{}
+	for _, e := range van.Controller.EnvVar {
+		env[e] = true
+	}
+	assert.Assert(t, env["SKUPPER_RUNTIME=podman"])
+	// rootless podman has no bridge on the host
+	assert.Assert(t, env["SKUPPER_HOST=10.0.2.2"])
+}
+
+func TestHostGatewayForRemoteDaemon(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	dd.Runtime = libdocker.RuntimeInfo{
+		Name:   libdocker.RuntimeDocker,
+		Host:   "tcp://remote:2376",
+		Remote: true,
+	}
+	hostEnv := func() string {
+		van, err := cli.GetRouterSpecFromOpts(types.SiteConfigSpec{SkupperName: "skupper"}, "site-a")
+		assert.Check(t, err)
+		for _, e := range van.Controller.EnvVar {
+			if strings.HasPrefix(e, "SKUPPER_HOST=") {
+				return strings.TrimPrefix(e, "SKUPPER_HOST=")
+			}
+		}
+		return ""
+	}
+
+	// without a gateway to go on the daemon resolves host-gateway itself
+	assert.Equal(t, hostEnv(), "host-gateway")
+
+	// the host is the gateway of the default bridge network of the daemon
+	dd.SetNetworkGateway("bridge", "172.31.0.1")
+	assert.Equal(t, hostEnv(), "172.31.0.1")
+
+	assert.Check(t, cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"}))
+	service := &types.ServiceInterface{Address: "db", Protocol: "tcp", Port: 5432}
+	assert.Check(t, cli.ServiceInterfaceBind(service, "host-service", "db", "tcp", nil))
+	si, err := cli.ServiceInterfaceInspect("db")
+	assert.Check(t, err)
+	assert.Equal(t, si.Targets[0].Name, "db:172.31.0.1")
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
+
+func TestRouterCreateWithConsole(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		EnableConsole:    true,
+		User:             "fred",
+		Password:         "flintstone",
+	})
+	assert.Check(t, err)
+
+	// the controller serves the console with the users written by init
+	controller, err := docker.InspectContainer(types.ControllerDeploymentName, dd)
+	assert.Check(t, err)
+	assert.Equal(t, docker.FindEnvVar(controller.Config.Env, "SKUPPER_CONSOLE_AUTH"), "internal")
+	mounted := false
+	for _, m := range controller.Mounts {
+		if m.Destination == types.ConsoleUsersMountPath {
+			mounted = m.Source == types.GetSkupperPath(types.ConsoleUsersPath)
+		}
+	}
+	assert.Assert(t, mounted)
+	// the plain http console is only published on the loopback address
+	consolePort := nat.Port(strconv.Itoa(int(types.ConsoleDefaultServicePort)) + "/tcp")
+	assert.Equal(t, controller.NetworkSettings.Ports[consolePort][0].HostIP, "127.0.0.1")
+	users, err := cli.ConsoleUserList()
+	assert.Check(t, err)
+	assert.DeepEqual(t, users, []string{"fred"})
+
+	vir, err := cli.RouterInspect()
+	assert.Check(t, err)
+	assert.Assert(t, strings.HasPrefix(vir.ConsoleUrl, "http://localhost:"), vir.ConsoleUrl)
+
+	// the published port survives the controller being re-created
+	assert.Check(t, docker.RestartControllerContainer(dd))
+	restarted, err := cli.RouterInspect()
+	assert.Check(t, err)
+	assert.Equal(t, restarted.ConsoleUrl, vir.ConsoleUrl)
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:   "skupper",
+		EnableConsole: true,
+		AuthMode:      "openshift",
+	})
+	assert.Error(t, err, "--console-auth must be one of: [internal, unsecured]")
+}
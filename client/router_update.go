@@ -0,0 +1,170 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+)
+
+// getUpdateImage returns the image requested with an option or the same
+// environment variable as init, the current image is pulled again otherwise
+func getUpdateImage(requested string, envName string, currentImage string) string {
+	if requested != "" {
+		return requested
+	} else if os.Getenv(envName) != "" {
+		return os.Getenv(envName)
+	}
+	return currentImage
+}
+
+func getImageVersion(image string, dd libdocker.Interface) string {
+	version, err := docker.GetImageVersion(image, dd)
+	if err != nil {
+		return image
+	}
+	return version
+}
+
+// imageChanged is true when the container is not running the latest pull of image
+func imageChanged(current *dockertypes.ContainerJSON, image string, dd libdocker.Interface) bool {
+	if current.Config.Image != image {
+		return true
+	}
+	ii, err := dd.InspectImageByID(image)
+	if err != nil {
+		return true
+	}
+	return ii.ID != current.Image
+}
+
+// RouterUpdate moves the router, controller and proxy containers of the site
+// onto new images, keeping the site id, certificates and connections
+func (cli *VanClient) RouterUpdate(options types.RouterUpdateOptions) ([]types.ComponentUpdate, error) {
+	transport, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+	}
+	controller, err := docker.InspectContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve controller container: %w", err)
+	}
+
+	filters := dockerfilters.NewArgs()
+	filters.Add("label", "skupper.io/component=proxy")
+	proxies, err := docker.ListSiteContainers(dockertypes.ContainerListOptions{
+		Filters: filters,
+		All:     true,
+	}, cli.DockerInterface)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list proxy containers: %w", err)
+	}
+
+	routerImage := getUpdateImage(options.RouterImage, "QDROUTERD_IMAGE", transport.Config.Image)
+	controllerImage := getUpdateImage(options.ControllerImage, "SKUPPER_CONTROLLER_IMAGE", controller.Config.Image)
+
+	updates := []types.ComponentUpdate{
+		{
+			Name:          types.GetTransportDeploymentName(),
+			Component:     types.TransportComponentName,
+			BeforeVersion: getImageVersion(transport.Config.Image, cli.DockerInterface),
+		},
+		{
+			Name:          types.GetControllerDeploymentName(),
+			Component:     types.ControllerComponentName,
+			BeforeVersion: getImageVersion(controller.Config.Image, cli.DockerInterface),
+		},
+	}
+	proxyContainers := map[string]*dockertypes.ContainerJSON{}
+	for _, proxy := range proxies {
+		name := strings.TrimPrefix(proxy.Names[0], "/")
+		current, err := docker.InspectContainer(name, cli.DockerInterface)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve proxy container %s: %w", name, err)
+		}
+		proxyContainers[name] = current
+		updates = append(updates, types.ComponentUpdate{
+			Name:          name,
+			Component:     "proxy",
+			BeforeVersion: getImageVersion(current.Config.Image, cli.DockerInterface),
+		})
+	}
+
+	err = cli.DockerInterface.PullImage(routerImage, dockertypes.AuthConfig{}, dockertypes.ImagePullOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to pull router image %s: %w", routerImage, err)
+	}
+	err = cli.DockerInterface.PullImage(controllerImage, dockertypes.AuthConfig{}, dockertypes.ImagePullOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to pull controller image %s: %w", controllerImage, err)
+	}
+
+	// proxies are deployed by the controller from QDROUTERD_IMAGE, so it has to
+	// follow the router image too
+	controllerChanged := imageChanged(controller, controllerImage, cli.DockerInterface) ||
+		docker.FindEnvVar(controller.Config.Env, "QDROUTERD_IMAGE") != routerImage
+
+	// keep the controller from re-creating proxies while they are replaced, the
+	// current one is started again if the update fails before replacing it
+	if controllerChanged {
+		err = docker.StopContainer(types.GetControllerDeploymentName(), cli.DockerInterface)
+		if err != nil {
+			log.Println("Failed to stop controller container", err.Error())
+		}
+		defer func() {
+			if updates[1].Updated {
+				return
+			}
+			if err := docker.StartContainer(types.GetControllerDeploymentName(), cli.DockerInterface); err != nil {
+				log.Println("Failed to restart controller container", err.Error())
+			}
+		}()
+	}
+
+	if imageChanged(transport, routerImage, cli.DockerInterface) {
+		err = docker.RecreateTransportContainer(routerImage, cli.DockerInterface)
+		if err != nil {
+			return updates, fmt.Errorf("Failed to update transport container: %w", err)
+		}
+		updates[0].Updated = true
+	}
+
+	for i := 2; i < len(updates); i++ {
+		if !imageChanged(proxyContainers[updates[i].Name], routerImage, cli.DockerInterface) {
+			continue
+		}
+		err = docker.RecreateProxyContainer(updates[i].Name, routerImage, cli.DockerInterface)
+		if err != nil {
+			return updates, err
+		}
+		updates[i].Updated = true
+	}
+
+	if controllerChanged {
+		err = docker.RecreateControllerContainer(controllerImage, []string{
+			"SKUPPER_PROXY_IMAGE=" + controllerImage,
+			"QDROUTERD_IMAGE=" + routerImage,
+		}, cli.DockerInterface)
+		if err != nil {
+			return updates, fmt.Errorf("Failed to update controller container: %w", err)
+		}
+		updates[1].Updated = true
+	}
+
+	for i, u := range updates {
+		current, err := docker.InspectContainer(u.Name, cli.DockerInterface)
+		if err != nil {
+			return updates, fmt.Errorf("Failed to retrieve updated container %s: %w", u.Name, err)
+		}
+		updates[i].AfterVersion = getImageVersion(current.Config.Image, cli.DockerInterface)
+	}
+
+	return updates, nil
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+)
+
+func TestRouterUpdate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "routerupdate")
+	assert.Assert(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+
+	_, err = cli.RouterUpdate(types.RouterUpdateOptions{})
+	assert.ErrorContains(t, err, "need init?")
+
+	err = cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"})
+	assert.Assert(t, err)
+	before, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	assert.Assert(t, err)
+	transport, err := docker.InspectContainer(types.TransportDeploymentName, cli.DockerInterface)
+	assert.Assert(t, err)
+
+	proxy, err := docker.NewProxyContainer(types.ServiceInterface{
+		Address:  "tcp-go-echo",
+		Protocol: "tcp",
+		Port:     9090,
+	}, "proxy-config", false, cli.DockerInterface)
+	assert.Assert(t, err)
+	assert.Assert(t, docker.StartContainer(proxy.Name, cli.DockerInterface))
+
+	updates, err := cli.RouterUpdate(types.RouterUpdateOptions{
+		RouterImage:     "quay.io/skupper/qdrouterd:next",
+		ControllerImage: "quay.io/skupper/skupper-docker-controller:next",
+	})
+	assert.Assert(t, err)
+	assert.Equal(t, len(updates), 3)
+	for _, u := range updates {
+		assert.Assert(t, u.Updated, u.Name)
+		assert.Assert(t, u.BeforeVersion != u.AfterVersion, u.Name)
+	}
+
+	updated, err := docker.InspectContainer(types.TransportDeploymentName, cli.DockerInterface)
+	assert.Assert(t, err)
+	assert.Equal(t, updated.Config.Image, "quay.io/skupper/qdrouterd:next")
+	assert.Equal(t, updated.State.Status, "running")
+	assert.DeepEqual(t, updated.Mounts, transport.Mounts)
+
+	controller, err := docker.InspectContainer(types.ControllerDeploymentName, cli.DockerInterface)
+	assert.Assert(t, err)
+	assert.Equal(t, controller.Config.Image, "quay.io/skupper/skupper-docker-controller:next")
+	assert.Equal(t, docker.FindEnvVar(controller.Config.Env, "QDROUTERD_IMAGE"), "quay.io/skupper/qdrouterd:next")
+	assert.Equal(t, docker.FindEnvVar(controller.Config.Env, "SKUPPER_SITE_ID"), before.UID)
+
+	updatedProxy, err := docker.InspectContainer("tcp-go-echo", cli.DockerInterface)
+	assert.Assert(t, err)
+	assert.Equal(t, updatedProxy.Config.Image, "quay.io/skupper/qdrouterd:next")
+	assert.Equal(t, docker.FindEnvVar(updatedProxy.Config.Env, "QDROUTERD_CONF"), "proxy-config")
+
+	after, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	assert.Assert(t, err)
+	assert.Equal(t, after.UID, before.UID)
+
+	// the images default to the current ones, nothing to do
+	updates, err = cli.RouterUpdate(types.RouterUpdateOptions{})
+	assert.Assert(t, err)
+	for _, u := range updates {
+		assert.Assert(t, !u.Updated, u.Name)
+		assert.Equal(t, u.BeforeVersion, u.AfterVersion, u.Name)
+	}
+
+	// the controller is started again when the update fails before replacing it
+	proxy, err = docker.NewProxyContainer(types.ServiceInterface{
+		Address:  "tcp-go-echo-2",
+		Protocol: "tcp",
+		Port:     9091,
+	}, "proxy-config", false, cli.DockerInterface)
+	assert.Assert(t, err)
+	dd.InjectError("RemoveContainer", fmt.Errorf("device busy"))
+	_, err = cli.RouterUpdate(types.RouterUpdateOptions{
+		ControllerImage: "quay.io/skupper/skupper-docker-controller:other",
+	})
+	assert.ErrorContains(t, err, "device busy")
+	controller, err = docker.InspectContainer(types.ControllerDeploymentName, cli.DockerInterface)
+	assert.Assert(t, err)
+	assert.Equal(t, controller.Config.Image, "quay.io/skupper/skupper-docker-controller:next")
+	assert.Assert(t, controller.State.Running)
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
@@ -10,7 +10,7 @@ import (
 func (cli *VanClient) ServiceInterfaceCreate(service *types.ServiceInterface) error {
 	//func (cli *VanClient) ServiceInterfaceCreate(targetType string, targetName string, options types.ServiceInterfaceCreateOptions) error {
 
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -12,7 +12,7 @@ import (
 func (cli *VanClient) ServiceInterfaceInspect(address string) (*types.ServiceInterface, error) {
 	svcDefs := make(map[string]types.ServiceInterface)
 
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -13,7 +13,7 @@ func (cli *VanClient) ServiceInterfaceList() ([]types.ServiceInterface, error) {
 	var vsis []types.ServiceInterface
 	svcDefs := make(map[string]types.ServiceInterface)
 
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -26,13 +26,25 @@ func (cli *VanClient) ServiceInterfaceList() ([]types.ServiceInterface, error) {
 	if err != nil {
 		return vsis, fmt.Errorf("Failed to decode json for service interface definitions: %w", err)
 	}
+	// services hosted by the shared bridge router resolve to its address
+	bridgeAliases := map[string]bool{}
+	bridge, bridgeErr := docker.InspectContainer(types.GetBridgeDeploymentName(), cli.DockerInterface)
+	if bridgeErr == nil {
+		if network, ok := bridge.NetworkSettings.Networks[types.GetTransportNetworkName()]; ok {
+			for _, alias := range network.Aliases {
+				bridgeAliases[alias] = true
+			}
+		}
+	}
 	for _, v := range svcDefs {
-		current, err := docker.InspectContainer(v.Address, cli.DockerInterface)
+		current, err := docker.InspectContainer(types.GetSiteScopedName(v.Address), cli.DockerInterface)
 		if err == nil {
-			v.Alias = string(current.NetworkSettings.Networks["skupper-network"].IPAddress)
+			v.Alias = string(current.NetworkSettings.Networks[types.GetTransportNetworkName()].IPAddress)
+		} else if bridgeAliases[v.Address] {
+			v.Alias = string(bridge.NetworkSettings.Networks[types.GetTransportNetworkName()].IPAddress)
 		}
 		vsis = append(vsis, v)
 	}
 
-	return vsis, err
+	return vsis, nil
 }
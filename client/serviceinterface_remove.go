@@ -12,7 +12,7 @@ import (
 func (cli *VanClient) ServiceInterfaceRemove(address string) error {
 	svcDefs := make(map[string]types.ServiceInterface)
 
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -42,5 +42,5 @@ func (cli *VanClient) ServiceInterfaceRemove(address string) error {
 		return fmt.Errorf("Failed to write service interface file: %w", err)
 	}
 
-	return nil
+	return cli.saveState(types.ServicesPath)
 }
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+)
+
+// ServiceInterfaceStats collects the traffic for each service of the site
+func (cli *VanClient) ServiceInterfaceStats() ([]types.ServiceInterfaceStats, error) {
+	vsis, err := cli.ServiceInterfaceList()
+	if err != nil {
+		return nil, err
+	}
+	return GetServiceStats(vsis, cli.DockerInterface)
+}
+
+// GetServiceStats collects the traffic for each of the given services from
+// the site router, which has the links for the service addresses, and the
+// proxy containers, which carry the tcp and http traffic
+func GetServiceStats(vsis []types.ServiceInterface, dd libdocker.Interface) ([]types.ServiceInterfaceStats, error) {
+	sort.Slice(vsis, func(i, j int) bool { return vsis[i].Address < vsis[j].Address })
+
+	stats := map[string]*types.ServiceInterfaceStats{}
+	result := []types.ServiceInterfaceStats{}
+	for _, si := range vsis {
+		stats[si.Address] = &types.ServiceInterfaceStats{
+			Address:  si.Address,
+			Protocol: si.Protocol,
+		}
+	}
+
+	links, err := qdr.GetLinks(types.GetTransportDeploymentName(), dd)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve router links: %w", err)
+	}
+	for _, l := range links {
+		if s, ok := statsForAddress(stats, qdr.GetAddressName(l.OwningAddr)); ok && l.LinkType == "endpoint" {
+			s.Links++
+		}
+	}
+
+	filters := dockerfilters.NewArgs()
+	filters.Add("label", "skupper.io/component=proxy")
+	proxies, err := docker.ListSiteContainers(dockertypes.ContainerListOptions{
+		Filters: filters,
+	}, dd)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list proxy containers: %w", err)
+	}
+	for _, proxy := range proxies {
+		name := strings.TrimPrefix(proxy.Names[0], "/")
+		if err := addProxyStats(name, stats, dd); err != nil {
+			log.Printf("Failed to retrieve traffic statistics from %s: %s", name, err.Error())
+		}
+	}
+
+	for _, si := range vsis {
+		result = append(result, *stats[si.Address])
+	}
+	return result, nil
+}
+
+// statsForAddress finds the service of a router address, each port of a
+// service with several has an address of its own suffixed with the port
+func statsForAddress(stats map[string]*types.ServiceInterfaceStats, address string) (*types.ServiceInterfaceStats, bool) {
+	if s, ok := stats[address]; ok {
+		return s, true
+	}
+	if i := strings.LastIndex(address, ":"); i > 0 {
+		s, ok := stats[address[:i]]
+		return s, ok
+	}
+	return nil, false
+}
+
+func addProxyStats(name string, stats map[string]*types.ServiceInterfaceStats, dd libdocker.Interface) error {
+	// every tcp connection is a delivery on the service address, counted where
+	// it enters the network so a connection to a local target is not counted
+	// again on its way out
+	addresses, err := qdr.GetAddresses(name, dd)
+	if err != nil {
+		return err
+	}
+	for _, a := range addresses {
+		if s, ok := statsForAddress(stats, qdr.GetAddressName(a.Name)); ok && s.Protocol == "tcp" {
+			s.TotalConnections += a.DeliveriesIngress
+		}
+	}
+
+	connections, err := qdr.GetTcpConnections(name, dd)
+	if err != nil {
+		return err
+	}
+	for _, c := range connections {
+		if s, ok := statsForAddress(stats, c.Address); ok {
+			s.ActiveConnections++
+			s.BytesIn += c.BytesIn
+			s.BytesOut += c.BytesOut
+		}
+	}
+
+	requests, err := qdr.GetHttpRequestInfo(name, dd)
+	if err != nil {
+		return err
+	}
+	for _, r := range requests {
+		if s, ok := statsForAddress(stats, r.Address); ok {
+			s.Requests += r.Requests
+			s.BytesIn += r.BytesIn
+			s.BytesOut += r.BytesOut
+		}
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker/fake"
+)
+
+func TestServiceInterfaceBind(t *testing.T) {
+	testCases := []struct {
+		doc           string
+		targetType    string
+		targetName    string
+		port          int
+		targetPort    int
+		protocol      string
+		expectedPort  int
+		expectedError string
+	}{
+		{
+			doc:          "container with service port",
+			targetType:   "container",
+			targetName:   "tcp-go-echo-server",
+			port:         9090,
+			protocol:     "tcp",
+			expectedPort: 9090,
+		},
+		{
+			doc:          "container with target port only",
+			targetType:   "container",
+			targetName:   "tcp-go-echo-server",
+			targetPort:   9091,
+			protocol:     "tcp",
+			expectedPort: 9091,
+		},
+		{
+			doc:           "container that does not exist",
+			targetType:    "container",
+			targetName:    "not-there",
+			port:          9090,
+			protocol:      "tcp",
+			expectedError: "Could not read container not-there: Error: No such container: not-there",
+		},
+		{
+			doc:          "host service",
+			targetType:   "host-service",
+			targetName:   "echo:10.0.0.1",
+			port:         8080,
+			protocol:     "http",
+			expectedPort: 8080,
+		},
+		{
+			doc:          "label selector",
+			targetType:   "selector",
+			targetName:   "app=web,tier=front",
+			port:         8080,
+			protocol:     "http",
+			expectedPort: 8080,
+		},
+		{
+			doc:           "invalid label selector",
+			targetType:    "selector",
+			targetName:    "app=",
+			port:          8080,
+			protocol:      "http",
+			expectedError: "Invalid label selector \"app=\", expected key=value[,key=value]",
+		},
+		{
+			doc:           "unsupported target type",
+			targetType:    "deployment",
+			targetName:    "echo",
+			port:          8080,
+			protocol:      "tcp",
+			expectedError: "VAN service interface unsupported target type",
+		},
+	}
+
+	for _, c := range testCases {
+		tmpDir, err := ioutil.TempDir("", "serviceinterface")
+		assert.Check(t, err, c.doc)
+		os.Setenv("SKUPPER_TMPDIR", tmpDir)
+		defer os.RemoveAll(tmpDir)
+
+		cli, dd := newFakeClient()
+		err = cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"})
+		assert.Check(t, err, c.doc)
+
+		_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+			Name: "tcp-go-echo-server",
+			Config: &dockercontainer.Config{
+				Image:        "quay.io/skupper/tcp-go-echo",
+				ExposedPorts: nat.PortSet{"9090/tcp": struct{}{}},
+			},
+		})
+		assert.Check(t, err, c.doc)
+
+		service := &types.ServiceInterface{
+			Address:  "tcp-go-echo",
+			Port:     c.port,
+			Protocol: c.protocol,
+		}
+		targetPorts := []int{}
+		if c.targetPort != 0 {
+			targetPorts = append(targetPorts, c.targetPort)
+		}
+		err = cli.ServiceInterfaceBind(service, c.targetType, c.targetName, c.protocol, targetPorts)
+		if c.expectedError != "" {
+			assert.Error(t, err, c.expectedError, c.doc)
+		} else {
+			assert.Check(t, err, c.doc)
+			si, err := cli.ServiceInterfaceInspect("tcp-go-echo")
+			assert.Check(t, err, c.doc)
+			assert.Assert(t, si != nil, c.doc)
+			assert.Equal(t, si.Port, c.expectedPort, c.doc)
+			assert.Equal(t, len(si.Targets), 1, c.doc)
+
+			err = cli.ServiceInterfaceUnbind(c.targetType, c.targetName, "tcp-go-echo", true)
+			assert.Check(t, err, c.doc)
+			si, err = cli.ServiceInterfaceInspect("tcp-go-echo")
+			assert.Check(t, err, c.doc)
+			assert.Assert(t, si == nil, c.doc)
+		}
+
+		errors := cli.RouterRemove()
+		assert.Assert(t, len(errors) == 0, c.doc)
+	}
+}
+
+func TestServiceInterfaceBindPorts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "serviceinterface")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	assert.Check(t, cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"}))
+	for _, name := range []string{"db-1", "db-2"} {
+		_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+			Name:   name,
+			Config: &dockercontainer.Config{Image: "postgres"},
+		})
+		assert.Check(t, err)
+	}
+
+	// the target ports of a new service become its ports
+	service := &types.ServiceInterface{Address: "db", Protocol: "tcp"}
+	assert.Check(t, cli.ServiceInterfaceBind(service, "container", "db-1", "tcp", []int{5432, 5433}))
+	si, err := cli.ServiceInterfaceInspect("db")
+	assert.Check(t, err)
+	assert.Equal(t, si.Port, 5432)
+	assert.DeepEqual(t, si.Ports, []int{5432, 5433})
+	assert.Equal(t, len(si.Targets[0].TargetPorts), 0)
+
+	// further targets map each port of the service in order
+	assert.Check(t, cli.ServiceInterfaceBind(si, "container", "db-2", "tcp", []int{6432, 6433}))
+	si, err = cli.ServiceInterfaceInspect("db")
+	assert.Check(t, err)
+	assert.DeepEqual(t, si.Targets[1].TargetPorts, map[int]int{5432: 6432, 5433: 6433})
+
+	err = cli.ServiceInterfaceBind(si, "container", "db-2", "tcp", []int{6432})
+	assert.Error(t, err, "1 target port(s) given for the 2 port(s) of service db")
+
+	si.Ports = []int{5433, 5432}
+	err = cli.ServiceInterfaceBind(si, "container", "db-2", "tcp", nil)
+	assert.Error(t, err, "Port 5432 must be the first of the service ports 5433,5432.")
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
+
+func TestServiceInterfaceBindHeadless(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "serviceinterface")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	assert.Check(t, cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"}))
+	for _, name := range []string{"kafka-0", "kafka-1", "kafka-2", "kafka-3"} {
+		_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+			Name:   name,
+			Config: &dockercontainer.Config{Image: "kafka"},
+		})
+		assert.Check(t, err)
+	}
+
+	// each bound container is an instance of the service
+	service := &types.ServiceInterface{Address: "kafka", Protocol: "tcp", Port: 9092, Headless: &types.Headless{Name: "kafka"}}
+	assert.Check(t, cli.ServiceInterfaceBind(service, "container", "kafka-0", "tcp", nil))
+	si, err := cli.ServiceInterfaceInspect("kafka")
+	assert.Check(t, err)
+	assert.Check(t, cli.ServiceInterfaceBind(si, "container", "kafka-1", "tcp", nil))
+	si, err = cli.ServiceInterfaceInspect("kafka")
+	assert.Check(t, err)
+	assert.DeepEqual(t, si.Headless, &types.Headless{Name: "kafka", Size: 2})
+
+	err = cli.ServiceInterfaceBind(si, "host-service", "myhost", "tcp", nil)
+	assert.Error(t, err, "Only containers can be bound to headless service kafka")
+
+	assert.Check(t, cli.ServiceInterfaceUnbind("container", "kafka-1", "kafka", false))
+	si, err = cli.ServiceInterfaceInspect("kafka")
+	assert.Check(t, err)
+	assert.Equal(t, si.Headless.Size, 1)
+
+	instances := func() map[string]int {
+		si, err := cli.ServiceInterfaceInspect("kafka")
+		assert.Check(t, err)
+		result := map[string]int{}
+		for _, target := range si.Targets {
+			result[target.Name] = *target.Instance
+		}
+		return result
+	}
+	for _, name := range []string{"kafka-1", "kafka-2"} {
+		si, err = cli.ServiceInterfaceInspect("kafka")
+		assert.Check(t, err)
+		assert.Check(t, cli.ServiceInterfaceBind(si, "container", name, "tcp", nil))
+	}
+	assert.DeepEqual(t, instances(), map[string]int{"kafka-0": 0, "kafka-1": 1, "kafka-2": 2})
+
+	// unbinding a middle instance leaves the others where they are
+	assert.Check(t, cli.ServiceInterfaceUnbind("container", "kafka-1", "kafka", false))
+	assert.DeepEqual(t, instances(), map[string]int{"kafka-0": 0, "kafka-2": 2})
+	si, err = cli.ServiceInterfaceInspect("kafka")
+	assert.Check(t, err)
+	assert.Equal(t, si.Headless.Size, 3)
+
+	// binding again keeps the instance, a new container takes the free one
+	assert.Check(t, cli.ServiceInterfaceBind(si, "container", "kafka-2", "tcp", nil))
+	si, err = cli.ServiceInterfaceInspect("kafka")
+	assert.Check(t, err)
+	assert.Check(t, cli.ServiceInterfaceBind(si, "container", "kafka-3", "tcp", nil))
+	assert.DeepEqual(t, instances(), map[string]int{"kafka-0": 0, "kafka-2": 2, "kafka-3": 1})
+
+	// the size shrinks once the highest instance goes
+	assert.Check(t, cli.ServiceInterfaceUnbind("container", "kafka-2", "kafka", false))
+	si, err = cli.ServiceInterfaceInspect("kafka")
+	assert.Check(t, err)
+	assert.Equal(t, si.Headless.Size, 2)
+
+	si.Protocol = "http"
+	err = cli.ServiceInterfaceBind(si, "container", "kafka-1", "http", nil)
+	assert.Error(t, err, "The headless option is currently only valid for tcp")
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
+
+func TestDeduceTargetPort(t *testing.T) {
+	testCases := []struct {
+		doc           string
+		exposed       nat.PortSet
+		imageExposed  nat.PortSet
+		labels        map[string]string
+		expectedPort  int
+		expectedPorts []int
+		expectedError string
+	}{
+		{
+			doc:          "single exposed port",
+			exposed:      nat.PortSet{"9090/tcp": struct{}{}},
+			expectedPort: 9090,
+		},
+		{
+			doc:          "port from image metadata",
+			imageExposed: nat.PortSet{"8080/tcp": struct{}{}},
+			expectedPort: 8080,
+		},
+		{
+			doc:          "udp ports are not candidates",
+			exposed:      nat.PortSet{"9090/tcp": struct{}{}, "53/udp": struct{}{}},
+			expectedPort: 9090,
+		},
+		{
+			doc:          "label takes precedence",
+			exposed:      nat.PortSet{"9090/tcp": struct{}{}, "9091/tcp": struct{}{}},
+			labels:       map[string]string{types.PortQualifier: "9091"},
+			expectedPort: 9091,
+		},
+		{
+			doc:           "several ports in the label",
+			exposed:       nat.PortSet{"9090/tcp": struct{}{}},
+			labels:        map[string]string{types.PortQualifier: "9091, 9092"},
+			expectedPort:  9091,
+			expectedPorts: []int{9091, 9092},
+		},
+		{
+			doc:           "invalid label",
+			labels:        map[string]string{types.PortQualifier: "echo"},
+			expectedError: "Invalid skupper.io/port label \"echo\" on container echo-server",
+		},
+		{
+			doc:           "several candidates",
+			exposed:       nat.PortSet{"9090/tcp": struct{}{}},
+			imageExposed:  nat.PortSet{"8080/tcp": struct{}{}, "9090/tcp": struct{}{}},
+			expectedError: "Container echo-server exposes ports 8080, 9090, choose one with --port or --target-port",
+		},
+		{
+			doc:           "no candidates",
+			expectedError: "Service port required and cannot be deduced.",
+		},
+	}
+
+	for _, c := range testCases {
+		tmpDir, err := ioutil.TempDir("", "serviceinterface")
+		assert.Check(t, err, c.doc)
+		os.Setenv("SKUPPER_TMPDIR", tmpDir)
+		defer os.RemoveAll(tmpDir)
+
+		cli, dd := newFakeClient()
+		err = cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"})
+		assert.Check(t, err, c.doc)
+
+		dd.SetImageConfig("quay.io/skupper/echo", &dockercontainer.Config{ExposedPorts: c.imageExposed})
+		_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+			Name: "echo-server",
+			Config: &dockercontainer.Config{
+				Image:        "quay.io/skupper/echo",
+				ExposedPorts: c.exposed,
+				Labels:       c.labels,
+			},
+		})
+		assert.Check(t, err, c.doc)
+
+		service := &types.ServiceInterface{
+			Address:  "echo",
+			Protocol: "tcp",
+		}
+		err = cli.ServiceInterfaceBind(service, "container", "echo-server", "tcp", nil)
+		if c.expectedError != "" {
+			assert.Error(t, err, c.expectedError, c.doc)
+		} else {
+			assert.Check(t, err, c.doc)
+			si, err := cli.ServiceInterfaceInspect("echo")
+			assert.Check(t, err, c.doc)
+			assert.Assert(t, si != nil, c.doc)
+			assert.Equal(t, si.Port, c.expectedPort, c.doc)
+			assert.DeepEqual(t, si.Ports, c.expectedPorts)
+			assert.Equal(t, si.Targets[0].TargetPort, 0, c.doc)
+		}
+
+		errors := cli.RouterRemove()
+		assert.Assert(t, len(errors) == 0, c.doc)
+	}
+}
+
+func TestServiceInterfaceStats(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "serviceinterface")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	err = cli.RouterCreate(types.SiteConfigSpec{SkupperName: "skupper"})
+	assert.Assert(t, err)
+
+	services := []types.ServiceInterface{
+		{Address: "tcp-go-echo", Protocol: "tcp", Port: 9090},
+		{Address: "http-echo", Protocol: "http", Port: 8080},
+	}
+	for _, si := range services {
+		si := si
+		assert.Assert(t, cli.ServiceInterfaceCreate(&si))
+		proxy, err := docker.NewProxyContainer(si, "proxy-config", false, dd)
+		assert.Assert(t, err)
+		assert.Assert(t, docker.StartContainer(proxy.Name, dd))
+	}
+
+	entities := map[string]map[string]string{
+		types.TransportDeploymentName: {
+			"router.link": `[{"linkType": "endpoint", "owningAddr": "M0tcp-go-echo"}, {"linkType": "endpoint", "owningAddr": "Mhttp-echo"}, {"linkType": "router-control", "owningAddr": "M0tcp-go-echo"}]`,
+		},
+		"tcp-go-echo": {
+			"router.address":  `[{"name": "M0tcp-go-echo", "deliveriesIngress": 3, "deliveriesEgress": 2}, {"name": "M0unrelated", "deliveriesIngress": 7}]`,
+			"tcpConnection":   `[{"address": "tcp-go-echo", "direction": "in", "bytesIn": 10, "bytesOut": 20}, {"address": "tcp-go-echo", "direction": "out", "bytesIn": 5, "bytesOut": 5}]`,
+			"httpRequestInfo": `[]`,
+		},
+		"http-echo": {
+			"router.address":  `[{"name": "M0http-echo", "deliveriesIngress": 12}]`,
+			"httpRequestInfo": `[{"address": "http-echo", "requests": 12, "bytesIn": 100, "bytesOut": 400}]`,
+		},
+	}
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		if len(cmd) == 4 && cmd[0] == "qdmanage" && cmd[1] == "query" {
+			if out, ok := entities[container][cmd[3]]; ok {
+				return fake.ExecResult{Stdout: out}
+			}
+			// routers without tcp bridges do not know the entity type
+			if cmd[3] == "tcpConnection" {
+				return fake.ExecResult{Stderr: "NotFoundStatus: Unknown entity type 'tcpConnection'\n", ExitCode: 1}
+			}
+		}
+		return fake.ExecResult{Stdout: "[]"}
+	}
+
+	stats, err := cli.ServiceInterfaceStats()
+	assert.Assert(t, err)
+	assert.DeepEqual(t, stats, []types.ServiceInterfaceStats{
+		{
+			Address:  "http-echo",
+			Protocol: "http",
+			Requests: 12,
+			BytesIn:  100,
+			BytesOut: 400,
+			Links:    1,
+		},
+		{
+			Address:           "tcp-go-echo",
+			Protocol:          "tcp",
+			ActiveConnections: 2,
+			TotalConnections:  3,
+			BytesIn:           15,
+			BytesOut:          25,
+			Links:             1,
+		},
+	})
+}
@@ -5,11 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"sort"
+	"strconv"
 	"strings"
 
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+
 	"github.com/skupperproject/skupper-docker/api/types"
 	"github.com/skupperproject/skupper-docker/pkg/docker"
-	"github.com/skupperproject/skupper-docker/pkg/utils"
 )
 
 func addTargetToServiceInterface(service *types.ServiceInterface, target *types.ServiceInterfaceTarget) {
@@ -18,6 +22,10 @@ func addTargetToServiceInterface(service *types.ServiceInterface, target *types.
 	for _, t := range service.Targets {
 		if t.Name == target.Name {
 			modified = true
+			// a container bound again stays the same instance
+			if target.Instance == nil {
+				target.Instance = t.Instance
+			}
 			targets = append(targets, *target)
 		} else {
 			targets = append(targets, t)
@@ -29,22 +37,60 @@ func addTargetToServiceInterface(service *types.ServiceInterface, target *types.
 	service.Targets = targets
 }
 
-func getServiceInterfaceTarget(targetType string, targetName string, deducePort bool, cli *VanClient) (*types.ServiceInterfaceTarget, error) {
+// deduceTargetPorts picks the ports of a container from its skupper.io/port
+// label, which may list several, or else from the tcp ports exposed by the
+// container and its image, it returns none when there is nothing to go on
+func deduceTargetPorts(container *dockertypes.ContainerJSON, cli *VanClient) ([]int, error) {
+	name := strings.TrimPrefix(container.Name, "/")
+	if label, ok := container.Config.Labels[types.PortQualifier]; ok {
+		ports, ok := types.ParsePortLabel(label)
+		if !ok {
+			return nil, fmt.Errorf("Invalid %s label %q on container %s", types.PortQualifier, label, name)
+		}
+		return ports, nil
+	}
+
+	exposed := nat.PortSet{}
+	for p := range container.Config.ExposedPorts {
+		exposed[p] = struct{}{}
+	}
+	image, err := cli.DockerInterface.InspectImageByRef(container.Config.Image)
+	if err == nil && image.Config != nil {
+		for p := range image.Config.ExposedPorts {
+			exposed[p] = struct{}{}
+		}
+	}
+	candidates := []int{}
+	for p := range exposed {
+		if p.Proto() == "tcp" {
+			candidates = append(candidates, p.Int())
+		}
+	}
+	sort.Ints(candidates)
+
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return candidates, nil
+	default:
+		choices := []string{}
+		for _, p := range candidates {
+			choices = append(choices, strconv.Itoa(p))
+		}
+		return nil, fmt.Errorf("Container %s exposes ports %s, choose one with --port or --target-port", name, strings.Join(choices, ", "))
+	}
+}
+
+func getServiceInterfaceTarget(targetType string, targetName string, cli *VanClient) (*types.ServiceInterfaceTarget, error) {
 	// note: selector will indicate targetType
 	if targetType == "container" {
-		containerJSON, err := docker.InspectContainer(targetName, cli.DockerInterface)
+		_, err := docker.InspectContainer(targetName, cli.DockerInterface)
 		if err == nil {
 			target := types.ServiceInterfaceTarget{
 				Name:     targetName,
 				Selector: "internal.skupper.io/container",
 			}
-			if deducePort {
-				if len(containerJSON.Config.ExposedPorts) > 0 {
-					//TODO get port from config
-					// a map of nat port sets, how to choose a port?
-					target.TargetPort = 9090
-				}
-			}
 			return &target, nil
 		} else {
 			return nil, fmt.Errorf("Could not read container %s: %s", targetName, err)
@@ -54,7 +100,7 @@ func getServiceInterfaceTarget(targetType string, targetName string, deducePort
 		name := targetName
 		arr := strings.SplitN(name, ":", 2)
 		if len(arr) == 1 {
-			host := utils.GetInternalIP("docker0")
+			host := docker.HostGatewayAddress(cli.DockerInterface)
 			if host == "" {
 				host = "172.17.0.1"
 			}
@@ -66,6 +112,17 @@ func getServiceInterfaceTarget(targetType string, targetName string, deducePort
 		}
 		// TODO: is there any way to deduce a port for a host-service
 		return &target, nil
+	} else if targetType == "selector" {
+		// replicas are resolved by the controller as they come and go
+		_, err := docker.ParseLabelSelector(targetName)
+		if err != nil {
+			return nil, err
+		}
+		target := types.ServiceInterfaceTarget{
+			Name:     targetName,
+			Selector: targetName,
+		}
+		return &target, nil
 	} else {
 		return nil, fmt.Errorf("VAN service interface unsupported target type")
 	}
@@ -99,15 +156,47 @@ func updateServiceInterface(service *types.ServiceInterface, overwriteIfExists b
 	if err != nil {
 		return fmt.Errorf("Failed to write service interface file: %w", err)
 	}
-	return nil
+	return cli.saveState(types.ServicesPath)
+}
+
+func formatPorts(ports []int) string {
+	formatted := []string{}
+	for _, port := range ports {
+		formatted = append(formatted, strconv.Itoa(port))
+	}
+	return strings.Join(formatted, ",")
 }
 
 func validateServiceInterface(service *types.ServiceInterface) error {
+	ports := map[int]bool{}
+	for _, port := range service.GetPorts() {
+		if port < 0 || 65535 < port {
+			return fmt.Errorf("Port %d is outside valid range.", port)
+		}
+		if ports[port] {
+			return fmt.Errorf("Port %d is listed more than once.", port)
+		}
+		ports[port] = true
+	}
+	if len(service.Ports) > 0 && service.Ports[0] != service.Port {
+		return fmt.Errorf("Port %d must be the first of the service ports %s.", service.Port, formatPorts(service.Ports))
+	}
 
 	for _, target := range service.Targets {
+		if service.Headless != nil && target.Selector != "internal.skupper.io/container" {
+			return fmt.Errorf("Target %s of headless service %s must be a container.", target.Name, service.Address)
+		}
 		if target.TargetPort < 0 || 65535 < target.TargetPort {
 			return fmt.Errorf("Bad target port number. Target: %s  Port: %d", target.Name, target.TargetPort)
 		}
+		for port, targetPort := range target.TargetPorts {
+			if !ports[port] {
+				return fmt.Errorf("Target %s maps port %d which is not a port of the service.", target.Name, port)
+			}
+			if targetPort < 0 || 65535 < targetPort {
+				return fmt.Errorf("Bad target port number. Target: %s  Port: %d", target.Name, targetPort)
+			}
+		}
 	}
 
 	//TODO: change service.Protocol to service.Mapping
@@ -123,13 +212,15 @@ func validateServiceInterface(service *types.ServiceInterface) error {
 		return fmt.Errorf("The aggregate option is currently only valid for http")
 	} else if service.EventChannel && service.Protocol != "http" {
 		return fmt.Errorf("The event-channel option is currently only valid for http")
+	} else if service.Headless != nil && service.Protocol != "" && service.Protocol != "tcp" {
+		return fmt.Errorf("The headless option is currently only valid for tcp")
 	} else {
 		return nil
 	}
 }
 
 func (cli *VanClient) ServiceInterfaceUpdate(ctx context.Context, service *types.ServiceInterface) error {
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -146,8 +237,10 @@ func (cli *VanClient) ServiceInterfaceUpdate(ctx context.Context, service *types
 	return updateServiceInterface(service, true, cli)
 }
 
-func (cli *VanClient) ServiceInterfaceBind(service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error {
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+// ServiceInterfaceBind adds a target to the service, targetPorts are the
+// ports of the target matching each port of the service in order
+func (cli *VanClient) ServiceInterfaceBind(service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPorts []int) error {
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -159,18 +252,38 @@ func (cli *VanClient) ServiceInterfaceBind(service *types.ServiceInterface, targ
 	if protocol != "" && service.Protocol != protocol {
 		return fmt.Errorf("Invalid protocol %s for service with mapping %s", protocol, service.Protocol)
 	}
-	target, err := getServiceInterfaceTarget(targetType, targetName, service.Port == 0 && targetPort == 0, cli)
+	if service.Headless != nil && targetType != "container" {
+		return fmt.Errorf("Only containers can be bound to headless service %s", service.Address)
+	}
+	ports := service.GetPorts()
+	target, err := getServiceInterfaceTarget(targetType, targetName, cli)
 	if err != nil {
 		return err
 	}
-	if target.TargetPort != 0 {
-		service.Port = target.TargetPort
-		target.TargetPort = 0
-	} else if targetPort != 0 {
-		if service.Port == 0 {
-			service.Port = targetPort
+	if len(ports) == 0 && len(targetPorts) == 0 && targetType == "container" {
+		container, err := docker.InspectContainer(targetName, cli.DockerInterface)
+		if err != nil {
+			return fmt.Errorf("Could not read container %s: %s", targetName, err)
+		}
+		deduced, err := deduceTargetPorts(container, cli)
+		if err != nil {
+			return err
+		}
+		if len(deduced) > 0 {
+			service.SetPorts(deduced)
+		}
+	} else if len(targetPorts) > 0 {
+		if len(ports) == 0 {
+			service.SetPorts(targetPorts)
+		} else if len(targetPorts) != len(ports) {
+			return fmt.Errorf("%d target port(s) given for the %d port(s) of service %s", len(targetPorts), len(ports), service.Address)
+		} else if len(ports) == 1 {
+			target.TargetPort = targetPorts[0]
 		} else {
-			target.TargetPort = targetPort
+			target.TargetPorts = map[int]int{}
+			for i, port := range ports {
+				target.TargetPorts[port] = targetPorts[i]
+			}
 		}
 	}
 	if service.Port == 0 {
@@ -181,13 +294,14 @@ func (cli *VanClient) ServiceInterfaceBind(service *types.ServiceInterface, targ
 		}
 	}
 	addTargetToServiceInterface(service, target)
+	service.AssignInstances()
 	return updateServiceInterface(service, true, cli)
 }
 
 func removeServiceInterfaceTarget(serviceName string, targetName string, deleteIfNoTargets bool, cli *VanClient) error {
 	current := make(map[string]types.ServiceInterface)
 
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
@@ -217,7 +331,7 @@ func removeServiceInterfaceTarget(serviceName string, targetName string, deleteI
 			arr := strings.SplitN(name, ":", 2)
 			if len(arr) == 1 {
 				// magic address
-				host := utils.GetInternalIP("docker0")
+				host := docker.HostGatewayAddress(cli.DockerInterface)
 				if host == "" {
 					host = "172.17.0.1"
 				}
@@ -237,6 +351,9 @@ func removeServiceInterfaceTarget(serviceName string, targetName string, deleteI
 		delete(current, serviceName)
 	} else {
 		service.Targets = targets
+		// the remaining containers keep their instances, the size shrinks only
+		// when the highest ones go
+		service.AssignInstances()
 		current[serviceName] = service
 	}
 
@@ -249,16 +366,16 @@ func removeServiceInterfaceTarget(serviceName string, targetName string, deleteI
 	if err != nil {
 		return fmt.Errorf("Failed to write service interface file: %w", err)
 	}
-	return nil
+	return cli.saveState(types.ServicesPath)
 }
 
 func (cli *VanClient) ServiceInterfaceUnbind(targetType string, targetName string, address string, deleteIfNoTargets bool) error {
-	_, err := docker.InspectContainer("skupper-router", cli.DockerInterface)
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
 	}
 
-	if targetType == "container" || targetType == "host-service" {
+	if targetType == "container" || targetType == "host-service" || targetType == "selector" {
 		err := removeServiceInterfaceTarget(address, targetName, deleteIfNoTargets, cli)
 		return err
 	} else {
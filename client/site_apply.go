@@ -0,0 +1,459 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+	"github.com/skupperproject/skupper/pkg/certs"
+)
+
+const (
+	ManifestKindSite       = "site"
+	ManifestKindService    = "service"
+	ManifestKindConnection = "connection"
+
+	ManifestActionCreate = "create"
+	ManifestActionUpdate = "update"
+	ManifestActionDelete = "delete"
+)
+
+// resolveServiceInterfaceTargets accepts either the target type (container,
+// host-service, selector), the internal selector or a label selector for each
+// target of a manifest service
+func resolveServiceInterfaceTargets(service *types.ServiceInterface, cli *VanClient) error {
+	targets := []types.ServiceInterfaceTarget{}
+	for _, t := range service.Targets {
+		var targetType string
+		name := t.Name
+		switch t.Selector {
+		case "container", "internal.skupper.io/container":
+			targetType = "container"
+		case "host-service", "internal.skupper.io/host-service":
+			targetType = "host-service"
+		case "selector":
+			targetType = "selector"
+		default:
+			if !types.IsLabelSelector(t.Selector) {
+				return fmt.Errorf("Unsupported selector %s for target %s of service %s", t.Selector, t.Name, service.Address)
+			}
+			targetType = "selector"
+			name = t.Selector
+		}
+		target, err := getServiceInterfaceTarget(targetType, name, cli)
+		if err != nil {
+			return err
+		}
+		target.TargetPort = t.TargetPort
+		target.TargetPorts = t.TargetPorts
+		targets = append(targets, *target)
+	}
+	service.Targets = targets
+	return nil
+}
+
+func targetKeys(service *types.ServiceInterface) []string {
+	keys := []string{}
+	for _, t := range service.Targets {
+		keys = append(keys, fmt.Sprintf("%s|%s|%d|%v", t.Selector, t.Name, t.TargetPort, t.TargetPorts))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeys(services map[string]types.ServiceInterface) []string {
+	keys := []string{}
+	for k := range services {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equivalentServiceInterface(a *types.ServiceInterface, b *types.ServiceInterface) bool {
+	if a.Protocol != b.Protocol || a.Port != b.Port || a.EventChannel != b.EventChannel || a.Aggregate != b.Aggregate || a.Origin != b.Origin {
+		return false
+	}
+	if !reflect.DeepEqual(a.GetPorts(), b.GetPorts()) {
+		return false
+	}
+	if !reflect.DeepEqual(a.Headless, b.Headless) {
+		return false
+	}
+	return reflect.DeepEqual(targetKeys(a), targetKeys(b))
+}
+
+// siteConfigDifferences lists the site options, by their manifest names, that
+// differ from the current ones. The console user is ignored when the manifest
+// leaves it to be generated, as is the console password, which is managed with
+// console-user once the site exists.
+func siteConfigDifferences(current types.SiteConfigSpec, desired types.SiteConfigSpec) ([]string, error) {
+	if desired.User == "" {
+		desired.User = current.User
+	}
+	desired.Password = current.Password
+	if desired.AuthMode == "" {
+		desired.AuthMode = current.AuthMode
+	}
+	if desired.Storage == "" {
+		desired.Storage = current.Storage
+	}
+	currentOptions, err := siteOptions(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredOptions, err := siteOptions(desired)
+	if err != nil {
+		return nil, err
+	}
+	differences := []string{}
+	for name := range currentOptions {
+		if _, ok := desiredOptions[name]; !ok {
+			differences = append(differences, name)
+		}
+	}
+	for name, value := range desiredOptions {
+		if !reflect.DeepEqual(currentOptions[name], value) {
+			differences = append(differences, name)
+		}
+	}
+	sort.Strings(differences)
+	return differences, nil
+}
+
+func siteOptions(spec types.SiteConfigSpec) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	options := map[string]interface{}{}
+	err = json.Unmarshal(encoded, &options)
+	return options, err
+}
+
+// connectionTokenDiffers compares the content of a token with what was stored
+// for the connection when it was created
+func connectionTokenDiffers(name string, tokenFile string) (bool, error) {
+	secret, err := certs.GetSecretContent(tokenFile)
+	if err != nil {
+		return false, fmt.Errorf("Failed to read token for connection %s: %w", name, err)
+	}
+	connPath := filepath.Join(types.GetSkupperPath(types.ConnectionsPath), name)
+	for k, v := range secret {
+		file := k
+		if k == types.TokenGeneratedBy {
+			file = "generated-by"
+		}
+		stored, err := ioutil.ReadFile(filepath.Join(connPath, file))
+		if err != nil || !bytes.Equal(stored, v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// markApplied records that a planned change was made
+func markApplied(changes []types.SiteManifestChange, kind string, name string) {
+	for i := range changes {
+		if changes[i].Kind == kind && changes[i].Name == name {
+			changes[i].Applied = true
+		}
+	}
+}
+
+func (cli *VanClient) planServices(manifest *types.SiteManifest, options types.SiteManifestApplyOptions, siteExists bool) ([]types.SiteManifestChange, []types.ServiceInterface, []string, error) {
+	changes := []types.SiteManifestChange{}
+	changed := []types.ServiceInterface{}
+	deleted := []string{}
+
+	current := map[string]types.ServiceInterface{}
+	if siteExists {
+		vsis, err := cli.ServiceInterfaceList()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to retrieve service interfaces: %w", err)
+		}
+		for _, si := range vsis {
+			si.Alias = ""
+			current[si.Address] = si
+		}
+	}
+
+	desired := map[string]bool{}
+	for _, si := range manifest.Services {
+		service := si
+		if service.Address == "" {
+			return nil, nil, nil, fmt.Errorf("Service address must be specified in manifest")
+		}
+		if desired[service.Address] {
+			return nil, nil, nil, fmt.Errorf("Service %s is declared more than once in manifest", service.Address)
+		}
+		desired[service.Address] = true
+		if service.Protocol == "" {
+			service.Protocol = "tcp"
+		}
+		service.Origin = ""
+		service.Alias = ""
+		if len(service.Ports) > 0 {
+			service.SetPorts(service.Ports)
+		}
+		if service.Port == 0 {
+			return nil, nil, nil, fmt.Errorf("Service %s must specify a port", service.Address)
+		}
+		if err := validateServiceInterface(&service); err != nil {
+			return nil, nil, nil, err
+		}
+		if siteExists {
+			if err := resolveServiceInterfaceTargets(&service, cli); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		existing, ok := current[service.Address]
+		if !ok {
+			changes = append(changes, types.SiteManifestChange{
+				Kind:   ManifestKindService,
+				Name:   service.Address,
+				Action: ManifestActionCreate,
+				Detail: fmt.Sprintf("%s port %s with %d target(s)", service.Protocol, formatPorts(service.GetPorts()), len(service.Targets)),
+			})
+			changed = append(changed, service)
+		} else if !equivalentServiceInterface(&existing, &service) {
+			detail := fmt.Sprintf("%s port %s with %d target(s)", service.Protocol, formatPorts(service.GetPorts()), len(service.Targets))
+			if existing.Origin != "" {
+				detail = detail + ", replacing definition from " + existing.Origin
+			}
+			changes = append(changes, types.SiteManifestChange{
+				Kind:   ManifestKindService,
+				Name:   service.Address,
+				Action: ManifestActionUpdate,
+				Detail: detail,
+			})
+			changed = append(changed, service)
+		}
+	}
+
+	if options.Prune {
+		for _, name := range sortedKeys(current) {
+			// only prune what this site defines, imported services belong to their origin
+			if !desired[name] && current[name].Origin == "" {
+				changes = append(changes, types.SiteManifestChange{
+					Kind:   ManifestKindService,
+					Name:   name,
+					Action: ManifestActionDelete,
+				})
+				deleted = append(deleted, name)
+			}
+		}
+	}
+	return changes, changed, deleted, nil
+}
+
+func (cli *VanClient) planConnections(manifest *types.SiteManifest, options types.SiteManifestApplyOptions, siteExists bool) ([]types.SiteManifestChange, []types.ConnectionManifest, []string, error) {
+	changes := []types.SiteManifestChange{}
+	created := []types.ConnectionManifest{}
+	deleted := []string{}
+
+	current := map[string]qdr.Connector{}
+	if siteExists {
+		config, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to retrieve router config: %w", err)
+		}
+		connectors, err := cli.ConnectorList()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, c := range connectors {
+			current[c.Name] = config.Connectors[c.Name]
+		}
+	}
+
+	desired := map[string]bool{}
+	for _, conn := range manifest.Connections {
+		if conn.Name == "" || conn.Token == "" {
+			return nil, nil, nil, fmt.Errorf("Connections in manifest must specify a name and a token")
+		}
+		if desired[conn.Name] {
+			return nil, nil, nil, fmt.Errorf("Connection %s is declared more than once in manifest", conn.Name)
+		}
+		desired[conn.Name] = true
+		if conn.Cost == 0 {
+			conn.Cost = 1
+		}
+		existing, ok := current[conn.Name]
+		if !ok {
+			changes = append(changes, types.SiteManifestChange{
+				Kind:   ManifestKindConnection,
+				Name:   conn.Name,
+				Action: ManifestActionCreate,
+				Detail: "using token " + conn.Token,
+			})
+			created = append(created, conn)
+			continue
+		}
+		details := []string{}
+		tokenDiffers, err := connectionTokenDiffers(conn.Name, conn.Token)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if tokenDiffers {
+			details = append(details, "using token "+conn.Token)
+		}
+		if existing.Cost != conn.Cost {
+			details = append(details, fmt.Sprintf("cost %d -> %d", existing.Cost, conn.Cost))
+		}
+		if len(details) > 0 {
+			changes = append(changes, types.SiteManifestChange{
+				Kind:   ManifestKindConnection,
+				Name:   conn.Name,
+				Action: ManifestActionUpdate,
+				Detail: strings.Join(details, ", "),
+			})
+			deleted = append(deleted, conn.Name)
+			created = append(created, conn)
+		}
+	}
+
+	if options.Prune {
+		names := []string{}
+		for name := range current {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !desired[name] {
+				changes = append(changes, types.SiteManifestChange{
+					Kind:   ManifestKindConnection,
+					Name:   name,
+					Action: ManifestActionDelete,
+				})
+				deleted = append(deleted, name)
+			}
+		}
+	}
+	return changes, created, deleted, nil
+}
+
+// SiteManifestApply reconciles the running site against the manifest, creating
+// what is missing, updating what differs and optionally pruning what is not
+// listed. With DryRun set only the planned changes are returned, otherwise each
+// change is marked applied once made, so that after a failure the changes tell
+// what was done. Site options cannot be changed on an existing site, a manifest
+// that changes them is rejected before anything is applied.
+func (cli *VanClient) SiteManifestApply(manifest *types.SiteManifest, options types.SiteManifestApplyOptions) ([]types.SiteManifestChange, error) {
+	changes := []types.SiteManifestChange{}
+
+	siteExists := true
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	if err != nil {
+		siteExists = false
+	} else if _, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface); err != nil {
+		return nil, fmt.Errorf("Site config found but transport container is not available: %w", err)
+	}
+
+	var siteSpec types.SiteConfigSpec
+	if manifest.Site != nil {
+		siteSpec = *manifest.Site
+	}
+	if !siteExists {
+		changes = append(changes, types.SiteManifestChange{
+			Kind:   ManifestKindSite,
+			Name:   types.DefaultBridgeName,
+			Action: ManifestActionCreate,
+		})
+	}
+	var siteDifferences []string
+	if siteExists && manifest.Site != nil {
+		siteDifferences, err = siteConfigDifferences(sc.Spec, siteSpec)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compare site options: %w", err)
+		}
+	}
+	if len(siteDifferences) > 0 {
+		// site options are baked into the router and controller containers and
+		// can only be changed by re-creating the site
+		changes = append(changes, types.SiteManifestChange{
+			Kind:   ManifestKindSite,
+			Name:   types.DefaultBridgeName,
+			Action: ManifestActionUpdate,
+			Detail: "changes " + strings.Join(siteDifferences, ", "),
+		})
+	}
+
+	svcChanges, changedServices, deletedServices, err := cli.planServices(manifest, options, siteExists)
+	if err != nil {
+		return nil, err
+	}
+	connChanges, createdConns, deletedConns, err := cli.planConnections(manifest, options, siteExists)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, svcChanges...)
+	changes = append(changes, connChanges...)
+
+	if options.DryRun {
+		return changes, nil
+	}
+	if len(siteDifferences) > 0 {
+		return changes, fmt.Errorf("Site options %s differ from the manifest, changing them requires deleting and re-creating the site", strings.Join(siteDifferences, ", "))
+	}
+
+	if !siteExists {
+		if err := cli.RouterCreate(siteSpec); err != nil {
+			return changes, fmt.Errorf("Failed to create site: %w", err)
+		}
+		markApplied(changes, ManifestKindSite, types.DefaultBridgeName)
+	}
+
+	for _, name := range deletedServices {
+		if err := cli.ServiceInterfaceRemove(name); err != nil {
+			return changes, fmt.Errorf("Failed to delete service %s: %w", name, err)
+		}
+		markApplied(changes, ManifestKindService, name)
+	}
+	for _, si := range changedServices {
+		service := si
+		if !siteExists {
+			if err := resolveServiceInterfaceTargets(&service, cli); err != nil {
+				return changes, err
+			}
+		}
+		if err := updateServiceInterface(&service, true, cli); err != nil {
+			return changes, fmt.Errorf("Failed to apply service %s: %w", service.Address, err)
+		}
+		markApplied(changes, ManifestKindService, service.Address)
+	}
+
+	// an updated connection is only applied once re-created
+	recreated := map[string]bool{}
+	for _, conn := range createdConns {
+		recreated[conn.Name] = true
+	}
+	for _, name := range deletedConns {
+		if err := cli.ConnectorRemove(name); err != nil {
+			return changes, fmt.Errorf("Failed to remove connection %s: %w", name, err)
+		}
+		if !recreated[name] {
+			markApplied(changes, ManifestKindConnection, name)
+		}
+	}
+	for _, conn := range createdConns {
+		_, err := cli.ConnectorCreate(conn.Token, types.ConnectorCreateOptions{
+			Name: conn.Name,
+			Cost: conn.Cost,
+		})
+		if err != nil {
+			return changes, fmt.Errorf("Failed to create connection %s: %w", conn.Name, err)
+		}
+		markApplied(changes, ManifestKindConnection, conn.Name)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+func TestSiteManifestApply(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "siteapply")
+	assert.Assert(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+	_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name: "tcp-go-echo-server",
+		Config: &dockercontainer.Config{
+			Image: "quay.io/skupper/tcp-go-echo",
+		},
+	})
+	assert.Assert(t, err)
+
+	// tokens of another site to connect to
+	assert.Assert(t, cli.RouterCreate(types.SiteConfigSpec{SkupperName: "site-b"}))
+	assert.Assert(t, cli.ConnectorTokenCreate("site-b", tmpDir+"/token-1.yaml"))
+	assert.Assert(t, cli.ConnectorTokenCreate("site-b", tmpDir+"/token-2.yaml"))
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+
+	manifest := &types.SiteManifest{
+		Site: &types.SiteConfigSpec{SkupperName: "skupper"},
+		Services: []types.ServiceInterface{
+			{
+				Address:  "tcp-go-echo",
+				Protocol: "tcp",
+				Port:     9090,
+				Targets: []types.ServiceInterfaceTarget{
+					{Name: "tcp-go-echo-server", Selector: "container"},
+				},
+			},
+			{
+				Address: "db",
+				Port:    5432,
+				Targets: []types.ServiceInterfaceTarget{
+					{Name: "db:10.0.0.1", Selector: "host-service"},
+				},
+			},
+		},
+	}
+
+	manifest.Connections = []types.ConnectionManifest{
+		{Name: "site-b", Token: tmpDir + "/token-1.yaml"},
+	}
+
+	changes, err := cli.SiteManifestApply(manifest, types.SiteManifestApplyOptions{DryRun: true})
+	assert.Assert(t, err)
+	assert.Equal(t, len(changes), 4)
+	assert.Equal(t, changes[0].Kind, ManifestKindSite)
+	assert.Equal(t, changes[0].Action, ManifestActionCreate)
+	for _, c := range changes {
+		assert.Assert(t, !c.Applied, "dry run must not apply %s %s", c.Kind, c.Name)
+	}
+	_, err = dd.InspectContainer(types.TransportDeploymentName)
+	assert.Assert(t, err != nil, "dry run must not create the site")
+
+	changes, err = cli.SiteManifestApply(manifest, types.SiteManifestApplyOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, len(changes), 4)
+	for _, c := range changes {
+		assert.Assert(t, c.Applied, "%s %s should be applied", c.Kind, c.Name)
+	}
+	si, err := cli.ServiceInterfaceInspect("tcp-go-echo")
+	assert.Assert(t, err)
+	assert.Assert(t, si != nil)
+	assert.Equal(t, len(si.Targets), 1)
+	si, err = cli.ServiceInterfaceInspect("db")
+	assert.Assert(t, err)
+	assert.Assert(t, si != nil)
+	assert.Equal(t, si.Protocol, "tcp")
+
+	changes, err = cli.SiteManifestApply(manifest, types.SiteManifestApplyOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, len(changes), 0, "re-applying the same manifest should be a no-op")
+
+	// a new token for the same connection re-creates it
+	manifest.Connections[0].Token = tmpDir + "/token-2.yaml"
+	changes, err = cli.SiteManifestApply(manifest, types.SiteManifestApplyOptions{})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, changes, []types.SiteManifestChange{
+		{
+			Kind:    ManifestKindConnection,
+			Name:    "site-b",
+			Action:  ManifestActionUpdate,
+			Detail:  "using token " + tmpDir + "/token-2.yaml",
+			Applied: true,
+		},
+	})
+
+	// site options cannot be changed, nothing is applied
+	manifest.Site.IsEdge = true
+	manifest.Services = manifest.Services[:1]
+	manifest.Services[0].Port = 9091
+	changes, err = cli.SiteManifestApply(manifest, types.SiteManifestApplyOptions{Prune: true})
+	assert.ErrorContains(t, err, "Site options isEdge differ from the manifest")
+	assert.DeepEqual(t, changes, []types.SiteManifestChange{
+		{
+			Kind:   ManifestKindSite,
+			Name:   types.DefaultBridgeName,
+			Action: ManifestActionUpdate,
+			Detail: "changes isEdge",
+		},
+		{
+			Kind:   ManifestKindService,
+			Name:   "tcp-go-echo",
+			Action: ManifestActionUpdate,
+			Detail: "tcp port 9091 with 1 target(s)",
+		},
+		{
+			Kind:   ManifestKindService,
+			Name:   "db",
+			Action: ManifestActionDelete,
+		},
+	})
+	si, err = cli.ServiceInterfaceInspect("db")
+	assert.Assert(t, err)
+	assert.Assert(t, si != nil)
+
+	manifest.Site.IsEdge = false
+	changes, err = cli.SiteManifestApply(manifest, types.SiteManifestApplyOptions{Prune: true})
+	assert.Assert(t, err)
+	assert.Equal(t, len(changes), 2)
+	si, err = cli.ServiceInterfaceInspect("db")
+	assert.Assert(t, err)
+	assert.Assert(t, si == nil)
+	si, err = cli.ServiceInterfaceInspect("tcp-go-echo")
+	assert.Assert(t, err)
+	assert.Equal(t, si.Port, 9091)
+
+	// a failure part way tells what was applied
+	manifest.Services[0].Port = 9092
+	manifest.Connections = append(manifest.Connections, types.ConnectionManifest{Name: "missing", Token: tmpDir + "/missing.yaml"})
+	changes, err = cli.SiteManifestApply(manifest, types.SiteManifestApplyOptions{})
+	assert.ErrorContains(t, err, "Failed to create connection missing")
+	assert.Equal(t, len(changes), 2)
+	assert.Equal(t, changes[0].Name, "tcp-go-echo")
+	assert.Assert(t, changes[0].Applied)
+	assert.Equal(t, changes[1].Name, "missing")
+	assert.Assert(t, !changes[1].Applied)
+
+	errors = cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+func TestSitesSharingDaemon(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sites")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.Unsetenv("SKUPPER_SITE")
+
+	cli, dd := newFakeClient()
+	for _, site := range []string{"east", "west"} {
+		os.Setenv("SKUPPER_SITE", site)
+		err = cli.RouterCreate(types.SiteConfigSpec{
+			EnableController: true,
+		})
+		assert.Check(t, err, site)
+	}
+
+	for _, site := range []string{"east", "west"} {
+		_, err = dd.InspectContainer(site + "-skupper-router")
+		assert.Check(t, err, site)
+		_, err = dd.InspectContainer(site + "-skupper-service-controller")
+		assert.Check(t, err, site)
+		network, err := dd.InspectNetwork(site + "-skupper-network")
+		assert.Check(t, err, site)
+		assert.Equal(t, len(network.Containers), 2, site)
+		_, err = os.Stat(tmpDir + "/" + site + "-skupper/config/qdrouterd.json")
+		assert.Check(t, err, site)
+	}
+
+	// west connects to east through the network of east
+	os.Setenv("SKUPPER_SITE", "east")
+	err = cli.ConnectorTokenCreate("west", tmpDir+"/west.yaml")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_SITE", "west")
+	name, err := cli.ConnectorCreate(tmpDir+"/west.yaml", types.ConnectorCreateOptions{})
+	assert.Check(t, err)
+	assert.Equal(t, name, "conn1")
+	west, err := dd.InspectContainer("west-skupper-router")
+	assert.Check(t, err)
+	east, err := dd.InspectNetwork("east-skupper-network")
+	assert.Check(t, err)
+	_, ok := east.Containers[west.ID]
+	assert.Assert(t, ok)
+
+	// removing a site leaves the other one alone
+	os.Setenv("SKUPPER_SITE", "east")
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+	_, err = dd.InspectContainer("east-skupper-router")
+	assert.Assert(t, err != nil)
+	os.Setenv("SKUPPER_SITE", "west")
+	_, err = cli.RouterInspect()
+	assert.Check(t, err)
+	errors = cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+}
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+)
+
+const redacted = "REDACTED"
+
+type dumpManifest struct {
+	Timestamp         string `json:"timestamp"`
+	ClientVersion     string `json:"clientVersion"`
+	TransportVersion  string `json:"transportVersion,omitempty"`
+	ControllerVersion string `json:"controllerVersion,omitempty"`
+	DockerVersion     string `json:"dockerVersion,omitempty"`
+	DockerAPIVersion  string `json:"dockerApiVersion,omitempty"`
+	DockerOs          string `json:"dockerOs,omitempty"`
+	DockerArch        string `json:"dockerArch,omitempty"`
+	KernelVersion     string `json:"kernelVersion,omitempty"`
+	ClientOs          string `json:"clientOs"`
+	ClientArch        string `json:"clientArch"`
+	SkupperTmpDir     string `json:"skupperTmpDir"`
+}
+
+func writeTar(name string, data []byte, ts time.Time, tw *tar.Writer) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: ts,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// redactFile replaces the content of anything that holds a secret so it can be
+// included in a support bundle
+func redactFile(path string, data []byte) []byte {
+	if strings.HasSuffix(path, ".key") || strings.HasPrefix(path, types.GetSkupperPath(types.ConsoleUsersPath)) {
+		return []byte(redacted)
+	}
+	return data
+}
+
+func redactSiteConfig(data []byte) ([]byte, error) {
+	sc := types.SiteConfig{}
+	err := json.Unmarshal(data, &sc)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Spec.Password != "" {
+		sc.Spec.Password = redacted
+	}
+	return json.MarshalIndent(sc, "", "    ")
+}
+
+// redactContainer returns a copy of the container details with the values of
+// its environment, which may carry credentials, hidden
+func redactContainer(container *dockertypes.ContainerJSON) *dockertypes.ContainerJSON {
+	copied := *container
+	if container.Config != nil {
+		config := *container.Config
+		config.Env = []string{}
+		for _, v := range container.Config.Env {
+			config.Env = append(config.Env, strings.SplitN(v, "=", 2)[0]+"="+redacted)
+		}
+		copied.Config = &config
+	}
+	return &copied
+}
+
+func getContainerLogs(name string, dd libdocker.Interface) ([]byte, error) {
+	var buf bytes.Buffer
+	err := dd.Logs(name, dockertypes.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+	}, libdocker.StreamOptions{
+		OutputStream: &buf,
+		ErrorStream:  &buf,
+	})
+	return buf.Bytes(), err
+}
+
+func (cli *VanClient) getDumpManifest(version string) dumpManifest {
+	manifest := dumpManifest{
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		ClientVersion: version,
+		ClientOs:      runtime.GOOS,
+		ClientArch:    runtime.GOARCH,
+		SkupperTmpDir: os.Getenv("SKUPPER_TMPDIR"),
+	}
+	if dv, err := cli.DockerInterface.Version(); err == nil {
+		manifest.DockerVersion = dv.Version
+		manifest.DockerAPIVersion = dv.APIVersion
+		manifest.DockerOs = dv.Os
+		manifest.DockerArch = dv.Arch
+		manifest.KernelVersion = dv.KernelVersion
+	}
+	if transport, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface); err == nil {
+		manifest.TransportVersion, _ = docker.GetImageVersion(transport.Config.Image, cli.DockerInterface)
+	}
+	if controller, err := docker.InspectContainer(types.GetControllerDeploymentName(), cli.DockerInterface); err == nil {
+		manifest.ControllerVersion, _ = docker.GetImageVersion(controller.Config.Image, cli.DockerInterface)
+	}
+	return manifest
+}
+
+// SkupperDump collects the site configuration, component logs and router
+// management state into a single compressed archive
+func (cli *VanClient) SkupperDump(tarName string, version string) (string, error) {
+	_, err := docker.InspectContainer(types.GetTransportDeploymentName(), cli.DockerInterface)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve transport container (need init?): %w", err)
+	}
+
+	if !strings.HasSuffix(tarName, ".tar.gz") {
+		tarName = tarName + ".tar.gz"
+	}
+	tarFile, err := os.Create(tarName)
+	if err != nil {
+		return "", fmt.Errorf("Unable to save skupper dump details: %w", err)
+	}
+	defer tarFile.Close()
+
+	gz := gzip.NewWriter(tarFile)
+	tw := tar.NewWriter(gz)
+	err = cli.writeDump(version, tw)
+	if err != nil {
+		return "", err
+	}
+	// the archive is only complete once the trailers are flushed
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("Unable to save skupper dump details: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("Unable to save skupper dump details: %w", err)
+	}
+	if err := tarFile.Close(); err != nil {
+		return "", fmt.Errorf("Unable to save skupper dump details: %w", err)
+	}
+	return tarName, nil
+}
+
+// writeDump writes the entries of the support bundle to tw
+func (cli *VanClient) writeDump(version string, tw *tar.Writer) error {
+	ts := time.Now()
+
+	manifest, err := json.MarshalIndent(cli.getDumpManifest(version), "", "    ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode dump manifest: %w", err)
+	}
+	if err := writeTar("manifest.json", manifest, ts, tw); err != nil {
+		return err
+	}
+
+	// host side state, with private keys and passwords redacted
+	hostPath := types.GetSkupperPath(types.HostPath)
+	siteConfig := filepath.Join(types.GetSkupperPath(types.SitesPath), types.DefaultBridgeName+".json")
+	err = filepath.Walk(hostPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if path == siteConfig {
+			data, err = redactSiteConfig(data)
+			if err != nil {
+				return fmt.Errorf("Failed to redact site config: %w", err)
+			}
+		} else {
+			data = redactFile(path, data)
+		}
+		rel, _ := filepath.Rel(hostPath, path)
+		return writeTar(filepath.ToSlash(filepath.Join("skupper", rel)), data, info.ModTime(), tw)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to collect skupper files: %w", err)
+	}
+
+	// component and proxy logs
+	containers := []string{types.GetTransportDeploymentName(), types.GetControllerDeploymentName()}
+	filters := dockerfilters.NewArgs()
+	filters.Add("label", "skupper.io/component=proxy")
+	proxies, err := docker.ListSiteContainers(dockertypes.ContainerListOptions{
+		Filters: filters,
+		All:     true,
+	}, cli.DockerInterface)
+	if err == nil {
+		for _, proxy := range proxies {
+			containers = append(containers, strings.TrimPrefix(proxy.Names[0], "/"))
+		}
+	}
+	for _, name := range containers {
+		logs, err := getContainerLogs(name, cli.DockerInterface)
+		if err != nil {
+			logs = []byte(fmt.Sprintf("Failed to retrieve logs: %s\n", err))
+		}
+		if err := writeTar("logs/"+name+".txt", logs, ts, tw); err != nil {
+			return err
+		}
+		current, err := docker.InspectContainer(name, cli.DockerInterface)
+		if err == nil {
+			encoded, _ := json.MarshalIndent(redactContainer(current), "", "    ")
+			if err := writeTar("containers/"+name+".json", encoded, ts, tw); err != nil {
+				return err
+			}
+		}
+	}
+
+	// router management state
+	for _, entity := range []string{"node", "connection", "router.link", "address", "tcpConnector", "tcpListener", "httpConnector", "httpListener"} {
+		result, err := qdr.QueryEntities(entity, cli.DockerInterface)
+		if err != nil {
+			result = []byte(fmt.Sprintf("Failed to query %s: %s\n", entity, err))
+		}
+		if err := writeTar("qdmanage/"+entity+".json", result, ts, tw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
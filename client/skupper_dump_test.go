@@ -0,0 +1,93 @@
+package client
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+)
+
+func TestSkupperDump(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "dump")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newFakeClient()
+
+	_, err = cli.SkupperDump(tmpDir+"/no-site", "test")
+	assert.Assert(t, err != nil, "dump should fail without a site")
+
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:   "skupper",
+		EnableConsole: true,
+		AuthMode:      "internal",
+		User:          "admin",
+		Password:      "secret-password",
+	})
+	assert.Check(t, err)
+	dd.SetLogs(types.TransportDeploymentName, "router log line\n")
+
+	tarName, err := cli.SkupperDump(tmpDir+"/dump", "test")
+	assert.Check(t, err)
+	assert.Equal(t, tarName, tmpDir+"/dump.tar.gz")
+
+	f, err := os.Open(tarName)
+	assert.Check(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.Check(t, err)
+	tr := tar.NewReader(gz)
+
+	contents := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, err := ioutil.ReadAll(tr)
+		assert.Check(t, err)
+		contents[hdr.Name] = string(data)
+	}
+
+	for _, name := range []string{
+		"manifest.json",
+		"skupper/config/qdrouterd.json",
+		"skupper/services/skupper-services",
+		"skupper/sites/skupper0.json",
+		"logs/skupper-router.txt",
+		"logs/skupper-service-controller.txt",
+		"qdmanage/node.json",
+		"qdmanage/connection.json",
+		"qdmanage/router.link.json",
+	} {
+		_, ok := contents[name]
+		assert.Assert(t, ok, "missing %s", name)
+	}
+	assert.Equal(t, contents["logs/skupper-router.txt"], "router log line\n")
+	assert.Assert(t, strings.Contains(contents["manifest.json"], `"clientVersion": "test"`))
+	for name, data := range contents {
+		assert.Assert(t, !strings.Contains(data, "secret-password"), "password leaked in %s", name)
+		assert.Assert(t, !strings.Contains(data, "PRIVATE KEY"), "private key leaked in %s", name)
+		if strings.HasSuffix(name, ".key") {
+			assert.Equal(t, data, redacted, name)
+		}
+	}
+	_, ok := contents["skupper/qpid-dispatch-certs/skupper-ca/tls.key"]
+	assert.Assert(t, ok, "redacted key entry should be present")
+	controller := contents["containers/skupper-service-controller.json"]
+	assert.Assert(t, strings.Contains(controller, "SKUPPER_CONSOLE_AUTH="+redacted), controller)
+	assert.Assert(t, !strings.Contains(controller, "SKUPPER_CONSOLE_AUTH=internal"), controller)
+
+	// the containers themselves keep their environment
+	current, err := dd.InspectContainer(types.ControllerDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, docker.FindEnvVar(current.Config.Env, "SKUPPER_CONSOLE_AUTH"), "internal")
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+)
+
+var unsafeHostChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// useStateVolumes switches to volume storage when the site keeps its state
+// in volumes, or when the daemon does not share the filesystem of the
+// client. Each remote daemon gets a working copy of its own, so that sites
+// on several hosts can be managed from one workstation.
+func useStateVolumes(dd libdocker.Interface) error {
+	if os.Getenv("SKUPPER_STORAGE") != "" {
+		return nil
+	}
+	runtime := dd.RuntimeInfo()
+	if !runtime.Remote {
+		if docker.StateVolumesExist(dd) {
+			os.Setenv("SKUPPER_STORAGE", types.StorageVolume)
+		}
+		return nil
+	}
+	os.Setenv("SKUPPER_STORAGE", types.StorageVolume)
+	base := os.Getenv("SKUPPER_TMPDIR")
+	if base == "" {
+		base = os.TempDir()
+	}
+	dir := filepath.Join(base, "skupper-remote", unsafeHostChars.ReplaceAllString(runtime.Host, "_"))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Unable to create working copy of site state: %w", err)
+	}
+	os.Setenv("SKUPPER_TMPDIR", dir)
+	return nil
+}
+
+// selectStorage applies the storage mode requested for a new site, the
+// current mode is kept when none is requested
+func selectStorage(storage string, runtime libdocker.RuntimeInfo) error {
+	switch storage {
+	case "":
+		return nil
+	case types.StorageHost:
+		if runtime.Remote {
+			return fmt.Errorf("Host storage needs a daemon on this host, %s is remote", runtime.Host)
+		}
+	case types.StorageVolume:
+	default:
+		return fmt.Errorf("Storage must be one of: [%s, %s]", types.StorageHost, types.StorageVolume)
+	}
+	os.Setenv("SKUPPER_STORAGE", storage)
+	return nil
+}
+
+// loadState refreshes the working copy of the site state from its volumes
+func (cli *VanClient) loadState() error {
+	if types.GetSkupperStorage() != types.StorageVolume || !docker.StateVolumesExist(cli.DockerInterface) {
+		return nil
+	}
+	if err := docker.CopyStateFromVolumes(types.StatePaths, cli.DockerInterface); err != nil {
+		return fmt.Errorf("Failed to load site state: %w", err)
+	}
+	return nil
+}
+
+// saveState copies the given areas of the working copy to their volumes, it
+// must be called before the containers are expected to see a change
+func (cli *VanClient) saveState(paths ...types.Path) error {
+	if types.GetSkupperStorage() != types.StorageVolume {
+		return nil
+	}
+	if err := docker.CopyStateToVolumes(paths, cli.DockerInterface); err != nil {
+		return fmt.Errorf("Failed to save site state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	dockermounttypes "github.com/docker/docker/api/types/mount"
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+)
+
+func TestRouterCreateOnRemoteDaemon(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "remote")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.Unsetenv("SKUPPER_STORAGE")
+
+	_, dd := newFakeClient()
+	dd.Runtime = libdocker.RuntimeInfo{
+		Name:   libdocker.RuntimeDocker,
+		Host:   "tcp://remote:2376",
+		Remote: true,
+	}
+	cli, err := NewClientWithInterface(dd)
+	assert.Check(t, err)
+	assert.Equal(t, types.GetSkupperStorage(), types.StorageVolume)
+	workDir := os.Getenv("SKUPPER_TMPDIR")
+	assert.Assert(t, workDir != tmpDir)
+
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:      "remote",
+		EnableController: true,
+	})
+	assert.Check(t, err)
+
+	// the containers only see the volumes, never the working copy
+	router, err := docker.InspectContainer(types.TransportDeploymentName, dd)
+	assert.Check(t, err)
+	for _, m := range router.Mounts {
+		assert.Equal(t, m.Type, dockermounttypes.TypeVolume, m.Destination)
+	}
+	_, ok := dd.VolumeFiles(types.GetSkupperVolume(types.ConfigPath))["qdrouterd.json"]
+	assert.Assert(t, ok)
+	_, ok = dd.VolumeFiles(types.GetSkupperVolume(types.CertsPath))["skupper-internal/tls.crt"]
+	assert.Assert(t, ok)
+
+	// another workstation starts from the volumes alone
+	assert.Check(t, os.RemoveAll(workDir))
+	cli, err = NewClientWithInterface(dd)
+	assert.Check(t, err)
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, sc.Spec.SkupperName, "remote")
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+	assert.Assert(t, !docker.StateVolumesExist(dd))
+}
+
+func TestRouterCreateWithVolumeStorage(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "volume")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.Unsetenv("SKUPPER_STORAGE")
+
+	cli, dd := newFakeClient()
+	assert.Equal(t, types.GetSkupperStorage(), types.StorageHost)
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName:      "local",
+		EnableController: true,
+		Storage:          types.StorageVolume,
+	})
+	assert.Check(t, err)
+	for _, name := range []string{types.TransportDeploymentName, types.ControllerDeploymentName} {
+		current, err := docker.InspectContainer(name, dd)
+		assert.Check(t, err)
+		for _, m := range current.Mounts {
+			assert.Assert(t, !strings.HasPrefix(m.Source, tmpDir), "%s mounts %s", name, m.Source)
+		}
+	}
+
+	// later commands find the site in its volumes, even once the host
+	// directories have been cleaned up
+	os.Unsetenv("SKUPPER_STORAGE")
+	assert.Check(t, os.RemoveAll(types.GetSkupperPath(types.HostPath)))
+	cli, err = NewClientWithInterface(dd)
+	assert.Check(t, err)
+	assert.Equal(t, types.GetSkupperStorage(), types.StorageVolume)
+	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, sc.Spec.Storage, types.StorageVolume)
+	_, err = cli.RouterInspect()
+	assert.Check(t, err)
+
+	errors := cli.RouterRemove()
+	assert.Assert(t, len(errors) == 0)
+	assert.Assert(t, !docker.StateVolumesExist(dd))
+}
+
+func TestRouterCreateHostStorageOnRemoteDaemon(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "remote")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.Unsetenv("SKUPPER_STORAGE")
+
+	_, dd := newFakeClient()
+	dd.Runtime = libdocker.RuntimeInfo{
+		Name:   libdocker.RuntimeDocker,
+		Host:   "tcp://remote:2376",
+		Remote: true,
+	}
+	cli, err := NewClientWithInterface(dd)
+	assert.Check(t, err)
+	err = cli.RouterCreate(types.SiteConfigSpec{
+		SkupperName: "remote",
+		Storage:     types.StorageHost,
+	})
+	assert.Error(t, err, "Host storage needs a daemon on this host, tcp://remote:2376 is remote")
+}
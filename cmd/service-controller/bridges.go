@@ -1,6 +1,8 @@
 package main
 
 import (
+	"reflect"
+
 	"github.com/skupperproject/skupper-docker/api/types"
 )
 
@@ -12,12 +14,29 @@ func getBridgeName(address string, host string) string {
 	}
 }
 
-// selector ~ type one of container, host-service
+// selector ~ type one of container, host-service or a label selector
 type EgressBindings struct {
 	name       string
 	selector   string
 	service    string
 	egressPort int
+	// target ports of a service with several ports, keyed by service port
+	egressPorts map[int]int
+	// the running containers matched by a label selector
+	replicas []string
+	// the instance a container stands for in a headless service
+	instance *int
+}
+
+// containers returns the names of the containers the target stands for
+func (eb *EgressBindings) containers() []string {
+	if types.IsLabelSelector(eb.selector) {
+		return eb.replicas
+	}
+	if eb.selector == "internal.skupper.io/container" {
+		return []string{eb.name}
+	}
+	return nil
 }
 
 type ServiceBindings struct {
@@ -25,6 +44,7 @@ type ServiceBindings struct {
 	protocol     string
 	address      string
 	publicPort   int
+	ports        []int
 	ingressPort  int
 	aggregation  string
 	eventChannel bool
@@ -42,12 +62,29 @@ func asServiceInterface(bindings *ServiceBindings) types.ServiceInterface {
 		Headless:     bindings.headless,
 		Origin:       bindings.origin,
 	}
+	if len(bindings.ports) > 1 {
+		si.Ports = bindings.ports
+	}
 	for _, eb := range bindings.targets {
+		// each replica gets its own connector so traffic is balanced across them
+		if types.IsLabelSelector(eb.selector) {
+			for _, replica := range eb.replicas {
+				si.Targets = append(si.Targets, types.ServiceInterfaceTarget{
+					Name:        replica,
+					Selector:    "internal.skupper.io/container",
+					TargetPort:  eb.egressPort,
+					TargetPorts: eb.egressPorts,
+				})
+			}
+			continue
+		}
 		si.Targets = append(si.Targets, types.ServiceInterfaceTarget{
-			Name:       eb.name,
-			Selector:   eb.selector,
-			TargetPort: eb.egressPort,
-			Service:    eb.service,
+			Name:        eb.name,
+			Selector:    eb.selector,
+			TargetPort:  eb.egressPort,
+			TargetPorts: eb.egressPorts,
+			Service:     eb.service,
+			Instance:    eb.instance,
 		})
 	}
 	return si
@@ -94,12 +131,15 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface) erro
 		sb := newServiceBindings(required.Origin, required.Protocol, required.Address, required.Port, required.Headless, required.Port, required.Aggregate, required.EventChannel)
 		for _, t := range required.Targets {
 			sb.targets[required.Address+"@"+t.Name] = &EgressBindings{
-				name:       t.Name,
-				selector:   t.Selector,
-				service:    t.Service,
-				egressPort: t.TargetPort,
+				name:        t.Name,
+				selector:    t.Selector,
+				service:     t.Service,
+				egressPort:  t.TargetPort,
+				egressPorts: t.TargetPorts,
+				instance:    t.Instance,
 			}
 		}
+		sb.ports = required.GetPorts()
 		c.bindings[required.Address] = sb
 	} else {
 		//check it is configured correctly
@@ -109,6 +149,9 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface) erro
 		if bindings.publicPort != required.Port {
 			bindings.publicPort = required.Port
 		}
+		if !reflect.DeepEqual(bindings.ports, required.GetPorts()) {
+			bindings.ports = required.GetPorts()
+		}
 		if bindings.aggregation != required.Aggregate {
 			bindings.aggregation = required.Aggregate
 		}
@@ -118,15 +161,25 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface) erro
 		if bindings.origin != required.Origin {
 			bindings.origin = required.Origin
 		}
+		if !reflect.DeepEqual(bindings.headless, required.Headless) {
+			bindings.headless = required.Headless
+		}
 
 		for _, t := range required.Targets {
 			targetPort := getTargetPort(required, t)
 			target := bindings.targets[required.Address+"@"+t.Name]
 			if target == nil {
 				bindings.addTarget(required.Address, t.Name, t.Selector, targetPort, c)
+				target = bindings.targets[required.Address+"@"+t.Name]
 			} else if target.egressPort != targetPort {
 				target.egressPort = targetPort
 			}
+			if !reflect.DeepEqual(target.egressPorts, t.TargetPorts) {
+				target.egressPorts = t.TargetPorts
+			}
+			if !reflect.DeepEqual(target.instance, t.Instance) {
+				target.instance = t.Instance
+			}
 		}
 
 		for k, _ := range bindings.targets {
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/client"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+	"github.com/skupperproject/skupper-docker/pkg/utils"
+)
+
+// the console users shared with the cli, one file per user holding the
+// password or a hash of it
+var consoleUsersPath = types.ConsoleUsersMountPath
+
+// ConsoleLink is a link of the site router to another site
+type ConsoleLink struct {
+	Host   string `json:"host"`
+	Role   string `json:"role"`
+	Dir    string `json:"dir"`
+	Status string `json:"status"`
+	Active bool   `json:"active"`
+}
+
+// ConsoleService is a service of the network with the site it originates from
+type ConsoleService struct {
+	Address  string                       `json:"address"`
+	Protocol string                       `json:"protocol"`
+	Ports    []int                        `json:"ports"`
+	Origin   string                       `json:"origin"`
+	Local    bool                         `json:"local"`
+	Targets  []string                     `json:"targets"`
+	Stats    *types.ServiceInterfaceStats `json:"stats,omitempty"`
+}
+
+// ConsoleData is what the console shows, it is also served as json
+type ConsoleData struct {
+	SiteId   string                    `json:"siteId"`
+	SiteName string                    `json:"siteName,omitempty"`
+	Sites    []types.NetworkSiteStatus `json:"sites"`
+	Links    []ConsoleLink             `json:"links"`
+	Services []ConsoleService          `json:"services"`
+	Errors   []string                  `json:"errors,omitempty"`
+}
+
+func targetNames(si types.ServiceInterface) []string {
+	names := []string{}
+	for _, t := range si.Targets {
+		switch {
+		case t.Name != "":
+			names = append(names, t.Name)
+		case t.Service != "":
+			names = append(names, t.Service)
+		default:
+			names = append(names, t.Selector)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getConsoleData gathers the state of the site and of the network it is part
+// of, what cannot be retrieved is reported rather than failing the page
+func (c *Controller) getConsoleData() ConsoleData {
+	data := ConsoleData{
+		SiteId:   c.origin,
+		Sites:    []types.NetworkSiteStatus{},
+		Links:    []ConsoleLink{},
+		Services: []ConsoleService{},
+	}
+	dd := c.vanClient.DockerInterface
+
+	definitions, err := getServiceDefinitions()
+	if err != nil {
+		data.Errors = append(data.Errors, err.Error())
+	}
+	vsis := []types.ServiceInterface{}
+	for _, si := range definitions {
+		vsis = append(vsis, si)
+	}
+	sort.Slice(vsis, func(i, j int) bool { return vsis[i].Address < vsis[j].Address })
+
+	status, err := client.GetNetworkStatus(c.origin, vsis, dd)
+	if err != nil {
+		data.Errors = append(data.Errors, "Failed to retrieve network status: "+err.Error())
+	} else {
+		data.Sites = status.Sites
+	}
+	for _, site := range data.Sites {
+		if site.SiteId == c.origin {
+			data.SiteName = site.SiteName
+		}
+	}
+
+	connections, err := qdr.GetConnections(dd)
+	if err != nil {
+		data.Errors = append(data.Errors, "Failed to retrieve router connections: "+err.Error())
+	}
+	for _, conn := range connections {
+		if conn.Role != string(qdr.RoleInterRouter) && conn.Role != qdr.RoleEdge {
+			continue
+		}
+		data.Links = append(data.Links, ConsoleLink{
+			Host:   conn.Host,
+			Role:   conn.Role,
+			Dir:    conn.Dir,
+			Status: conn.OperStatus,
+			Active: conn.Active,
+		})
+	}
+	sort.Slice(data.Links, func(i, j int) bool { return data.Links[i].Host < data.Links[j].Host })
+
+	stats := map[string]types.ServiceInterfaceStats{}
+	serviceStats, err := client.GetServiceStats(vsis, dd)
+	if err != nil {
+		data.Errors = append(data.Errors, "Failed to retrieve traffic statistics: "+err.Error())
+	}
+	for _, s := range serviceStats {
+		stats[s.Address] = s
+	}
+
+	for _, si := range vsis {
+		service := ConsoleService{
+			Address:  si.Address,
+			Protocol: si.Protocol,
+			Ports:    si.GetPorts(),
+			Origin:   si.Origin,
+			Local:    types.IsLocalOrigin(si.Origin),
+			Targets:  targetNames(si),
+		}
+		if service.Local {
+			service.Origin = c.origin
+		}
+		if s, ok := stats[si.Address]; ok {
+			service.Stats = &s
+		}
+		data.Services = append(data.Services, service)
+	}
+	return data
+}
+
+// checkConsoleUser verifies the credentials against the users file
+func checkConsoleUser(user string, password string) bool {
+	if user == "" || strings.HasPrefix(user, ".") || strings.ContainsAny(user, `/\`) {
+		return false
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(consoleUsersPath, user))
+	if err != nil {
+		return false
+	}
+	return utils.CheckPassword(string(expected), password)
+}
+
+// authenticated requires the console credentials when the auth mode is
+// internal, the users file is read on each request so changes apply at once
+func authenticated(authMode string, handler http.HandlerFunc) http.HandlerFunc {
+	if authMode != string(types.ConsoleAuthModeInternal) {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || !checkConsoleUser(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="skupper"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (c *Controller) consoleDataHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.getConsoleData()); err != nil {
+		log.Println("Failed to encode console data: ", err.Error())
+	}
+}
+
+func (c *Controller) consolePageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := consolePage.Execute(w, c.getConsoleData()); err != nil {
+		log.Println("Failed to render console: ", err.Error())
+	}
+}
+
+func (c *Controller) newConsoleHandler(authMode string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", authenticated(authMode, c.consolePageHandler))
+	mux.HandleFunc("/api/v1/data", authenticated(authMode, c.consoleDataHandler))
+	return mux
+}
+
+func (c *Controller) runConsoleServer(addr string, authMode string) {
+	log.Printf("Serving console on %s (auth mode %s)", addr, authMode)
+	err := http.ListenAndServe(addr, c.newConsoleHandler(authMode))
+	if err != nil {
+		log.Println("Console server failed: ", err.Error())
+	}
+}
+
+var consolePage = template.Must(template.New("console").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>Skupper - {{if .SiteName}}{{.SiteName}}{{else}}{{.SiteId}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #151515; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #d2d2d2; padding: 0.3em 0.8em; text-align: left; }
+th { background: #f0f0f0; }
+.error { color: #c9190b; }
+</style>
+</head>
+<body>
+<h1>Site {{if .SiteName}}{{.SiteName}} ({{.SiteId}}){{else}}{{.SiteId}}{{end}}</h1>
+{{range .Errors}}<p class="error">{{.}}</p>
+{{end}}
+<h2>Sites</h2>
+<table>
+<tr><th>Site</th><th>Name</th><th>Routers</th><th>Services</th></tr>
+{{range .Sites}}<tr><td>{{.SiteId}}</td><td>{{.SiteName}}</td><td>{{range .Routers}}{{.}} {{end}}</td><td>{{range .Services}}{{.}} {{end}}</td></tr>
+{{end}}</table>
+<h2>Links</h2>
+<table>
+<tr><th>Host</th><th>Role</th><th>Direction</th><th>Status</th></tr>
+{{range .Links}}<tr><td>{{.Host}}</td><td>{{.Role}}</td><td>{{.Dir}}</td><td>{{.Status}}{{if not .Active}} (inactive){{end}}</td></tr>
+{{else}}<tr><td colspan="4">No links</td></tr>
+{{end}}</table>
+<h2>Services</h2>
+<table>
+<tr><th>Address</th><th>Protocol</th><th>Ports</th><th>Origin</th><th>Targets</th><th>Connections</th><th>Requests</th><th>Bytes in</th><th>Bytes out</th></tr>
+{{range .Services}}<tr><td>{{.Address}}</td><td>{{.Protocol}}</td><td>{{range .Ports}}{{.}} {{end}}</td><td>{{.Origin}}{{if .Local}} (local){{end}}</td><td>{{range .Targets}}{{.}} {{end}}</td>
+{{with .Stats}}<td>{{.ActiveConnections}} / {{.TotalConnections}}</td><td>{{.Requests}}</td><td>{{.BytesIn}}</td><td>{{.BytesOut}}</td>{{else}}<td></td><td></td><td></td><td></td>{{end}}</tr>
+{{else}}<tr><td colspan="9">No services</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
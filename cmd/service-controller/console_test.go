@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker/fake"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+	"github.com/skupperproject/skupper-docker/pkg/utils"
+)
+
+func getAs(t *testing.T, handler http.Handler, path string, user string, password string) (int, string) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", path, nil)
+	if user != "" {
+		request.SetBasicAuth(user, password)
+	}
+	handler.ServeHTTP(recorder, request)
+	body, err := ioutil.ReadAll(recorder.Result().Body)
+	assert.Check(t, err)
+	return recorder.Code, string(body)
+}
+
+func TestConsole(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "console")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+	serviceDefsPath = tmpDir + "/skupper-services"
+	consoleUsersPath = tmpDir
+	hash, err := utils.HashPassword("secret")
+	assert.Assert(t, err)
+	assert.Check(t, ioutil.WriteFile(tmpDir+"/admin", []byte(hash), 0755))
+
+	services := map[string]types.ServiceInterface{
+		"tcp-go-echo": {
+			Address:  "tcp-go-echo",
+			Protocol: "tcp",
+			Port:     9090,
+			Targets: []types.ServiceInterfaceTarget{
+				{Name: "echo-server", Selector: "internal.skupper.io/container"},
+			},
+		},
+		"remote-echo": {
+			Address:  "remote-echo",
+			Protocol: "http",
+			Port:     8080,
+			Origin:   "site-b",
+		},
+	}
+	encoded, err := json.Marshal(services)
+	assert.Check(t, err)
+	assert.Check(t, ioutil.WriteFile(serviceDefsPath, encoded, 0755))
+
+	controller, dd := newFakeController(t)
+	_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name:   types.TransportDeploymentName,
+		Config: &dockercontainer.Config{Image: types.DefaultTransportImage},
+	})
+	assert.Check(t, err)
+	assert.Check(t, dd.StartContainer(types.TransportDeploymentName))
+	entities := map[string]string{
+		"node":        `[{"id": "site-a-router", "nextHop": "(self)"}, {"id": "site-b-router", "nextHop": "", "cost": 1}]`,
+		"connection":  `[{"host": "10.0.0.2:55671", "role": "inter-router", "dir": "out", "operStatus": "up", "active": true}, {"host": "127.0.0.1:4242", "role": "normal", "dir": "in", "operStatus": "up", "active": true}]`,
+		"router.link": `[{"linkType": "endpoint", "owningAddr": "M0tcp-go-echo"}]`,
+	}
+	metadata := map[string]string{
+		"site-a-router": qdr.GetSiteMetadata("site-a", "east"),
+		"site-b-router": qdr.GetSiteMetadata("site-b", "west"),
+	}
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		if len(cmd) == 6 && cmd[0] == "qdmanage" && cmd[3] == "router" {
+			encoded, _ := json.Marshal([]qdr.RouterMetadata{{Id: cmd[5], Metadata: metadata[cmd[5]]}})
+			return fake.ExecResult{Stdout: string(encoded)}
+		}
+		if len(cmd) == 4 && cmd[0] == "qdmanage" {
+			if out, ok := entities[cmd[3]]; ok {
+				return fake.ExecResult{Stdout: out}
+			}
+		}
+		return fake.ExecResult{Stdout: "[]"}
+	}
+
+	// internal auth checks the users shared with the cli
+	handler := controller.newConsoleHandler(string(types.ConsoleAuthModeInternal))
+	code, _ := getAs(t, handler, "/", "", "")
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code, _ = getAs(t, handler, "/api/v1/data", "admin", "wrong")
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code, _ = getAs(t, handler, "/api/v1/data", "../console/admin", "secret")
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	code, body := getAs(t, handler, "/api/v1/data", "admin", "secret")
+	assert.Equal(t, code, http.StatusOK)
+	data := ConsoleData{}
+	assert.Check(t, json.Unmarshal([]byte(body), &data))
+	assert.Equal(t, data.SiteId, "site-a")
+	assert.Equal(t, data.SiteName, "east")
+	assert.Equal(t, len(data.Errors), 0, data.Errors)
+	assert.Equal(t, len(data.Sites), 2)
+	assert.DeepEqual(t, data.Links, []ConsoleLink{
+		{Host: "10.0.0.2:55671", Role: "inter-router", Dir: "out", Status: "up", Active: true},
+	})
+	assert.Equal(t, len(data.Services), 2)
+	remote, local := data.Services[0], data.Services[1]
+	assert.Equal(t, remote.Address, "remote-echo")
+	assert.Equal(t, remote.Origin, "site-b")
+	assert.Assert(t, !remote.Local)
+	assert.Equal(t, local.Address, "tcp-go-echo")
+	assert.Equal(t, local.Origin, "site-a")
+	assert.Assert(t, local.Local)
+	assert.DeepEqual(t, local.Targets, []string{"echo-server"})
+	assert.Assert(t, local.Stats != nil)
+	assert.Equal(t, local.Stats.Links, 1)
+
+	code, body = getAs(t, handler, "/", "admin", "secret")
+	assert.Equal(t, code, http.StatusOK)
+	for _, expected := range []string{"Site east (site-a)", "10.0.0.2:55671", "remote-echo", "echo-server"} {
+		assert.Assert(t, strings.Contains(body, expected), "missing %q in:\n%s", expected, body)
+	}
+
+	// unsecured serves anyone
+	handler = controller.newConsoleHandler(types.ConsoleAuthModeUnsecured)
+	code, _ = getAs(t, handler, "/", "", "")
+	assert.Equal(t, code, http.StatusOK)
+}
@@ -7,12 +7,15 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	amqp "github.com/interconnectedcloud/go-amqp"
 
 	dockertypes "github.com/docker/docker/api/types"
+	dockerevents "github.com/docker/docker/api/types/events"
 	dockerfilters "github.com/docker/docker/api/types/filters"
 
 	"github.com/fsnotify/fsnotify"
@@ -23,8 +26,9 @@ import (
 )
 
 type Controller struct {
-	origin    string
-	vanClient *client.VanClient
+	origin       string
+	vanClient    *client.VanClient
+	sharedBridge bool
 
 	// controller loop state
 	bindings map[string]*ServiceBindings
@@ -38,8 +42,21 @@ type Controller struct {
 	byName          map[string]types.ServiceInterface
 	desiredServices map[string]types.ServiceInterface
 	heardFrom       map[string]time.Time
+	metrics         *ControllerMetrics
+	// syncLock guards the service sync state shared by the controller loop,
+	// the service sync receiver and its sender
+	syncLock     sync.Mutex
+	localChanged chan bool
+	generation   int64
+	received     map[string]map[string]types.ServiceInterface
+	generations  map[string]int64
+	// peers that predate deltas, by when they last sent an update
+	legacyPeers map[string]time.Time
 }
 
+// the service definitions shared with the cli through the services directory
+var serviceDefsPath = "/etc/messaging/services/skupper-services"
+
 func equivalentProxyConfig(desired types.ServiceInterface, env []string) bool {
 	envVar := docker.FindEnvVar(env, "SKUPPER_PROXY_CONFIG")
 	encodedDesired, _ := json.Marshal(desired)
@@ -48,9 +65,10 @@ func equivalentProxyConfig(desired types.ServiceInterface, env []string) bool {
 
 func NewController(cli *client.VanClient, origin string, tlsConfig *tls.Config) (*Controller, error) {
 	controller := &Controller{
-		vanClient: cli,
-		origin:    origin,
-		tlsConfig: tlsConfig,
+		vanClient:    cli,
+		origin:       origin,
+		tlsConfig:    tlsConfig,
+		sharedBridge: os.Getenv("SKUPPER_SHARED_BRIDGE") != "",
 	}
 
 	// Organize service definitions
@@ -60,6 +78,11 @@ func NewController(cli *client.VanClient, origin string, tlsConfig *tls.Config)
 	controller.byName = make(map[string]types.ServiceInterface)
 	controller.desiredServices = make(map[string]types.ServiceInterface)
 	controller.heardFrom = make(map[string]time.Time)
+	controller.localChanged = make(chan bool, 1)
+	controller.metrics = NewControllerMetrics()
+	controller.received = make(map[string]map[string]types.ServiceInterface)
+	controller.generations = make(map[string]int64)
+	controller.legacyPeers = make(map[string]time.Time)
 
 	// could setup watchers here
 
@@ -82,9 +105,14 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 		log.Fatal("Failed to pull proxy image: ", err.Error())
 	}
 
+	go c.runHttpServer(fmt.Sprintf(":%d", types.ControllerMetricsPort))
+	if authMode := os.Getenv("SKUPPER_CONSOLE_AUTH"); authMode != "" {
+		go c.runConsoleServer(fmt.Sprintf(":%d", types.ConsoleDefaultServicePort), authMode)
+	}
+
 	log.Println("Starting workers")
 	go c.runServiceSync() // receives peer updates
-	go c.runServiceDefsWatcher()
+	go c.runServiceDefsWatcher(c.watchDockerEvents(stopCh))
 
 	log.Println("Started workers")
 	<-stopCh
@@ -99,7 +127,7 @@ func updateSkupperServices(changed []types.ServiceInterface, deleted []string, o
 	}
 
 	current := make(map[string]types.ServiceInterface)
-	file, err := ioutil.ReadFile("/etc/messaging/services/skupper-services")
+	file, err := ioutil.ReadFile(serviceDefsPath)
 
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve skupper service definitions: %w", err)
@@ -122,7 +150,7 @@ func updateSkupperServices(changed []types.ServiceInterface, deleted []string, o
 		return fmt.Errorf("Failed to encode json for service interface: %w", err)
 	}
 
-	err = ioutil.WriteFile("/etc/messaging/services/skupper-services", encoded, 0755)
+	err = ioutil.WriteFile(serviceDefsPath, encoded, 0755)
 	if err != nil {
 		return fmt.Errorf("Failed to write service file: %w", err)
 	}
@@ -131,7 +159,7 @@ func updateSkupperServices(changed []types.ServiceInterface, deleted []string, o
 
 func getServiceDefinitions() (map[string]types.ServiceInterface, error) {
 	svcDefs := make(map[string]types.ServiceInterface)
-	file, err := ioutil.ReadFile("/etc/messaging/services/skupper-services")
+	file, err := ioutil.ReadFile(serviceDefsPath)
 	if err != nil {
 		return svcDefs, fmt.Errorf("Failed to retrieve skupper service definitions: %w", err)
 	}
@@ -142,39 +170,54 @@ func getServiceDefinitions() (map[string]types.ServiceInterface, error) {
 	return svcDefs, nil
 }
 
-func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
-	proxies := c.getProxies()
-	_, exists := proxies[bindings.address]
-	serviceInterface := asServiceInterface(bindings)
-
-	if bindings.origin == "" {
-		attached := make(map[string]dockertypes.EndpointResource)
-		sn, err := docker.InspectNetwork(types.TransportNetworkName, c.vanClient.DockerInterface)
-		if err != nil {
-			return fmt.Errorf("Unable to retrieve skupper-network: %w", err)
-		}
-		for _, c := range sn.Containers {
-			attached[c.Name] = c
-		}
+// attachTargets connects the target containers of a local service to the
+// skupper network so the router can reach them
+func (c *Controller) attachTargets(bindings *ServiceBindings) error {
+	attached := make(map[string]dockertypes.EndpointResource)
+	sn, err := docker.InspectNetwork(types.GetTransportNetworkName(), c.vanClient.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve skupper-network: %w", err)
+	}
+	for _, c := range sn.Containers {
+		attached[c.Name] = c
+	}
 
-		for _, t := range bindings.targets {
-			if t.selector == "internal.skupper.io/container" {
-				if _, ok := attached[t.name]; !ok {
-					fmt.Println("Attaching container to skupper network: ", t.service)
-					err := docker.ConnectContainerToNetwork(types.TransportNetworkName, t.name, c.vanClient.DockerInterface)
-					if err != nil {
-						log.Println("Failed to attach target container to skupper network: ", err.Error())
-					}
+	for _, t := range bindings.targets {
+		for _, name := range t.containers() {
+			if _, ok := attached[name]; !ok {
+				fmt.Println("Attaching container to skupper network: ", name)
+				err := docker.ConnectContainerToNetwork(types.GetTransportNetworkName(), name, c.vanClient.DockerInterface)
+				if err != nil {
+					log.Println("Failed to attach target container to skupper network: ", err.Error())
 				}
 			}
 		}
 	}
+	return nil
+}
+
+func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
+	serviceInterface := asServiceInterface(bindings)
+
+	if types.IsLocalOrigin(bindings.origin) {
+		if err := c.attachTargets(bindings); err != nil {
+			return err
+		}
+	}
 
 	config, _ := qdr.GetRouterConfigForProxy(serviceInterface, c.origin)
 	mapToHost := false
 	if os.Getenv("SKUPPER_MAP_TO_HOST") != "" {
 		mapToHost = true
 	}
+	return c.ensureProxyContainer(serviceInterface, config, mapToHost)
+}
+
+// ensureProxyContainer deploys the proxy for the service, re-creating it when
+// its router config has changed
+func (c *Controller) ensureProxyContainer(serviceInterface types.ServiceInterface, config string, mapToHost bool) error {
+	proxies := c.getProxies()
+	_, exists := proxies[serviceInterface.Address]
 
 	if !exists {
 		log.Println("Deploying proxy: ", serviceInterface.Address)
@@ -186,8 +229,9 @@ func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
 		if err != nil {
 			return fmt.Errorf("Failed to start proxy container: %w", err)
 		}
+		c.metrics.proxyWasCreated()
 	} else {
-		proxyContainer, err := docker.InspectContainer(serviceInterface.Address, c.vanClient.DockerInterface)
+		proxyContainer, err := docker.InspectContainer(types.GetSiteScopedName(serviceInterface.Address), c.vanClient.DockerInterface)
 		if err != nil {
 			return fmt.Errorf("Failed to retrieve current proxy container: %w", err)
 		}
@@ -206,38 +250,159 @@ func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
 			if err != nil {
 				return fmt.Errorf("Failed to start proxy container: %w", err)
 			}
+			c.metrics.proxyWasCreated()
 		}
 	}
 	return nil
 
 }
 
+// instanceServices returns the services standing for the instances of a
+// headless service, named after the address of each instance
+func instanceServices(bindings *ServiceBindings) []types.ServiceInterface {
+	if bindings.headless == nil {
+		return nil
+	}
+	serviceInterface := asServiceInterface(bindings)
+	instances := []types.ServiceInterface{}
+	for i := 0; i < bindings.headless.Size; i++ {
+		instances = append(instances, types.ServiceInterface{
+			Address:  serviceInterface.GetInstanceAddress(i, bindings.address),
+			Protocol: bindings.protocol,
+			Port:     serviceInterface.Port,
+			Ports:    serviceInterface.Ports,
+			Origin:   bindings.origin,
+		})
+	}
+	return instances
+}
+
+// ensureInstanceProxiesFor deploys a proxy per instance of a headless
+// service, so that each has an address of its own on the skupper network
+func (c *Controller) ensureInstanceProxiesFor(bindings *ServiceBindings) error {
+	serviceInterface := asServiceInterface(bindings)
+	for i, instance := range instanceServices(bindings) {
+		config, err := qdr.GetRouterConfigForHeadlessProxy(serviceInterface, i, c.origin)
+		if err != nil {
+			return fmt.Errorf("Failed to generate config for %s: %w", instance.Address, err)
+		}
+		// instances share their ports, so they cannot all be mapped to the host
+		if err := c.ensureProxyContainer(instance, config, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isDesiredProxy reports whether a proxy container is still needed, either
+// for a binding or for an instance of a headless one
+func (c *Controller) isDesiredProxy(name string) bool {
+	if def, ok := c.bindings[name]; ok && def != nil {
+		return true
+	}
+	for _, bindings := range c.bindings {
+		if bindings == nil {
+			continue
+		}
+		for _, instance := range instanceServices(bindings) {
+			if instance.Address == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deleteProxy removes the proxy or bridge of the site with the given name,
+// which is without the site prefix
 func (c *Controller) deleteProxy(name string) error {
+	name = types.GetSiteScopedName(name)
 	err := docker.StopContainer(name, c.vanClient.DockerInterface)
 	if err != nil {
 		return err
 	}
 	err = docker.RemoveContainer(name, c.vanClient.DockerInterface)
+	if err == nil {
+		c.metrics.proxyWasDeleted()
+	}
 	return err
 }
 
+// recordProxyState updates the binding and proxy gauges
+func (c *Controller) recordProxyState() {
+	proxies := len(c.getProxies())
+	if _, err := docker.InspectContainer(types.GetBridgeDeploymentName(), c.vanClient.DockerInterface); err == nil {
+		proxies++
+	}
+	c.metrics.setBindings(len(c.bindings), proxies)
+}
+
+func (c *Controller) ensureInstanceProxies() {
+	for _, v := range c.bindings {
+		if v == nil {
+			continue
+		}
+		err := c.ensureInstanceProxiesFor(v)
+		if err != nil {
+			log.Println("Unable to ensure headless instance proxy containers: ", err.Error())
+			c.metrics.proxyFailed()
+		}
+	}
+}
+
+// resolveSelectorTargets updates the replicas of the label selector targets
+// and reports whether any of them changed
+func (c *Controller) resolveSelectorTargets() bool {
+	changed := false
+	for _, bindings := range c.bindings {
+		if bindings == nil || !types.IsLocalOrigin(bindings.origin) {
+			continue
+		}
+		for _, t := range bindings.targets {
+			if !types.IsLabelSelector(t.selector) {
+				continue
+			}
+			replicas, err := docker.SelectContainers(t.selector, c.vanClient.DockerInterface)
+			if err != nil {
+				log.Printf("Failed to resolve selector %s of %s: %s", t.selector, bindings.address, err.Error())
+				continue
+			}
+			if !reflect.DeepEqual(replicas, t.replicas) {
+				log.Printf("Selector %s of %s matches %v", t.selector, bindings.address, replicas)
+				t.replicas = replicas
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
 func (c *Controller) updateProxies() {
+	c.resolveSelectorTargets()
+	if c.sharedBridge {
+		c.updateBridge()
+		return
+	}
 	for _, v := range c.bindings {
 		err := c.ensureProxyFor(v)
 		if err != nil {
 			log.Println("Unable to ensure proxy container: ", err.Error())
+			c.metrics.proxyFailed()
 		}
 	}
+	c.ensureInstanceProxies()
 	proxies := c.getProxies()
-	for _, v := range proxies {
-		proxyContainerName := strings.TrimPrefix(v.Names[0], "/")
-		def, ok := c.bindings[proxyContainerName]
-		if !ok || def == nil {
-			c.deleteProxy(proxyContainerName)
+	for name := range proxies {
+		if !c.isDesiredProxy(name) {
+			c.deleteProxy(name)
 		}
 	}
+	// a bridge router left over from shared mode is no longer needed
+	c.ensureBridgeFor(nil)
+	c.recordProxyState()
 }
 
+// getProxies returns the proxies of the site by address
 func (c *Controller) getProxies() map[string]dockertypes.Container {
 	proxies := make(map[string]dockertypes.Container)
 
@@ -247,10 +412,10 @@ func (c *Controller) getProxies() map[string]dockertypes.Container {
 		Filters: filters,
 		All:     true,
 	}
-	containers, err := docker.ListContainers(opts, c.vanClient.DockerInterface)
+	containers, err := docker.ListSiteContainers(opts, c.vanClient.DockerInterface)
 	if err == nil {
 		for _, container := range containers {
-			proxyName := strings.TrimPrefix(container.Names[0], "/")
+			proxyName := types.GetSiteLocalName(strings.TrimPrefix(container.Names[0], "/"))
 			proxies[proxyName] = container
 		}
 	}
@@ -282,25 +447,30 @@ func (c *Controller) processServiceDefs() {
 	c.updateProxies()
 }
 
-func (c *Controller) runServiceDefsWatcher() {
+func (c *Controller) runServiceDefsWatcher(events <-chan dockerevents.Message) {
 	var watcher *fsnotify.Watcher
 
 	watcher, _ = fsnotify.NewWatcher()
 	defer watcher.Close()
 
-	err := watcher.Add("/etc/messaging/services/skupper-services")
+	err := watcher.Add(serviceDefsPath)
 	if err != nil {
 		log.Println("Could not add directory watcher", err.Error())
 		return
 	}
 
+	if err := c.updateLabelledServices(); err != nil {
+		log.Println("Failed to update services from container labels: ", err.Error())
+	}
 	c.processServiceDefs()
 
+	c.syncLock.Lock()
 	for origin, _ := range c.byOrigin {
 		if origin != c.origin {
-			c.heardFrom[origin] = time.Now()
+			c.markHeard(origin)
 		}
 	}
+	c.syncLock.Unlock()
 
 	for {
 		select {
@@ -311,6 +481,8 @@ func (c *Controller) runServiceDefsWatcher() {
 			if event.Op&fsnotify.Write == fsnotify.Write {
 				c.processServiceDefs()
 			}
+		case msg := <-events:
+			c.handleDockerEvent(msg)
 		}
 	}
 
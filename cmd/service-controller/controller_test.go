@@ -0,0 +1,511 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/client"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker/fake"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+)
+
+func newFakeController(t *testing.T) (*Controller, *fake.DockerClient) {
+	dd := fake.NewDockerClient()
+	cli, err := client.NewClientWithInterface(dd)
+	assert.Check(t, err)
+	_, err = dd.CreateNetwork(types.TransportNetworkName)
+	assert.Check(t, err)
+	controller, err := NewController(cli, "site-a", nil)
+	assert.Check(t, err)
+	return controller, dd
+}
+
+func TestUpdateProxies(t *testing.T) {
+	controller, dd := newFakeController(t)
+
+	_, err := dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name:   "echo-server",
+		Config: &dockercontainer.Config{Image: "quay.io/skupper/tcp-go-echo"},
+	})
+	assert.Check(t, err)
+
+	local := types.ServiceInterface{
+		Address:  "tcp-go-echo",
+		Protocol: "tcp",
+		Port:     9090,
+		Targets: []types.ServiceInterfaceTarget{
+			{
+				Name:     "echo-server",
+				Selector: "internal.skupper.io/container",
+			},
+		},
+	}
+	remote := types.ServiceInterface{
+		Address:  "remote-echo",
+		Protocol: "http",
+		Port:     8080,
+		Origin:   "site-b",
+	}
+	controller.updateServiceBindings(local)
+	controller.updateServiceBindings(remote)
+	controller.updateProxies()
+
+	for _, si := range []types.ServiceInterface{local, remote} {
+		proxy, err := docker.InspectContainer(si.Address, dd)
+		assert.Check(t, err, si.Address)
+		assert.Equal(t, proxy.State.Status, "running", si.Address)
+		expected, _ := qdr.GetRouterConfigForProxy(si, "site-a")
+		assert.Equal(t, docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"), expected, si.Address)
+	}
+
+	sn, err := docker.InspectNetwork(types.TransportNetworkName, dd)
+	assert.Check(t, err)
+	attached := map[string]bool{}
+	for _, c := range sn.Containers {
+		attached[c.Name] = true
+	}
+	assert.Assert(t, attached["echo-server"], "target should be attached to skupper network")
+
+	// changing the port must re-create the proxy with the new config
+	remote.Port = 8181
+	controller.updateServiceBindings(remote)
+	controller.updateProxies()
+	proxy, err := docker.InspectContainer(local.Address, dd)
+	assert.Check(t, err)
+	expected, _ := qdr.GetRouterConfigForProxy(asServiceInterface(controller.bindings[local.Address]), "site-a")
+	assert.Equal(t, docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"), expected)
+
+	// removing the binding must remove the proxy
+	delete(controller.bindings, remote.Address)
+	controller.updateProxies()
+	_, err = docker.InspectContainer(remote.Address, dd)
+	assert.Assert(t, err != nil, "proxy for removed binding should be deleted")
+	_, err = docker.InspectContainer(local.Address, dd)
+	assert.Check(t, err)
+}
+
+func TestUpdateProxiesForSite(t *testing.T) {
+	os.Setenv("SKUPPER_SITE", "east")
+	defer os.Unsetenv("SKUPPER_SITE")
+	controller, dd := newFakeController(t)
+	_, err := dd.CreateNetwork(types.GetTransportNetworkName())
+	assert.Check(t, err)
+
+	// the proxy of another site for the same address
+	_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name: "west-remote-echo",
+		Config: &dockercontainer.Config{
+			Image: "quay.io/skupper/qdrouterd",
+			Labels: map[string]string{
+				"skupper.io/application": "skupper-proxy",
+				"skupper.io/component":   "proxy",
+				types.SiteQualifier:      "west",
+			},
+		},
+	})
+	assert.Check(t, err)
+
+	remote := types.ServiceInterface{
+		Address:  "remote-echo",
+		Protocol: "tcp",
+		Port:     8080,
+		Origin:   "site-b",
+	}
+	controller.updateServiceBindings(remote)
+	controller.updateProxies()
+
+	proxy, err := docker.InspectContainer("east-remote-echo", dd)
+	assert.Check(t, err)
+	assert.Equal(t, proxy.Config.Labels[types.SiteQualifier], "east")
+	aliases := map[string]bool{}
+	for _, alias := range proxy.NetworkSettings.Networks["east-skupper-network"].Aliases {
+		aliases[alias] = true
+	}
+	assert.Assert(t, aliases["remote-echo"], "proxy should be known by its address on the site network")
+
+	delete(controller.bindings, remote.Address)
+	controller.updateProxies()
+	_, err = docker.InspectContainer("east-remote-echo", dd)
+	assert.Assert(t, err != nil)
+	_, err = docker.InspectContainer("west-remote-echo", dd)
+	assert.Check(t, err, "proxies of other sites must be left alone")
+}
+
+func TestUpdateSharedBridge(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "bridge")
+	assert.Check(t, err, "Unable to create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	bridgeConfigPath = tmpDir + "/" + types.BridgeConfigFile
+
+	controller, dd := newFakeController(t)
+	controller.sharedBridge = true
+	managed := []string{}
+	dd.ExecHandler = func(container string, cmd []string) fake.ExecResult {
+		if len(cmd) > 1 && cmd[0] == "qdmanage" {
+			managed = append(managed, strings.Join(cmd[1:6], " "))
+		}
+		return fake.ExecResult{}
+	}
+
+	_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name:   "echo-server",
+		Config: &dockercontainer.Config{Image: "quay.io/skupper/tcp-go-echo"},
+	})
+	assert.Check(t, err)
+
+	local := types.ServiceInterface{
+		Address:  "tcp-go-echo",
+		Protocol: "tcp",
+		Port:     9090,
+		Targets: []types.ServiceInterfaceTarget{
+			{
+				Name:     "echo-server",
+				Selector: "internal.skupper.io/container",
+			},
+		},
+	}
+	remote := types.ServiceInterface{
+		Address:  "remote-echo",
+		Protocol: "http",
+		Port:     8080,
+		Origin:   "site-b",
+	}
+	conflicting := types.ServiceInterface{
+		Address:  "tcp-other",
+		Protocol: "tcp",
+		Port:     9090,
+		Origin:   "site-b",
+	}
+	controller.updateServiceBindings(local)
+	controller.updateServiceBindings(remote)
+	controller.updateServiceBindings(conflicting)
+	controller.updateProxies()
+
+	bridge, err := docker.InspectContainer(types.BridgeDeploymentName, dd)
+	assert.Check(t, err)
+	assert.Equal(t, bridge.State.Status, "running")
+	aliases := bridge.NetworkSettings.Networks[types.TransportNetworkName].Aliases
+	assert.DeepEqual(t, aliases, []string{types.BridgeDeploymentName, "remote-echo", "tcp-go-echo"})
+
+	config, err := qdr.GetRouterConfigFromFile(bridgeConfigPath)
+	assert.Check(t, err)
+	expected := qdr.GetBridgeConfigForService(asServiceInterface(controller.bindings["remote-echo"]), "site-a")
+	expected.Merge(qdr.GetBridgeConfigForService(asServiceInterface(controller.bindings["tcp-go-echo"]), "site-a"))
+	assert.DeepEqual(t, config.Bridges, expected)
+
+	// the service whose port is taken in the bridge falls back to a proxy
+	_, err = docker.InspectContainer("tcp-other", dd)
+	assert.Check(t, err)
+	for _, address := range []string{"tcp-go-echo", "remote-echo"} {
+		_, err = docker.InspectContainer(address, dd)
+		assert.Assert(t, err != nil, "no proxy expected for "+address)
+	}
+
+	// a new port for an existing address is applied to the running router
+	remote.Port = 8181
+	controller.updateServiceBindings(remote)
+	controller.updateProxies()
+	updated, err := docker.InspectContainer(types.BridgeDeploymentName, dd)
+	assert.Check(t, err)
+	assert.Equal(t, updated.ID, bridge.ID)
+	assert.DeepEqual(t, managed, []string{
+		"delete --type httpListener --name remote-echo",
+		"create --type httpListener --name remote-echo",
+	})
+
+	// a new address needs a new network alias, so the bridge is re-created
+	conflicting.Port = 9292
+	controller.updateServiceBindings(conflicting)
+	controller.updateProxies()
+	updated, err = docker.InspectContainer(types.BridgeDeploymentName, dd)
+	assert.Check(t, err)
+	assert.Assert(t, updated.ID != bridge.ID, "bridge should be re-created")
+	aliases = updated.NetworkSettings.Networks[types.TransportNetworkName].Aliases
+	assert.DeepEqual(t, aliases, []string{types.BridgeDeploymentName, "remote-echo", "tcp-go-echo", "tcp-other"})
+	_, err = docker.InspectContainer("tcp-other", dd)
+	assert.Assert(t, err != nil, "proxy for bridged service should be deleted")
+
+	// with no bindings left the bridge goes away
+	for address := range controller.bindings {
+		delete(controller.bindings, address)
+	}
+	controller.updateProxies()
+	_, err = docker.InspectContainer(types.BridgeDeploymentName, dd)
+	assert.Assert(t, err != nil, "bridge should be deleted")
+}
+
+func TestUpdateSharedBridgeForSite(t *testing.T) {
+	os.Setenv("SKUPPER_SITE", "east")
+	defer os.Unsetenv("SKUPPER_SITE")
+	tmpDir, err := ioutil.TempDir("", "bridge")
+	assert.Check(t, err, "Unable to create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	bridgeConfigPath = tmpDir + "/" + types.BridgeConfigFile
+
+	controller, dd := newFakeController(t)
+	controller.sharedBridge = true
+	_, err = dd.CreateNetwork(types.GetTransportNetworkName())
+	assert.Check(t, err)
+
+	bridged := types.ServiceInterface{
+		Address:  "remote-echo",
+		Protocol: "tcp",
+		Port:     9090,
+		Origin:   "site-b",
+	}
+	conflicting := types.ServiceInterface{
+		Address:  "tcp-other",
+		Protocol: "tcp",
+		Port:     9090,
+		Origin:   "site-b",
+	}
+	controller.updateServiceBindings(bridged)
+	controller.updateServiceBindings(conflicting)
+	controller.updateProxies()
+	proxy, err := docker.InspectContainer("east-tcp-other", dd)
+	assert.Check(t, err)
+
+	// the proxy of the service left out of the bridge is kept from one pass to the next
+	controller.updateProxies()
+	current, err := docker.InspectContainer("east-tcp-other", dd)
+	assert.Check(t, err)
+	assert.Equal(t, current.ID, proxy.ID)
+
+	delete(controller.bindings, conflicting.Address)
+	controller.updateProxies()
+	_, err = docker.InspectContainer("east-tcp-other", dd)
+	assert.Assert(t, err != nil)
+}
+
+func TestSelectorTargets(t *testing.T) {
+	controller, dd := newFakeController(t)
+	for _, name := range []string{"web-1", "web-2", "web-3", "db"} {
+		labels := map[string]string{"app": "web", "tier": "front"}
+		if name == "db" {
+			labels = map[string]string{"app": "db"}
+		}
+		_, err := dd.CreateContainer(dockertypes.ContainerCreateConfig{
+			Name:   name,
+			Config: &dockercontainer.Config{Image: "quay.io/skupper/hello-world-frontend", Labels: labels},
+		})
+		assert.Check(t, err)
+		if name != "web-3" {
+			assert.Check(t, dd.StartContainer(name))
+		}
+	}
+	// a replica of another site on the same daemon
+	_, err := dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name: "east-web",
+		Config: &dockercontainer.Config{
+			Image:  "quay.io/skupper/hello-world-frontend",
+			Labels: map[string]string{"app": "web", "tier": "front", types.SiteQualifier: "east"},
+		},
+	})
+	assert.Check(t, err)
+	assert.Check(t, dd.StartContainer("east-web"))
+
+	service := types.ServiceInterface{
+		Address:  "web",
+		Protocol: "http",
+		Port:     8080,
+		Targets: []types.ServiceInterfaceTarget{
+			{
+				Name:     "app=web,tier=front",
+				Selector: "app=web,tier=front",
+			},
+		},
+	}
+	controller.updateServiceBindings(service)
+	controller.updateProxies()
+
+	connectors := func() []string {
+		proxy, err := docker.InspectContainer(service.Address, dd)
+		assert.Check(t, err)
+		config, err := qdr.UnmarshalRouterConfig(docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"))
+		assert.Check(t, err)
+		hosts := []string{}
+		for _, c := range config.Bridges.HttpConnectors {
+			hosts = append(hosts, c.Host)
+		}
+		sort.Strings(hosts)
+		return hosts
+	}
+	// only running replicas of the site get a connector
+	assert.DeepEqual(t, connectors(), []string{"web-1", "web-2"})
+	assert.Assert(t, isAttached(t, "web-1", controller))
+	assert.Assert(t, isAttached(t, "web-2", controller))
+
+	// a new replica is picked up when it starts
+	assert.Check(t, dd.StartContainer("web-3"))
+	controller.handleDockerEvent(dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: "start",
+		Actor:  dockerevents.Actor{Attributes: map[string]string{"name": "web-3", "app": "web", "tier": "front"}},
+	})
+	assert.DeepEqual(t, connectors(), []string{"web-1", "web-2", "web-3"})
+	assert.Assert(t, isAttached(t, "web-3", controller))
+
+	// and dropped when it goes away
+	assert.Check(t, dd.StopContainer("web-1", 0))
+	controller.handleDockerEvent(dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: "die",
+		Actor:  dockerevents.Actor{Attributes: map[string]string{"name": "web-1", "app": "web", "tier": "front"}},
+	})
+	assert.DeepEqual(t, connectors(), []string{"web-2", "web-3"})
+}
+
+func TestMultiPortProxy(t *testing.T) {
+	controller, dd := newFakeController(t)
+	_, err := dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name:   "db-server",
+		Config: &dockercontainer.Config{Image: "postgres"},
+	})
+	assert.Check(t, err)
+
+	service := types.ServiceInterface{
+		Address:  "db",
+		Protocol: "tcp",
+		Port:     5432,
+		Ports:    []int{5432, 5433},
+		Targets: []types.ServiceInterfaceTarget{
+			{
+				Name:        "db-server",
+				Selector:    "internal.skupper.io/container",
+				TargetPorts: map[int]int{5433: 6433},
+			},
+		},
+	}
+	controller.updateServiceBindings(service)
+	controller.updateProxies()
+
+	proxy, err := docker.InspectContainer(service.Address, dd)
+	assert.Check(t, err)
+	config, err := qdr.UnmarshalRouterConfig(docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"))
+	assert.Check(t, err)
+	listeners := []string{}
+	for _, l := range config.Bridges.TcpListeners {
+		listeners = append(listeners, l.Name+" "+l.Port+" "+l.Address)
+	}
+	sort.Strings(listeners)
+	assert.DeepEqual(t, listeners, []string{"ingress:5432 5432 db:5432", "ingress:5433 5433 db:5433"})
+	connectors := []string{}
+	for _, c := range config.Bridges.TcpConnectors {
+		connectors = append(connectors, c.Name+" "+c.Host+":"+c.Port+" "+c.Address)
+	}
+	sort.Strings(connectors)
+	assert.DeepEqual(t, connectors, []string{
+		"egress-db-server:5432 db-server:5432 db:5432",
+		"egress-db-server:5433 db-server:6433 db:5433",
+	})
+
+	// dropping back to a single port keeps the plain names
+	service.Ports = nil
+	service.Targets[0].TargetPorts = nil
+	controller.updateServiceBindings(service)
+	controller.updateProxies()
+	proxy, err = docker.InspectContainer(service.Address, dd)
+	assert.Check(t, err)
+	expected, _ := qdr.GetRouterConfigForProxy(service, "site-a")
+	assert.Equal(t, docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"), expected)
+	config, err = qdr.UnmarshalRouterConfig(expected)
+	assert.Check(t, err)
+	_, ok := config.Bridges.TcpListeners["ingress"]
+	assert.Assert(t, ok)
+}
+
+func TestHeadlessInstanceProxies(t *testing.T) {
+	controller, dd := newFakeController(t)
+	for _, name := range []string{"kafka-b", "kafka-a"} {
+		_, err := dd.CreateContainer(dockertypes.ContainerCreateConfig{
+			Name:   name,
+			Config: &dockercontainer.Config{Image: "kafka"},
+		})
+		assert.Check(t, err)
+	}
+
+	service := types.ServiceInterface{
+		Address:  "kafka",
+		Protocol: "tcp",
+		Port:     9092,
+		Headless: &types.Headless{Name: "kafka", Size: 2},
+		Targets: []types.ServiceInterfaceTarget{
+			{Name: "kafka-b", Selector: "internal.skupper.io/container"},
+			{Name: "kafka-a", Selector: "internal.skupper.io/container"},
+		},
+	}
+	controller.updateServiceBindings(service)
+	controller.updateProxies()
+
+	proxy, err := docker.InspectContainer("kafka", dd)
+	assert.Check(t, err)
+	config, err := qdr.UnmarshalRouterConfig(docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"))
+	assert.Check(t, err)
+	connectors := []string{}
+	for _, c := range config.Bridges.TcpConnectors {
+		connectors = append(connectors, c.Host+":"+c.Port+" "+c.Address)
+	}
+	sort.Strings(connectors)
+	assert.DeepEqual(t, connectors, []string{
+		"kafka-a:9092 kafka",
+		"kafka-a:9092 kafka-0.kafka",
+		"kafka-b:9092 kafka",
+		"kafka-b:9092 kafka-1.kafka",
+	})
+
+	for i, address := range []string{"kafka-0.kafka", "kafka-1.kafka"} {
+		proxy, err := docker.InspectContainer(address, dd)
+		assert.Check(t, err)
+		expected, _ := qdr.GetRouterConfigForHeadlessProxy(service, i, "site-a")
+		assert.Equal(t, docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"), expected)
+		config, err := qdr.UnmarshalRouterConfig(expected)
+		assert.Check(t, err)
+		assert.Equal(t, config.Bridges.TcpListeners["ingress"].Address, address)
+		assert.Equal(t, len(config.Bridges.TcpConnectors), 0)
+	}
+
+	// shrinking the service removes the proxy of the dropped instance
+	service.Headless = &types.Headless{Name: "kafka", Size: 1}
+	service.Targets = service.Targets[1:]
+	controller.updateServiceBindings(service)
+	controller.updateProxies()
+	_, err = docker.InspectContainer("kafka-0.kafka", dd)
+	assert.Check(t, err)
+	_, err = docker.InspectContainer("kafka-1.kafka", dd)
+	assert.Assert(t, err != nil)
+
+	// containers keep the instance they were given whatever their names
+	zero, two := 0, 2
+	service.Headless = &types.Headless{Name: "kafka", Size: 3}
+	service.Targets = []types.ServiceInterfaceTarget{
+		{Name: "kafka-b", Selector: "internal.skupper.io/container", Instance: &two},
+		{Name: "kafka-a", Selector: "internal.skupper.io/container", Instance: &zero},
+	}
+	controller.updateServiceBindings(service)
+	controller.updateProxies()
+	proxy, err = docker.InspectContainer("kafka", dd)
+	assert.Check(t, err)
+	config, err = qdr.UnmarshalRouterConfig(docker.FindEnvVar(proxy.Config.Env, "QDROUTERD_CONF"))
+	assert.Check(t, err)
+	connectors = []string{}
+	for _, c := range config.Bridges.TcpConnectors {
+		connectors = append(connectors, c.Host+":"+c.Port+" "+c.Address)
+	}
+	sort.Strings(connectors)
+	assert.DeepEqual(t, connectors, []string{
+		"kafka-a:9092 kafka",
+		"kafka-a:9092 kafka-0.kafka",
+		"kafka-b:9092 kafka",
+		"kafka-b:9092 kafka-2.kafka",
+	})
+}
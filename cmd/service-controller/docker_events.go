@@ -0,0 +1,199 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerevents "github.com/docker/docker/api/types/events"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+)
+
+// how long to wait before subscribing again after the event stream fails
+var eventsRetryInterval = 5 * time.Second
+
+func targetEventsOptions() dockertypes.EventsOptions {
+	filters := dockerfilters.NewArgs()
+	filters.Add("type", dockerevents.ContainerEventType)
+	filters.Add("type", dockerevents.NetworkEventType)
+	for _, action := range []string{"start", "die", "destroy", "rename", "disconnect"} {
+		filters.Add("event", action)
+	}
+	return dockertypes.EventsOptions{Filters: filters}
+}
+
+// watchDockerEvents forwards the container and network events relevant to
+// bound targets, subscribing again whenever the stream is interrupted
+func (c *Controller) watchDockerEvents(stopCh <-chan struct{}) <-chan dockerevents.Message {
+	events := make(chan dockerevents.Message)
+	go func() {
+		for {
+			subscription := make(chan struct{})
+			messages, errs := docker.Events(targetEventsOptions(), subscription, c.vanClient.DockerInterface)
+			err := forwardEvents(messages, errs, events, stopCh)
+			close(subscription)
+			if err == nil {
+				return
+			}
+			log.Println("Docker event stream failed, subscribing again: ", err.Error())
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(eventsRetryInterval):
+			}
+		}
+	}()
+	return events
+}
+
+func forwardEvents(messages <-chan dockerevents.Message, errs <-chan error, events chan<- dockerevents.Message, stopCh <-chan struct{}) error {
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case err := <-errs:
+			return err
+		case msg := <-messages:
+			select {
+			case events <- msg:
+			case <-stopCh:
+				return nil
+			}
+		}
+	}
+}
+
+// bindingsForTarget returns the sorted addresses of the local services
+// targeting the named container
+func (c *Controller) bindingsForTarget(name string) []string {
+	addresses := []string{}
+	for address, bindings := range c.bindings {
+		if bindings == nil || !types.IsLocalOrigin(bindings.origin) {
+			continue
+		}
+	targets:
+		for _, t := range bindings.targets {
+			for _, container := range t.containers() {
+				if container == name {
+					addresses = append(addresses, address)
+					break targets
+				}
+			}
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// retarget points the local service definitions at the new name of a
+// renamed container, the service definitions watcher then picks them up
+func retarget(oldName string, newName string) error {
+	svcDefs, err := getServiceDefinitions()
+	if err != nil {
+		return err
+	}
+	changed := []types.ServiceInterface{}
+	for _, si := range svcDefs {
+		if si.Origin != "" {
+			continue
+		}
+		updated := false
+		for i, t := range si.Targets {
+			if t.Selector == "internal.skupper.io/container" && t.Name == oldName {
+				si.Targets[i].Name = newName
+				updated = true
+			}
+		}
+		if updated {
+			changed = append(changed, si)
+		}
+	}
+	return updateSkupperServices(changed, nil, "")
+}
+
+func (c *Controller) handleContainerEvent(msg dockerevents.Message) {
+	name := strings.TrimPrefix(msg.Actor.Attributes["name"], "/")
+	switch msg.Action {
+	case "start":
+		if affected := c.bindingsForTarget(name); len(affected) > 0 {
+			log.Printf("Target container %s of %s started, re-evaluating bindings", name, strings.Join(affected, ", "))
+			c.updateProxies()
+		}
+	case "die":
+		if affected := c.bindingsForTarget(name); len(affected) > 0 {
+			log.Printf("Warning: target container %s of %s has stopped", name, strings.Join(affected, ", "))
+		}
+	case "destroy":
+		if affected := c.bindingsForTarget(name); len(affected) > 0 {
+			log.Printf("Warning: target container %s of %s no longer exists", name, strings.Join(affected, ", "))
+		}
+	case "rename":
+		oldName := strings.TrimPrefix(msg.Actor.Attributes["oldName"], "/")
+		if affected := c.bindingsForTarget(oldName); len(affected) > 0 {
+			log.Printf("Warning: target container %s of %s was renamed to %s, updating service definitions", oldName, strings.Join(affected, ", "), name)
+			if err := retarget(oldName, name); err != nil {
+				log.Println("Failed to update service definitions for renamed target: ", err.Error())
+			}
+		}
+		if affected := c.bindingsForTarget(name); len(affected) > 0 {
+			log.Printf("Container %s now matches target of %s, re-evaluating bindings", name, strings.Join(affected, ", "))
+			c.updateProxies()
+		}
+	}
+}
+
+func (c *Controller) handleNetworkEvent(msg dockerevents.Message) {
+	if msg.Action != "disconnect" || msg.Actor.Attributes["name"] != types.GetTransportNetworkName() {
+		return
+	}
+	// a destroyed container is reported by its own event
+	container, err := docker.InspectContainer(msg.Actor.Attributes["container"], c.vanClient.DockerInterface)
+	if err != nil {
+		return
+	}
+	// stopped containers keep their endpoint config and rejoin on start
+	if !container.State.Running {
+		return
+	}
+	name := strings.TrimPrefix(container.Name, "/")
+	if affected := c.bindingsForTarget(name); len(affected) > 0 {
+		log.Printf("Target container %s of %s was disconnected from %s, re-attaching it", name, strings.Join(affected, ", "), types.GetTransportNetworkName())
+		c.updateProxies()
+	}
+}
+
+// container events carry the container labels as attributes
+func isLabelledContainerEvent(msg dockerevents.Message) bool {
+	if _, ok := msg.Actor.Attributes["skupper.io/component"]; ok {
+		return false
+	}
+	if msg.Actor.Attributes[types.AddressQualifier] == "" || !docker.IsSiteContainer(msg.Actor.Attributes) {
+		return false
+	}
+	return msg.Action == "start" || msg.Action == "destroy" || msg.Action == "rename"
+}
+
+// handleDockerEvent runs on the controller loop, alongside the service
+// definitions watcher, so it can safely use the bindings
+func (c *Controller) handleDockerEvent(msg dockerevents.Message) {
+	switch msg.Type {
+	case dockerevents.ContainerEventType:
+		c.handleContainerEvent(msg)
+		// replicas of label selector targets come and go with containers
+		if c.resolveSelectorTargets() {
+			c.updateProxies()
+		}
+		if isLabelledContainerEvent(msg) {
+			if err := c.updateLabelledServices(); err != nil {
+				log.Println("Failed to update services from container labels: ", err.Error())
+			}
+		}
+	case dockerevents.NetworkEventType:
+		c.handleNetworkEvent(msg)
+	}
+}
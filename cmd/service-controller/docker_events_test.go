@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+)
+
+func isAttached(t *testing.T, name string, controller *Controller) bool {
+	sn, err := docker.InspectNetwork(types.TransportNetworkName, controller.vanClient.DockerInterface)
+	assert.Check(t, err)
+	for _, c := range sn.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandleDockerEvent(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "events")
+	assert.Check(t, err, "Unable to create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	serviceDefsPath = tmpDir + "/skupper-services"
+
+	controller, dd := newFakeController(t)
+	_, err = dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name:   "echo-server",
+		Config: &dockercontainer.Config{Image: "quay.io/skupper/tcp-go-echo"},
+	})
+	assert.Check(t, err)
+	assert.Check(t, dd.StartContainer("echo-server"))
+
+	local := types.ServiceInterface{
+		Address:  "tcp-go-echo",
+		Protocol: "tcp",
+		Port:     9090,
+		Targets: []types.ServiceInterfaceTarget{
+			{
+				Name:     "echo-server",
+				Selector: "internal.skupper.io/container",
+			},
+		},
+	}
+	encoded, _ := json.Marshal(map[string]types.ServiceInterface{local.Address: local})
+	assert.Check(t, ioutil.WriteFile(serviceDefsPath, encoded, 0755))
+	controller.updateServiceBindings(local)
+	controller.updateProxies()
+	assert.Assert(t, isAttached(t, "echo-server", controller))
+	assert.DeepEqual(t, controller.bindingsForTarget("echo-server"), []string{"tcp-go-echo"})
+	assert.DeepEqual(t, controller.bindingsForTarget("other"), []string{})
+
+	// a target disconnected from the skupper network is re-attached
+	assert.Check(t, dd.DisconnectContainerFromNetwork(types.TransportNetworkName, "echo-server", false))
+	target, err := docker.InspectContainer("echo-server", dd)
+	assert.Check(t, err)
+	controller.handleDockerEvent(dockerevents.Message{
+		Type:   dockerevents.NetworkEventType,
+		Action: "disconnect",
+		Actor: dockerevents.Actor{
+			ID:         "skupper-network-id",
+			Attributes: map[string]string{"name": types.TransportNetworkName, "container": target.ID},
+		},
+	})
+	assert.Assert(t, isAttached(t, "echo-server", controller), "target should be re-attached")
+
+	// a removed proxy is restored when the target starts again
+	assert.Check(t, controller.deleteProxy(local.Address))
+	controller.handleDockerEvent(dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: "start",
+		Actor:  dockerevents.Actor{ID: target.ID, Attributes: map[string]string{"name": "echo-server"}},
+	})
+	_, err = docker.InspectContainer(local.Address, dd)
+	assert.Check(t, err)
+
+	// renaming the target updates the service definitions
+	controller.handleDockerEvent(dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: "rename",
+		Actor:  dockerevents.Actor{ID: target.ID, Attributes: map[string]string{"name": "echo-renamed", "oldName": "/echo-server"}},
+	})
+	svcDefs, err := getServiceDefinitions()
+	assert.Check(t, err)
+	assert.Equal(t, svcDefs[local.Address].Targets[0].Name, "echo-renamed")
+}
+
+func TestWatchDockerEvents(t *testing.T) {
+	eventsRetryInterval = 10 * time.Millisecond
+	controller, dd := newFakeController(t)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	events := controller.watchDockerEvents(stopCh)
+	next := func(msg dockerevents.Message) dockerevents.Message {
+		// wait for the subscription to be in place before emitting
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			dd.EmitEvent(msg)
+			select {
+			case received := <-events:
+				return received
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		t.Fatal("timed out waiting for event")
+		return dockerevents.Message{}
+	}
+
+	start := dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: "start",
+		Actor:  dockerevents.Actor{ID: "abc", Attributes: map[string]string{"name": "echo-server"}},
+	}
+	assert.DeepEqual(t, next(start), start)
+
+	// unrelated actions are filtered out
+	dd.EmitEvent(dockerevents.Message{Type: dockerevents.ContainerEventType, Action: "pause"})
+	select {
+	case msg := <-events:
+		t.Fatalf("unexpected event %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the stream is subscribed again after a failure
+	dd.FailEvents(errors.New("connection reset"))
+	destroy := dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: "destroy",
+		Actor:  dockerevents.Actor{ID: "abc", Attributes: map[string]string{"name": "echo-server"}},
+	}
+	assert.DeepEqual(t, next(destroy), destroy)
+}
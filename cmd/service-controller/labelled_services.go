@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+)
+
+// getLabelledService builds the service a container asks for through its
+// skupper.io/address, skupper.io/port and skupper.io/protocol labels
+func getLabelledService(name string, labels map[string]string) (types.ServiceInterface, error) {
+	service := types.ServiceInterface{
+		Address:  labels[types.AddressQualifier],
+		Protocol: labels[types.ProtocolQualifier],
+		Origin:   types.ServiceLabelOrigin,
+		Targets: []types.ServiceInterfaceTarget{
+			{
+				Name:     name,
+				Selector: "internal.skupper.io/container",
+			},
+		},
+	}
+	if service.Protocol == "" {
+		service.Protocol = "tcp"
+	}
+	if service.Protocol != "tcp" && service.Protocol != "http" && service.Protocol != "http2" {
+		return service, fmt.Errorf("%s is not a valid mapping, choose tcp, http or http2", service.Protocol)
+	}
+	ports, ok := types.ParsePortLabel(labels[types.PortQualifier])
+	if !ok {
+		return service, fmt.Errorf("Invalid or missing %s label %q", types.PortQualifier, labels[types.PortQualifier])
+	}
+	service.SetPorts(ports)
+	return service, nil
+}
+
+// getLabelledServices collects the services requested by container labels,
+// containers sharing an address become targets of the same service
+func (c *Controller) getLabelledServices() (map[string]types.ServiceInterface, error) {
+	filters := dockerfilters.NewArgs()
+	filters.Add("label", types.AddressQualifier)
+	opts := dockertypes.ContainerListOptions{
+		Filters: filters,
+		All:     true,
+	}
+	containers, err := docker.ListContainers(opts, c.vanClient.DockerInterface)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list labelled containers: %w", err)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Names[0] < containers[j].Names[0]
+	})
+
+	services := map[string]types.ServiceInterface{}
+	for _, container := range containers {
+		// proxies carry the address label too
+		if _, ok := container.Labels["skupper.io/component"]; ok {
+			continue
+		}
+		// a container is exposed by the site named in its site label
+		if !docker.IsSiteContainer(container.Labels) {
+			continue
+		}
+		name := strings.TrimPrefix(container.Names[0], "/")
+		service, err := getLabelledService(name, container.Labels)
+		if err != nil {
+			log.Printf("Not exposing container %s: %s", name, err.Error())
+			continue
+		}
+		existing, ok := services[service.Address]
+		if !ok {
+			services[service.Address] = service
+			continue
+		}
+		if !reflect.DeepEqual(existing.GetPorts(), service.GetPorts()) || existing.Protocol != service.Protocol {
+			log.Printf("Not adding container %s to %s: its %s port %v differs from %s port %v", name, service.Address, service.Protocol, service.GetPorts(), existing.Protocol, existing.GetPorts())
+			continue
+		}
+		existing.Targets = append(existing.Targets, service.Targets...)
+		services[service.Address] = existing
+	}
+	return services, nil
+}
+
+// updateLabelledServices brings the service definitions with the label
+// origin in line with the labelled containers, services exposed through the
+// cli take precedence over labels
+func (c *Controller) updateLabelledServices() error {
+	desired, err := c.getLabelledServices()
+	if err != nil {
+		return err
+	}
+	current, err := getServiceDefinitions()
+	if err != nil {
+		return err
+	}
+
+	changed := []types.ServiceInterface{}
+	deleted := []string{}
+	for _, address := range sortedAddresses(desired) {
+		service := desired[address]
+		existing, ok := current[address]
+		if ok && existing.Origin == "" {
+			log.Printf("Service %s is already exposed, ignoring container labels for it", address)
+			continue
+		}
+		if !ok || !reflect.DeepEqual(existing, service) {
+			log.Printf("Exposing %s from container labels", address)
+			changed = append(changed, service)
+		}
+	}
+	for _, address := range sortedAddresses(current) {
+		if _, ok := desired[address]; !ok && current[address].Origin == types.ServiceLabelOrigin {
+			log.Printf("No container labelled for %s any more, removing it", address)
+			deleted = append(deleted, address)
+		}
+	}
+	return updateSkupperServices(changed, deleted, types.ServiceLabelOrigin)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+)
+
+func TestUpdateLabelledServices(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "labels")
+	assert.Check(t, err, "Unable to create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	serviceDefsPath = tmpDir + "/skupper-services"
+
+	exposed := types.ServiceInterface{
+		Address:  "web",
+		Protocol: "http",
+		Port:     8080,
+		Targets:  []types.ServiceInterfaceTarget{},
+	}
+	encoded, _ := json.Marshal(map[string]types.ServiceInterface{exposed.Address: exposed})
+	assert.Check(t, ioutil.WriteFile(serviceDefsPath, encoded, 0755))
+
+	controller, dd := newFakeController(t)
+	for name, labels := range map[string]map[string]string{
+		"db-1":      {types.AddressQualifier: "db", types.PortQualifier: "5432"},
+		"db-2":      {types.AddressQualifier: "db", types.PortQualifier: "5432", types.ProtocolQualifier: "tcp"},
+		"db-3":      {types.AddressQualifier: "db", types.PortQualifier: "5433"},
+		"api":       {types.AddressQualifier: "api", types.PortQualifier: "8080", types.ProtocolQualifier: "http"},
+		"bad-port":  {types.AddressQualifier: "bad", types.PortQualifier: "http"},
+		"bad-proto": {types.AddressQualifier: "bad", types.PortQualifier: "80", types.ProtocolQualifier: "udp"},
+		"web-2":     {types.AddressQualifier: "web", types.PortQualifier: "8080", types.ProtocolQualifier: "http"},
+		"a-proxy":   {types.AddressQualifier: "other", types.PortQualifier: "8080", "skupper.io/component": "proxy"},
+	} {
+		_, err := dd.CreateContainer(dockertypes.ContainerCreateConfig{
+			Name:   name,
+			Config: &dockercontainer.Config{Image: "quay.io/skupper/tcp-go-echo", Labels: labels},
+		})
+		assert.Check(t, err)
+	}
+
+	assert.Check(t, controller.updateLabelledServices())
+	svcDefs, err := getServiceDefinitions()
+	assert.Check(t, err)
+	assert.DeepEqual(t, sortedAddresses(svcDefs), []string{"api", "db", "web"})
+	assert.DeepEqual(t, svcDefs["db"], types.ServiceInterface{
+		Address:  "db",
+		Protocol: "tcp",
+		Port:     5432,
+		Origin:   types.ServiceLabelOrigin,
+		Targets: []types.ServiceInterfaceTarget{
+			{Name: "db-1", Selector: "internal.skupper.io/container"},
+			{Name: "db-2", Selector: "internal.skupper.io/container"},
+		},
+	})
+	assert.Equal(t, svcDefs["api"].Protocol, "http")
+	assert.DeepEqual(t, svcDefs["web"], exposed)
+
+	// labelled services are local, their targets get attached
+	controller.processServiceDefs()
+	assert.Assert(t, isAttached(t, "db-1", controller))
+	assert.Assert(t, isAttached(t, "db-2", controller))
+	_, err = docker.InspectContainer("db", dd)
+	assert.Check(t, err)
+
+	// removing the last labelled container removes the service
+	api, err := docker.InspectContainer("api", dd)
+	assert.Check(t, err)
+	assert.Check(t, dd.RemoveContainer("api", dockertypes.ContainerRemoveOptions{}))
+	controller.handleDockerEvent(dockerevents.Message{
+		Type:   dockerevents.ContainerEventType,
+		Action: "destroy",
+		Actor: dockerevents.Actor{
+			ID:         api.ID,
+			Attributes: map[string]string{"name": "api", types.AddressQualifier: "api"},
+		},
+	})
+	svcDefs, err = getServiceDefinitions()
+	assert.Check(t, err)
+	assert.DeepEqual(t, sortedAddresses(svcDefs), []string{"db", "web"})
+}
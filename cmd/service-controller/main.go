@@ -79,7 +79,11 @@ func main() {
 		log.Fatal("Error getting van client", err.Error())
 	}
 
-	tlsConfig, err := getTlsConfig(true, types.ControllerConfigPath+"tls.crt", types.ControllerConfigPath+"tls.key", types.ControllerConfigPath+"ca.crt")
+	configPath := types.ControllerConfigPath
+	if types.GetSkupperStorage() == types.StorageVolume {
+		configPath = "/etc/qpid-dispatch-certs/skupper/"
+	}
+	tlsConfig, err := getTlsConfig(true, configPath+"tls.crt", configPath+"tls.key", configPath+"ca.crt")
 	if err != nil {
 		log.Fatal("Error getting van client: ", err.Error())
 	}
@@ -90,7 +94,7 @@ func main() {
 	}
 
 	log.Println("Waiting for the Skupper router component to start")
-	_, err = docker.WaitForContainerStatus("skupper-router", "running", time.Second*180, time.Second*5, cli.DockerInterface)
+	_, err = docker.WaitForContainerStatus(types.GetTransportDeploymentName(), "running", time.Second*180, time.Second*5, cli.DockerInterface)
 	if err != nil {
 		log.Fatal("Failed waiting for router to be running", err.Error())
 	}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+// ControllerMetrics keeps the counters and gauges exposed on /metrics, the
+// controller loop and the service sync goroutines update it concurrently
+type ControllerMetrics struct {
+	lock          sync.Mutex
+	bindings      int
+	proxies       int
+	proxyCreated  int64
+	proxyDeleted  int64
+	proxyFailures int64
+	syncSent      map[string]int64
+	syncReceived  map[string]map[string]int64
+	agedOut       int64
+	heardFrom     map[string]time.Time
+	amqpConnected bool
+}
+
+func NewControllerMetrics() *ControllerMetrics {
+	return &ControllerMetrics{
+		syncSent:     map[string]int64{},
+		syncReceived: map[string]map[string]int64{},
+		heardFrom:    map[string]time.Time{},
+	}
+}
+
+func (m *ControllerMetrics) setBindings(bindings int, proxies int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bindings = bindings
+	m.proxies = proxies
+}
+
+func (m *ControllerMetrics) proxyWasCreated() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.proxyCreated++
+}
+
+func (m *ControllerMetrics) proxyWasDeleted() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.proxyDeleted++
+}
+
+func (m *ControllerMetrics) proxyFailed() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.proxyFailures++
+}
+
+func (m *ControllerMetrics) serviceSyncSent(subject string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.syncSent[subject]++
+}
+
+func (m *ControllerMetrics) serviceSyncReceived(origin string, subject string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.syncReceived[origin]; !ok {
+		m.syncReceived[origin] = map[string]int64{}
+	}
+	m.syncReceived[origin][subject]++
+}
+
+func (m *ControllerMetrics) heard(origin string, when time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.heardFrom[origin] = when
+}
+
+func (m *ControllerMetrics) originAgedOut(origin string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.agedOut++
+	delete(m.heardFrom, origin)
+}
+
+func (m *ControllerMetrics) setAmqpConnected(connected bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.amqpConnected = connected
+}
+
+func (m *ControllerMetrics) isAmqpConnected() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.amqpConnected
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeMetric(w io.Writer, name string, kind string, help string, samples map[string]string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	labels := []string{}
+	for k := range samples {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		fmt.Fprintf(w, "%s%s %s\n", name, l, samples[l])
+	}
+}
+
+func labels(pairs ...string) string {
+	parts := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", pairs[i], pairs[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+// WriteTo renders the metrics in the Prometheus text exposition format
+func (m *ControllerMetrics) WriteTo(w io.Writer, now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeMetric(w, "skupper_controller_bindings", "gauge", "Number of service bindings handled by the controller.",
+		map[string]string{"": strconv.Itoa(m.bindings)})
+	writeMetric(w, "skupper_controller_proxies", "gauge", "Number of proxy containers.",
+		map[string]string{"": strconv.Itoa(m.proxies)})
+	writeMetric(w, "skupper_controller_proxies_created_total", "counter", "Proxy containers created.",
+		map[string]string{"": formatInt(m.proxyCreated)})
+	writeMetric(w, "skupper_controller_proxies_deleted_total", "counter", "Proxy containers deleted.",
+		map[string]string{"": formatInt(m.proxyDeleted)})
+	writeMetric(w, "skupper_controller_proxy_failures_total", "counter", "Failures to create or update a proxy container.",
+		map[string]string{"": formatInt(m.proxyFailures)})
+
+	sent := map[string]string{}
+	for _, subject := range sortedKeys(m.syncSent) {
+		sent[labels("subject", subject)] = formatInt(m.syncSent[subject])
+	}
+	writeMetric(w, "skupper_controller_service_sync_sent_total", "counter", "Service sync messages sent.", sent)
+
+	received := map[string]string{}
+	for origin, bySubject := range m.syncReceived {
+		for subject, count := range bySubject {
+			received[labels("origin", origin, "subject", subject)] = formatInt(count)
+		}
+	}
+	writeMetric(w, "skupper_controller_service_sync_received_total", "counter", "Service sync messages received per origin.", received)
+
+	writeMetric(w, "skupper_controller_service_sync_aged_out_origins_total", "counter", "Origins whose services were dropped for not being heard from.",
+		map[string]string{"": formatInt(m.agedOut)})
+
+	heard := map[string]string{}
+	for origin, when := range m.heardFrom {
+		heard[labels("origin", origin)] = strconv.FormatFloat(now.Sub(when).Seconds(), 'f', 3, 64)
+	}
+	writeMetric(w, "skupper_controller_service_sync_last_heard_seconds", "gauge", "Seconds since a service sync message was last received from the origin.", heard)
+
+	connected := "0"
+	if m.amqpConnected {
+		connected = "1"
+	}
+	writeMetric(w, "skupper_controller_amqp_connected", "gauge", "Whether the service sync AMQP session to skupper-router is up.",
+		map[string]string{"": connected})
+}
+
+func (c *Controller) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+func (c *Controller) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.metrics.isAmqpConnected() {
+		http.Error(w, "service sync session to "+types.GetTransportDeploymentName()+" is not up", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (c *Controller) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.metrics.WriteTo(w, time.Now())
+}
+
+func (c *Controller) newHttpHandler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", c.healthzHandler)
+	mux.HandleFunc("/readyz", c.readyzHandler)
+	mux.HandleFunc("/metrics", c.metricsHandler)
+	return mux
+}
+
+func (c *Controller) runHttpServer(addr string) {
+	log.Println("Serving health and metrics on", addr)
+	err := http.ListenAndServe(addr, c.newHttpHandler())
+	if err != nil {
+		log.Println("Health and metrics server failed: ", err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+func get(t *testing.T, handler http.Handler, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	body, err := ioutil.ReadAll(recorder.Result().Body)
+	assert.Check(t, err)
+	return recorder.Code, string(body)
+}
+
+func TestHealthAndMetrics(t *testing.T) {
+	controller, _ := newFakeController(t)
+	handler := controller.newHttpHandler()
+
+	code, _ := get(t, handler, "/healthz")
+	assert.Equal(t, code, http.StatusOK)
+
+	// not ready until the service sync session is up
+	code, _ = get(t, handler, "/readyz")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	controller.metrics.setAmqpConnected(true)
+	code, _ = get(t, handler, "/readyz")
+	assert.Equal(t, code, http.StatusOK)
+
+	controller.updateServiceBindings(types.ServiceInterface{
+		Address:  "remote-echo",
+		Protocol: "tcp",
+		Port:     9090,
+		Origin:   "site-b",
+	})
+	controller.updateProxies()
+	controller.serviceSyncReceived(ServiceSyncHeartbeatSubject, map[string]interface{}{
+		"origin":     "site-b",
+		"generation": int64(1),
+	}, nil)
+	controller.metrics.heard("site-b", time.Now().Add(-10*time.Second))
+
+	code, body := get(t, handler, "/metrics")
+	assert.Equal(t, code, http.StatusOK)
+	for _, expected := range []string{
+		"# TYPE skupper_controller_bindings gauge",
+		"skupper_controller_bindings 1\n",
+		"skupper_controller_proxies 1\n",
+		"skupper_controller_proxies_created_total 1\n",
+		"skupper_controller_proxy_failures_total 0\n",
+		`skupper_controller_service_sync_received_total{origin="site-b",subject="service-sync-heartbeat"} 1`,
+		`skupper_controller_service_sync_last_heard_seconds{origin="site-b"} 10.`,
+		"skupper_controller_amqp_connected 1\n",
+	} {
+		assert.Assert(t, strings.Contains(body, expected), "missing %q in:\n%s", expected, body)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
 	"time"
 
 	amqp "github.com/interconnectedcloud/go-amqp"
@@ -18,6 +19,71 @@ type ServiceSyncUpdate struct {
 	indexed map[string]types.ServiceInterface
 }
 
+// Service sync message subjects. A site announces its full list of local
+// services in an update, and changes to that list in a delta. Both carry the
+// generation of the list, which heartbeats repeat so that peers that missed a
+// delta can ask the site for an update with a request.
+const (
+	ServiceSyncUpdateSubject    string = "service-sync-update"
+	ServiceSyncDeltaSubject     string = "service-sync-delta"
+	ServiceSyncRequestSubject   string = "service-sync-request"
+	ServiceSyncHeartbeatSubject string = "service-sync-heartbeat"
+)
+
+// ServiceSyncDelta is the body of a service-sync-delta message
+type ServiceSyncDelta struct {
+	Changed []types.ServiceInterface `json:"changed,omitempty"`
+	Deleted []string                 `json:"deleted,omitempty"`
+}
+
+func (d *ServiceSyncDelta) Empty() bool {
+	return len(d.Changed) == 0 && len(d.Deleted) == 0
+}
+
+// getServiceSyncDelta returns the changes that take peers from the sent
+// services to the current ones
+func getServiceSyncDelta(sent map[string]types.ServiceInterface, current map[string]types.ServiceInterface) ServiceSyncDelta {
+	delta := ServiceSyncDelta{}
+	for _, address := range sortedAddresses(current) {
+		def := current[address]
+		if previous, ok := sent[address]; !ok || !reflect.DeepEqual(previous, def) {
+			delta.Changed = append(delta.Changed, def)
+		}
+	}
+	for _, address := range sortedAddresses(sent) {
+		if _, ok := current[address]; !ok {
+			delta.Deleted = append(delta.Deleted, address)
+		}
+	}
+	return delta
+}
+
+func sortedAddresses(services map[string]types.ServiceInterface) []string {
+	addresses := []string{}
+	for address := range services {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// getGeneration reads the generation property of a service sync message,
+// updates from sites that predate generations have none
+func getGeneration(properties map[string]interface{}) (int64, bool) {
+	switch generation := properties["generation"].(type) {
+	case int64:
+		return generation, true
+	case uint64:
+		return int64(generation), true
+	case int32:
+		return int64(generation), true
+	case int:
+		return int64(generation), true
+	default:
+		return 0, false
+	}
+}
+
 func (c *Controller) pareByOrigin(service string) {
 	for _, origin := range c.byOrigin {
 		if _, ok := origin[service]; ok {
@@ -28,6 +94,7 @@ func (c *Controller) pareByOrigin(service string) {
 }
 
 func (c *Controller) serviceSyncDefinitionsUpdated(definitions map[string]types.ServiceInterface) {
+	c.syncLock.Lock()
 	latest := make(map[string]types.ServiceInterface) // becomes c.localServices
 	byName := make(map[string]types.ServiceInterface)
 	var added []types.ServiceInterface
@@ -39,11 +106,12 @@ func (c *Controller) serviceSyncDefinitionsUpdated(definitions map[string]types.
 			Address:  original.Address,
 			Protocol: original.Protocol,
 			Port:     original.Port,
+			Ports:    original.Ports,
 			Origin:   original.Origin,
 			Headless: original.Headless,
 			Targets:  []types.ServiceInterfaceTarget{},
 		}
-		if service.Origin != "" && service.Origin != "annotation" {
+		if !types.IsLocalOrigin(service.Origin) {
 			if _, ok := c.byOrigin[service.Origin]; !ok {
 				c.byOrigin[service.Origin] = make(map[string]types.ServiceInterface)
 			}
@@ -80,12 +148,40 @@ func (c *Controller) serviceSyncDefinitionsUpdated(definitions map[string]types.
 
 	c.localServices = latest
 	c.byName = byName
+	c.syncLock.Unlock()
+
+	// let peers know straight away rather than on the next heartbeat
+	if len(added) > 0 || len(removed) > 0 || len(modified) > 0 {
+		select {
+		case c.localChanged <- true:
+		default:
+		}
+	}
+}
+
+func (c *Controller) markHeard(origin string) {
+	now := time.Now()
+	c.heardFrom[origin] = now
+	c.metrics.heard(origin, now)
+}
+
+func (c *Controller) getLocalServices() map[string]types.ServiceInterface {
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+	local := make(map[string]types.ServiceInterface)
+	for address, si := range c.localServices {
+		local[address] = si
+	}
+	return local
 }
 
 func equivalentServiceDefinition(a *types.ServiceInterface, b *types.ServiceInterface) bool {
 	if a.Protocol != b.Protocol || a.Port != b.Port || a.EventChannel != b.EventChannel || a.Aggregate != b.Aggregate {
 		return false
 	}
+	if !reflect.DeepEqual(a.GetPorts(), b.GetPorts()) {
+		return false
+	}
 	if a.Headless == nil && b.Headless == nil {
 		return true
 	} else if a.Headless != nil && b.Headless != nil {
@@ -103,7 +199,7 @@ func (c *Controller) ensureServiceInterfaceDefinitions(origin string, serviceInt
 	var changed []types.ServiceInterface
 	var deleted []string
 
-	c.heardFrom[origin] = time.Now()
+	c.markHeard(origin)
 
 	for _, def := range serviceInterfaceDefs {
 		existing, ok := c.byName[def.Address]
@@ -138,10 +234,127 @@ func (c *Controller) ensureServiceInterfaceDefinitions(origin string, serviceInt
 	}
 }
 
-func (c *Controller) syncSender(sendLocal chan bool) {
-	var request amqp.Message
+// serviceSyncReceived applies a service sync message from a peer. It reports
+// whether the local services should be sent in full, and the origin whose
+// services should be requested because some of its changes were missed.
+func (c *Controller) serviceSyncReceived(subject string, properties map[string]interface{}, value interface{}) (bool, string) {
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	origin, ok := properties["origin"].(string)
+	if !ok {
+		log.Printf("Skupper service sync %s type assertion error", subject)
+		return false, ""
+	}
+	if origin == c.origin {
+		return false, ""
+	}
+	c.metrics.serviceSyncReceived(origin, subject)
+	generation, hasGeneration := getGeneration(properties)
+
+	switch subject {
+	case ServiceSyncRequestSubject:
+		target, _ := properties["target"].(string)
+		if target == "" || target == c.origin {
+			log.Println("Controller received service sync request from", origin)
+			return true, ""
+		}
+	case ServiceSyncUpdateSubject:
+		updates, ok := value.(string)
+		if !ok {
+			log.Printf("Skupper service sync update from %s was not a string", origin)
+			return false, ""
+		}
+		defs := []types.ServiceInterface{}
+		err := json.Unmarshal([]byte(updates), &defs)
+		if err != nil {
+			log.Printf("Skupper service sync update from %s was not valid json: %s", origin, err)
+			return false, ""
+		}
+		indexed := make(map[string]types.ServiceInterface)
+		for _, def := range defs {
+			def.Origin = origin
+			indexed[def.Address] = def
+		}
+		c.received[origin] = indexed
+		if hasGeneration {
+			c.generations[origin] = generation
+			delete(c.legacyPeers, origin)
+		} else {
+			delete(c.generations, origin)
+			c.legacyPeers[origin] = time.Now()
+		}
+		c.ensureServiceInterfaceDefinitions(origin, indexed)
+	case ServiceSyncDeltaSubject:
+		known, isKnown := c.generations[origin]
+		if isKnown && hasGeneration && generation <= known {
+			// already applied
+			c.markHeard(origin)
+			return false, ""
+		}
+		if !isKnown || !hasGeneration || generation != known+1 {
+			log.Printf("Skupper service sync missed changes from %s, requesting update", origin)
+			return false, origin
+		}
+		updates, ok := value.(string)
+		if !ok {
+			log.Printf("Skupper service sync delta from %s was not a string", origin)
+			return false, origin
+		}
+		delta := ServiceSyncDelta{}
+		err := json.Unmarshal([]byte(updates), &delta)
+		if err != nil {
+			log.Printf("Skupper service sync delta from %s was not valid json: %s", origin, err)
+			return false, origin
+		}
+		indexed := make(map[string]types.ServiceInterface)
+		for name, def := range c.received[origin] {
+			indexed[name] = def
+		}
+		for _, def := range delta.Changed {
+			def.Origin = origin
+			indexed[def.Address] = def
+		}
+		for _, name := range delta.Deleted {
+			delete(indexed, name)
+		}
+		c.received[origin] = indexed
+		c.generations[origin] = generation
+		c.ensureServiceInterfaceDefinitions(origin, indexed)
+	case ServiceSyncHeartbeatSubject:
+		c.markHeard(origin)
+		if known, ok := c.generations[origin]; !ok || !hasGeneration || known != generation {
+			log.Printf("Skupper service sync out of date for %s, requesting update", origin)
+			return false, origin
+		}
+	default:
+		log.Println("Service sync subject not valid")
+	}
+	return false, ""
+}
+
+func (c *Controller) newServiceSyncMessage(subject string, value interface{}) *amqp.Message {
 	var properties amqp.MessageProperties
+	properties.Subject = subject
+	return &amqp.Message{
+		Properties: &properties,
+		ApplicationProperties: map[string]interface{}{
+			"origin":     c.origin,
+			"generation": c.generation,
+		},
+		Value: value,
+	}
+}
 
+func (c *Controller) sendServiceSync(ctx context.Context, sender *amqp.Sender, msg *amqp.Message) error {
+	err := sender.Send(ctx, msg)
+	if err == nil {
+		c.metrics.serviceSyncSent(msg.Properties.Subject)
+	}
+	return err
+}
+
+func (c *Controller) syncSender(sendLocal chan bool, requests chan string) {
 	ctx := context.Background()
 	sender, err := c.amqpSession.NewSender(amqp.LinkTargetAddress(types.ServiceSyncAddress))
 	if err != nil {
@@ -151,64 +364,150 @@ func (c *Controller) syncSender(sendLocal chan bool) {
 		sender.Close(ctx)
 	}()
 
-	tickerSend := time.NewTicker(5 * time.Second)
+	tickerHeartbeat := time.NewTicker(5 * time.Second)
 	tickerAge := time.NewTicker(30 * time.Second)
+	// sites that predate deltas only count a peer as heard on a full update,
+	// so while any is around one goes out well within their 60 second age out
+	tickerUpdate := time.NewTicker(20 * time.Second)
+
+	// the local services as last announced to peers
+	sent := make(map[string]types.ServiceInterface)
+
+	sendUpdate := func() error {
+		current := c.getLocalServices()
+		delta := getServiceSyncDelta(sent, current)
+		if !delta.Empty() {
+			c.generation++
+		}
+		local := make([]types.ServiceInterface, 0)
+		for _, address := range sortedAddresses(current) {
+			local = append(local, current[address])
+		}
+		encoded, err := json.Marshal(local)
+		if err != nil {
+			return fmt.Errorf("Failed to create json for service definition sync: %w", err)
+		}
+		sent = current
+		return c.sendServiceSync(ctx, sender, c.newServiceSyncMessage(ServiceSyncUpdateSubject, string(encoded)))
+	}
+	sendDelta := func() error {
+		current := c.getLocalServices()
+		delta := getServiceSyncDelta(sent, current)
+		if delta.Empty() {
+			return nil
+		}
+		encoded, err := json.Marshal(delta)
+		if err != nil {
+			return fmt.Errorf("Failed to create json for service definition sync: %w", err)
+		}
+		c.generation++
+		sent = current
+		return c.sendServiceSync(ctx, sender, c.newServiceSyncMessage(ServiceSyncDeltaSubject, string(encoded)))
+	}
 
-	properties.Subject = "service-sync-update"
-	request.Properties = &properties
-	request.ApplicationProperties = make(map[string]interface{})
-	request.ApplicationProperties["origin"] = c.origin
+	// announce the local services and catch up with everyone else
+	if err := sendUpdate(); err != nil {
+		log.Println("Failed to send service sync update: ", err.Error())
+	}
+	if err := c.sendServiceSync(ctx, sender, c.newServiceSyncMessage(ServiceSyncRequestSubject, nil)); err != nil {
+		log.Println("Failed to send service sync request: ", err.Error())
+	}
 
 	for {
 		select {
-		case <-tickerSend.C:
-			local := make([]types.ServiceInterface, 0)
+		case <-sendLocal:
+			if err := sendUpdate(); err != nil {
+				log.Println("Failed to send service sync update: ", err.Error())
+			}
 
-			for _, si := range c.localServices {
-				local = append(local, si)
+		case <-c.localChanged:
+			if err := sendDelta(); err != nil {
+				log.Println("Failed to send service sync delta: ", err.Error())
 			}
 
-			encoded, err := json.Marshal(local)
-			if err != nil {
-				log.Println("Failed to create json for service definition sync: ", err.Error())
-				return
+		case origin := <-requests:
+			request := c.newServiceSyncMessage(ServiceSyncRequestSubject, nil)
+			request.ApplicationProperties["target"] = origin
+			if err := c.sendServiceSync(ctx, sender, request); err != nil {
+				log.Println("Failed to send service sync request: ", err.Error())
+			}
+
+		case <-tickerHeartbeat.C:
+			if err := sendDelta(); err != nil {
+				log.Println("Failed to send service sync delta: ", err.Error())
+			}
+			if err := c.sendServiceSync(ctx, sender, c.newServiceSyncMessage(ServiceSyncHeartbeatSubject, nil)); err != nil {
+				log.Println("Failed to send service sync heartbeat: ", err.Error())
+			}
+
+		case <-tickerUpdate.C:
+			if !c.hasLegacyPeers(time.Now()) {
+				continue
+			}
+			if err := sendUpdate(); err != nil {
+				log.Println("Failed to send service sync update: ", err.Error())
 			}
-			request.Value = string(encoded)
-			err = sender.Send(ctx, &request)
 
 		case <-tickerAge.C:
-			var agedOrigins []string
-
-			now := time.Now()
-
-			for origin, _ := range c.byOrigin {
-				var deleted []string
-
-				if lastHeard, ok := c.heardFrom[origin]; ok {
-					if now.Sub(lastHeard) >= 60*time.Second {
-						agedOrigins = append(agedOrigins, origin)
-						agedDefinitions := c.byOrigin[origin]
-						for name, _ := range agedDefinitions {
-							deleted = append(deleted, name)
-						}
-						if len(deleted) > 0 {
-							err := updateSkupperServices([]types.ServiceInterface{}, deleted, origin)
-							if err != nil {
-								log.Println("Failed to update service definitions: ", err.Error())
-								return
-							}
-						}
-					}
-				}
+			if err := c.ageOrigins(time.Now()); err != nil {
+				log.Println("Failed to update service definitions: ", err.Error())
+				return
 			}
+		}
+	}
+}
 
-			for _, originName := range agedOrigins {
-				log.Println("Service sync aged out service definitions from origin ", originName)
-				delete(c.heardFrom, originName)
-				delete(c.byOrigin, originName)
+// hasLegacyPeers reports whether a site that predates deltas has sent an
+// update within the last minute, such sites need full updates to keep
+// counting this one as heard from
+func (c *Controller) hasLegacyPeers(now time.Time) bool {
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+	for _, lastUpdate := range c.legacyPeers {
+		if now.Sub(lastUpdate) < 60*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+// ageOrigins removes the service definitions of origins that have not been
+// heard from for a minute
+func (c *Controller) ageOrigins(now time.Time) error {
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	var agedOrigins []string
+	for origin, _ := range c.byOrigin {
+		var deleted []string
+
+		if lastHeard, ok := c.heardFrom[origin]; ok {
+			if now.Sub(lastHeard) >= 60*time.Second {
+				agedOrigins = append(agedOrigins, origin)
+				agedDefinitions := c.byOrigin[origin]
+				for name, _ := range agedDefinitions {
+					deleted = append(deleted, name)
+				}
+				if len(deleted) > 0 {
+					err := updateSkupperServices([]types.ServiceInterface{}, deleted, origin)
+					if err != nil {
+						return err
+					}
+				}
 			}
 		}
 	}
+
+	for _, originName := range agedOrigins {
+		log.Println("Service sync aged out service definitions from origin ", originName)
+		c.metrics.originAgedOut(originName)
+		delete(c.heardFrom, originName)
+		delete(c.byOrigin, originName)
+		delete(c.received, originName)
+		delete(c.generations, originName)
+		delete(c.legacyPeers, originName)
+	}
+	return nil
 }
 
 func (c *Controller) runServiceSync() error {
@@ -228,6 +527,8 @@ func (c *Controller) runServiceSync() error {
 	if err != nil {
 		return fmt.Errorf("Failed to create amqp session: %w", err)
 	}
+	c.metrics.setAmqpConnected(true)
+	defer c.metrics.setAmqpConnected(false)
 
 	receiver, err := c.amqpSession.NewReceiver(
 		amqp.LinkSourceAddress(types.ServiceSyncAddress),
@@ -242,12 +543,11 @@ func (c *Controller) runServiceSync() error {
 		cancel()
 	}()
 
-	sendLocal := make(chan bool)
-	go c.syncSender(sendLocal)
+	sendLocal := make(chan bool, 1)
+	requests := make(chan string, 10)
+	go c.syncSender(sendLocal, requests)
 
 	for {
-		var ok bool
-		var origin string
 		msg, err := receiver.Receive(ctx)
 		if err != nil {
 			return fmt.Errorf("Failed reading message from service sync %w", err)
@@ -255,36 +555,22 @@ func (c *Controller) runServiceSync() error {
 		// Decode message as it is either a request to send update
 		// or it is a receipt that needs to be reconciled
 		msg.Accept()
-		subject := msg.Properties.Subject
-
-		if subject == "service-sync-request" {
-			log.Println("Controller received service sync request")
-			//sendLocal <- true
-		} else if subject == "service-sync-update" {
-			if origin, ok = msg.ApplicationProperties["origin"].(string); ok {
-				if origin != c.origin {
-					if updates, ok := msg.Value.(string); ok {
-						defs := []types.ServiceInterface{}
-						err := json.Unmarshal([]byte(updates), &defs)
-						if err == nil {
-							indexed := make(map[string]types.ServiceInterface)
-							for _, def := range defs {
-								def.Origin = origin
-								indexed[def.Address] = def
-							}
-							c.ensureServiceInterfaceDefinitions(origin, indexed)
-						} else {
-							log.Printf("Skupper service sync update from %s was not valid json: %s", origin, err)
-						}
-					} else {
-						log.Printf("Skupper service sync update from %s was not a string", origin)
-					}
-				}
-			} else {
-				log.Println("Skupper service sync update type assertion error")
-			}
-		} else {
+		if msg.Properties == nil {
 			log.Println("Service sync subject not valid")
+			continue
+		}
+		snapshot, request := c.serviceSyncReceived(msg.Properties.Subject, msg.ApplicationProperties, msg.Value)
+		if snapshot {
+			select {
+			case sendLocal <- true:
+			default:
+			}
+		}
+		if request != "" {
+			select {
+			case requests <- request:
+			default:
+			}
 		}
 	}
 }
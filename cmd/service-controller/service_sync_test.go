@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+)
+
+func TestGetServiceSyncDelta(t *testing.T) {
+	sent := map[string]types.ServiceInterface{
+		"a": {Address: "a", Protocol: "tcp", Port: 8080},
+		"b": {Address: "b", Protocol: "tcp", Port: 8081},
+		"c": {Address: "c", Protocol: "http", Port: 8082},
+	}
+	current := map[string]types.ServiceInterface{
+		"a": {Address: "a", Protocol: "tcp", Port: 8080},
+		"b": {Address: "b", Protocol: "tcp", Port: 9091},
+		"d": {Address: "d", Protocol: "tcp", Port: 8083},
+	}
+	delta := getServiceSyncDelta(sent, current)
+	assert.DeepEqual(t, delta.Changed, []types.ServiceInterface{current["b"], current["d"]})
+	assert.DeepEqual(t, delta.Deleted, []string{"c"})
+	assert.Assert(t, !delta.Empty())
+
+	delta = getServiceSyncDelta(current, current)
+	assert.Assert(t, delta.Empty())
+}
+
+func TestServiceSyncReceived(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "servicesync")
+	assert.Check(t, err, "Unable to create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	serviceDefsPath = tmpDir + "/skupper-services"
+	assert.Check(t, ioutil.WriteFile(serviceDefsPath, []byte("{}"), 0755))
+
+	controller, _ := newFakeController(t)
+	received := func(subject string, generation int64, value interface{}) (bool, string) {
+		properties := map[string]interface{}{
+			"origin":     "site-b",
+			"generation": generation,
+		}
+		snapshot, request := controller.serviceSyncReceived(subject, properties, value)
+		// pick up the definitions as the watcher would
+		defs, err := getServiceDefinitions()
+		assert.Check(t, err)
+		controller.serviceSyncDefinitionsUpdated(defs)
+		return snapshot, request
+	}
+	encode := func(v interface{}) string {
+		encoded, err := json.Marshal(v)
+		assert.Check(t, err)
+		return string(encoded)
+	}
+	addresses := func() []string {
+		defs, err := getServiceDefinitions()
+		assert.Check(t, err)
+		return sortedAddresses(defs)
+	}
+
+	// a full update replaces whatever was known about the origin
+	snapshot, request := received(ServiceSyncUpdateSubject, 3, encode([]types.ServiceInterface{
+		{Address: "a", Protocol: "tcp", Port: 8080},
+		{Address: "b", Protocol: "tcp", Port: 8081},
+	}))
+	assert.Assert(t, !snapshot)
+	assert.Equal(t, request, "")
+	assert.DeepEqual(t, addresses(), []string{"a", "b"})
+	assert.Equal(t, controller.generations["site-b"], int64(3))
+
+	// the next delta is applied on top of it
+	_, request = received(ServiceSyncDeltaSubject, 4, encode(ServiceSyncDelta{
+		Changed: []types.ServiceInterface{{Address: "c", Protocol: "http", Port: 8082}},
+		Deleted: []string{"a"},
+	}))
+	assert.Equal(t, request, "")
+	assert.DeepEqual(t, addresses(), []string{"b", "c"})
+	defs, _ := getServiceDefinitions()
+	assert.Equal(t, defs["c"].Origin, "site-b")
+
+	// a replayed delta is ignored
+	_, request = received(ServiceSyncDeltaSubject, 4, encode(ServiceSyncDelta{Deleted: []string{"b"}}))
+	assert.Equal(t, request, "")
+	assert.DeepEqual(t, addresses(), []string{"b", "c"})
+
+	// a gap in generations means an update is needed
+	_, request = received(ServiceSyncDeltaSubject, 6, encode(ServiceSyncDelta{Deleted: []string{"b"}}))
+	assert.Equal(t, request, "site-b")
+	assert.DeepEqual(t, addresses(), []string{"b", "c"})
+
+	// so does a heartbeat for a generation not seen
+	_, request = received(ServiceSyncHeartbeatSubject, 4, nil)
+	assert.Equal(t, request, "")
+	_, request = received(ServiceSyncHeartbeatSubject, 6, nil)
+	assert.Equal(t, request, "site-b")
+
+	// requests are answered unless aimed at another site
+	snapshot, _ = received(ServiceSyncRequestSubject, 0, nil)
+	assert.Assert(t, snapshot)
+	snapshot, _ = controller.serviceSyncReceived(ServiceSyncRequestSubject, map[string]interface{}{
+		"origin": "site-b",
+		"target": "site-c",
+	}, nil)
+	assert.Assert(t, !snapshot)
+	snapshot, _ = controller.serviceSyncReceived(ServiceSyncRequestSubject, map[string]interface{}{
+		"origin": "site-a",
+	}, nil)
+	assert.Assert(t, !snapshot, "own requests should be ignored")
+
+	// updates from sites without generations still apply in full
+	_, request = controller.serviceSyncReceived(ServiceSyncUpdateSubject, map[string]interface{}{
+		"origin": "site-c",
+	}, encode([]types.ServiceInterface{{Address: "d", Protocol: "tcp", Port: 8083}}))
+	assert.Equal(t, request, "")
+	assert.DeepEqual(t, addresses(), []string{"b", "c", "d"})
+	_, ok := controller.generations["site-c"]
+	assert.Assert(t, !ok)
+}
+
+func TestServiceSyncAgeOrigins(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "servicesync")
+	assert.Check(t, err, "Unable to create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	serviceDefsPath = tmpDir + "/skupper-services"
+	assert.Check(t, ioutil.WriteFile(serviceDefsPath, []byte("{}"), 0755))
+
+	controller, _ := newFakeController(t)
+	update, err := json.Marshal([]types.ServiceInterface{{Address: "a", Protocol: "tcp", Port: 8080}})
+	assert.Check(t, err)
+
+	// the receiver and the aging run on their own goroutines, go test -race
+	// reports any unguarded access
+	done := make(chan bool)
+	go func() {
+		for i := int64(0); i < 100; i++ {
+			controller.serviceSyncReceived(ServiceSyncUpdateSubject, map[string]interface{}{
+				"origin":     "site-b",
+				"generation": i,
+			}, string(update))
+			defs, err := getServiceDefinitions()
+			assert.Check(t, err)
+			controller.serviceSyncDefinitionsUpdated(defs)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Check(t, controller.ageOrigins(time.Now().Add(time.Minute)))
+	}
+	<-done
+
+	// an origin heard from within the last minute is kept
+	assert.Check(t, controller.ageOrigins(time.Now()))
+	defs, err := getServiceDefinitions()
+	assert.Check(t, err)
+	assert.DeepEqual(t, sortedAddresses(defs), []string{"a"})
+	_, ok := controller.received["site-b"]
+	assert.Assert(t, ok)
+
+	// and dropped once it has been silent for longer
+	assert.Check(t, controller.ageOrigins(time.Now().Add(time.Minute)))
+	defs, err = getServiceDefinitions()
+	assert.Check(t, err)
+	assert.Equal(t, len(defs), 0)
+	_, ok = controller.received["site-b"]
+	assert.Assert(t, !ok)
+	_, ok = controller.generations["site-b"]
+	assert.Assert(t, !ok)
+}
+
+func TestServiceSyncLegacyPeers(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "servicesync")
+	assert.Check(t, err, "Unable to create temporary directory")
+	defer os.RemoveAll(tmpDir)
+	serviceDefsPath = tmpDir + "/skupper-services"
+	assert.Check(t, ioutil.WriteFile(serviceDefsPath, []byte("{}"), 0755))
+
+	controller, _ := newFakeController(t)
+	update, err := json.Marshal([]types.ServiceInterface{{Address: "a", Protocol: "tcp", Port: 8080}})
+	assert.Check(t, err)
+
+	// peers that send generations catch up through heartbeats and requests,
+	// so no full update goes out periodically
+	controller.serviceSyncReceived(ServiceSyncUpdateSubject, map[string]interface{}{
+		"origin":     "site-b",
+		"generation": int64(1),
+	}, string(update))
+	controller.serviceSyncReceived(ServiceSyncHeartbeatSubject, map[string]interface{}{
+		"origin":     "site-b",
+		"generation": int64(1),
+	}, nil)
+	assert.Assert(t, !controller.hasLegacyPeers(time.Now()))
+
+	// an update without a generation comes from a site that predates deltas
+	controller.serviceSyncReceived(ServiceSyncUpdateSubject, map[string]interface{}{
+		"origin": "site-c",
+	}, string(update))
+	assert.Assert(t, controller.hasLegacyPeers(time.Now()))
+	assert.Assert(t, !controller.hasLegacyPeers(time.Now().Add(time.Minute)))
+
+	// until it is upgraded
+	controller.serviceSyncReceived(ServiceSyncUpdateSubject, map[string]interface{}{
+		"origin":     "site-c",
+		"generation": int64(1),
+	}, string(update))
+	assert.Assert(t, !controller.hasLegacyPeers(time.Now()))
+
+	// or aged out
+	controller.serviceSyncReceived(ServiceSyncUpdateSubject, map[string]interface{}{
+		"origin": "site-d",
+	}, string(update))
+	assert.Check(t, controller.ageOrigins(time.Now().Add(time.Minute)))
+	_, ok := controller.legacyPeers["site-d"]
+	assert.Assert(t, !ok)
+}
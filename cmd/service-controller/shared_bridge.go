@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker"
+	"github.com/skupperproject/skupper-docker/pkg/qdr"
+)
+
+// the bridge router reads its config from the services directory, which is
+// mounted into both the controller and the bridge container
+var bridgeConfigPath = "/etc/messaging/services/" + types.BridgeConfigFile
+
+// partitionBindings splits the bindings between those hosted in the shared
+// bridge router and those still needing a proxy of their own, which are the
+// ones whose port is already taken in the bridge
+func (c *Controller) partitionBindings() ([]*ServiceBindings, map[string]*ServiceBindings) {
+	addresses := []string{}
+	for address := range c.bindings {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	bridged := []*ServiceBindings{}
+	proxied := map[string]*ServiceBindings{}
+	ports := map[int]string{}
+	for _, address := range addresses {
+		bindings := c.bindings[address]
+		if bindings == nil {
+			continue
+		}
+		conflict := false
+		for _, port := range bindings.ports {
+			if other, ok := ports[port]; ok {
+				log.Printf("Port %d of %s is already used by %s in the shared bridge, deploying a separate proxy", port, address, other)
+				conflict = true
+				break
+			}
+		}
+		if conflict {
+			proxied[address] = bindings
+			continue
+		}
+		for _, port := range bindings.ports {
+			ports[port] = address
+		}
+		bridged = append(bridged, bindings)
+	}
+	return bridged, proxied
+}
+
+func (c *Controller) createBridge(services []types.ServiceInterface) error {
+	bridgeContainer, err := docker.NewBridgeContainer(services, os.Getenv("SKUPPER_MAP_TO_HOST") != "", c.vanClient.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to create bridge container: %w", err)
+	}
+	err = docker.StartContainer(bridgeContainer.Name, c.vanClient.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to start bridge container: %w", err)
+	}
+	c.metrics.proxyWasCreated()
+	return nil
+}
+
+func (c *Controller) recreateBridge(services []types.ServiceInterface) error {
+	err := c.deleteProxy(types.BridgeDeploymentName)
+	if err != nil {
+		return fmt.Errorf("Failed to delete bridge container: %w", err)
+	}
+	return c.createBridge(services)
+}
+
+// ensureBridgeFor brings the shared bridge router in line with the bindings,
+// applying changes to the running router where possible
+func (c *Controller) ensureBridgeFor(bindings []*ServiceBindings) error {
+	current, inspectErr := docker.InspectContainer(types.GetBridgeDeploymentName(), c.vanClient.DockerInterface)
+	if len(bindings) == 0 {
+		if inspectErr == nil {
+			log.Println("Removing shared bridge router")
+			return c.deleteProxy(types.BridgeDeploymentName)
+		}
+		return nil
+	}
+
+	services := []types.ServiceInterface{}
+	desired := qdr.NewBridgeConfig()
+	for _, b := range bindings {
+		if types.IsLocalOrigin(b.origin) {
+			if err := c.attachTargets(b); err != nil {
+				return err
+			}
+		}
+		serviceInterface := asServiceInterface(b)
+		services = append(services, serviceInterface)
+		desired.Merge(qdr.GetBridgeConfigForService(serviceInterface, c.origin))
+	}
+
+	previous, previousErr := qdr.GetRouterConfigFromFile(bridgeConfigPath)
+	config := qdr.GetRouterConfigForBridge(desired, c.origin)
+	err := config.WriteToConfigFile(bridgeConfigPath)
+	if err != nil {
+		return fmt.Errorf("Failed to write bridge config: %w", err)
+	}
+
+	if inspectErr != nil {
+		log.Println("Deploying shared bridge router")
+		return c.createBridge(services)
+	}
+	covers, err := docker.BridgeContainerCovers(current, services, os.Getenv("SKUPPER_MAP_TO_HOST") != "", c.vanClient.DockerInterface)
+	if err != nil {
+		return fmt.Errorf("Failed to check bridge container: %w", err)
+	}
+	if !covers || previousErr != nil || !current.State.Running {
+		log.Println("Re-creating shared bridge router")
+		return c.recreateBridge(services)
+	}
+
+	changed, err := qdr.UpdateRouterBridges(types.GetBridgeDeploymentName(), previous, desired, c.vanClient.DockerInterface)
+	if err != nil {
+		log.Println("Failed to update running bridge router, re-creating it: ", err.Error())
+		return c.recreateBridge(services)
+	}
+	if changed {
+		log.Println("Updated shared bridge router")
+	}
+	return nil
+}
+
+// updateBridge is the shared bridge counterpart of updateProxies
+func (c *Controller) updateBridge() {
+	bridged, proxied := c.partitionBindings()
+	for _, v := range proxied {
+		err := c.ensureProxyFor(v)
+		if err != nil {
+			log.Println("Unable to ensure proxy container: ", err.Error())
+			c.metrics.proxyFailed()
+		}
+	}
+	err := c.ensureBridgeFor(bridged)
+	if err != nil {
+		log.Println("Unable to ensure bridge container: ", err.Error())
+		c.metrics.proxyFailed()
+	}
+	// instances of headless services share their ports, so keep proxies of their own
+	c.ensureInstanceProxies()
+	proxies := c.getProxies()
+	for name := range proxies {
+		if _, ok := proxied[name]; ok {
+			continue
+		}
+		if _, ok := c.bindings[name]; !ok && c.isDesiredProxy(name) {
+			continue
+		}
+		c.deleteProxy(name)
+	}
+	c.recordProxyState()
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/skupperproject/skupper-docker/api/types"
 	"github.com/skupperproject/skupper-docker/client"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+	"github.com/skupperproject/skupper-docker/pkg/utils"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"sigs.k8s.io/yaml"
 )
 
 var version = "undefined"
@@ -77,16 +87,23 @@ func expose(cli types.VanClientInterface, targetType string, targetName string,
 	if service == nil {
 		service = &types.ServiceInterface{
 			Address:  serviceName,
-			Port:     options.Port,
 			Protocol: options.Protocol,
 		}
+		service.SetPorts(options.Ports)
+		if options.Headless {
+			service.Headless = &types.Headless{
+				Name: serviceName,
+			}
+		}
 	} else if options.Protocol != "" && service.Protocol != options.Protocol {
 		return fmt.Errorf("Invalid protocol %s for service with mapping %s", options.Protocol, service.Protocol)
+	} else if options.Headless && service.Headless == nil {
+		return fmt.Errorf("Service %s already exists and is not headless", serviceName)
 	}
 
 	// service may exist from remote origin
 	service.Origin = ""
-	err = cli.ServiceInterfaceBind(service, targetType, targetName, options.Protocol, options.TargetPort)
+	err = cli.ServiceInterfaceBind(service, targetType, targetName, options.Protocol, options.TargetPorts)
 
 	if err != nil {
 		return fmt.Errorf("Unable to create skupper service: %w", err)
@@ -94,6 +111,27 @@ func expose(cli types.VanClientInterface, targetType string, targetName string,
 	return nil
 }
 
+func formatPorts(ports []int) string {
+	formatted := []string{}
+	for _, port := range ports {
+		formatted = append(formatted, strconv.Itoa(port))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// parsePorts reads a comma separated list of ports
+func parsePorts(value string) ([]int, error) {
+	ports := []int{}
+	for _, p := range strings.Split(value, ",") {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid port", p)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
 func stringSliceContains(s []string, e string) bool {
 	for _, a := range s {
 		if a == e {
@@ -103,7 +141,7 @@ func stringSliceContains(s []string, e string) bool {
 	return false
 }
 
-var validExposeTargets = []string{"container", "host-service"}
+var validExposeTargets = []string{"container", "host-service", "selector"}
 
 func verifyTargetTypeFromArgs(args []string) error {
 	targetType, _ := parseTargetTypeAndName(args)
@@ -159,6 +197,47 @@ func silenceCobra(cmd *cobra.Command) {
 	cmd.SilenceUsage = true
 }
 
+var outputFormat string
+
+var validOutputFormats = []string{"table", "json", "yaml"}
+
+var validRuntimes = []string{"docker", "podman"}
+
+func verifyOutputFormat(cmd *cobra.Command, args []string) error {
+	if !stringSliceContains(validOutputFormats, outputFormat) {
+		return fmt.Errorf("output format must be one of: [%s]", strings.Join(validOutputFormats, ", "))
+	}
+	return nil
+}
+
+func verifyRuntime(cmd *cobra.Command, args []string) error {
+	if containerRuntime != "" && !stringSliceContains(validRuntimes, containerRuntime) {
+		return fmt.Errorf("runtime must be one of: [%s]", strings.Join(validRuntimes, ", "))
+	}
+	return nil
+}
+
+func isTableOutput() bool {
+	return outputFormat == "table"
+}
+
+// printStructured writes the result of a read command in the requested
+// machine-readable format, the json tags of the api types define the schema
+func printStructured(result interface{}) error {
+	var data []byte
+	var err error
+	if outputFormat == "yaml" {
+		data, err = yaml.Marshal(result)
+	} else {
+		data, err = json.MarshalIndent(result, "", "    ")
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to encode %s output: %w", outputFormat, err)
+	}
+	fmt.Println(strings.TrimSuffix(string(data), "\n"))
+	return nil
+}
+
 var routerCreateOpts types.SiteConfigSpec
 
 func NewCmdInit(newClient cobraFunc) *cobra.Command {
@@ -171,11 +250,24 @@ installation that can then be connected to other skupper installations`,
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
+			generated := false
+			if routerCreateOpts.EnableConsole && routerCreateOpts.Password == "" && (routerCreateOpts.AuthMode == "" || routerCreateOpts.AuthMode == string(types.ConsoleAuthModeInternal)) {
+				// shown only here, console-user set-password replaces a lost one
+				routerCreateOpts.Password = utils.RandomId(10)
+				generated = true
+			}
 			err := cli.RouterCreate(routerCreateOpts)
 			if err != nil {
 				return err
 			}
 			fmt.Println("Skupper is now installed.  Use 'skupper-docker status' to get more information.")
+			if generated {
+				user := routerCreateOpts.User
+				if user == "" {
+					user = "admin"
+				}
+				fmt.Printf("The password of console user %s is %s, it is not shown again.\n", user, routerCreateOpts.Password)
+			}
 			return nil
 		},
 	}
@@ -189,6 +281,8 @@ installation that can then be connected to other skupper installations`,
 	cmd.Flags().StringVarP(&routerCreateOpts.User, "console-user", "", "", "Router console user. Valid only when --console-auth=internal")
 	cmd.Flags().StringVarP(&routerCreateOpts.Password, "console-password", "", "", "Skupper console user. Valid only when --router-console-auth=internal")
 	cmd.Flags().BoolVarP(&routerCreateOpts.MapToHost, "publish-to-host", "", false, "Port map services to host")
+	cmd.Flags().BoolVarP(&routerCreateOpts.SharedBridge, "shared-bridge", "", false, "Run the bridges of all services in one router instead of a proxy container per service")
+	cmd.Flags().StringVarP(&routerCreateOpts.Storage, "storage", "", os.Getenv("SKUPPER_STORAGE"), "Where to keep the site state, one of: 'host', 'volume'. Defaults to host directories under SKUPPER_TMPDIR for a local daemon, volumes for a remote one")
 	cmd.Flags().BoolVarP(&routerCreateOpts.TraceLog, "enable-trace-log", "", false, "Enable router trace log")
 	cmd.Flags().MarkHidden("enable-trace-log")
 
@@ -301,7 +395,12 @@ func NewCmdListConnectors(newClient cobraFunc) *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
 			connectors, err := cli.ConnectorList()
-			if err == nil {
+			if err == nil && !isTableOutput() {
+				if connectors == nil {
+					connectors = []*types.Connector{}
+				}
+				return printStructured(connectors)
+			} else if err == nil {
 				if len(connectors) == 0 {
 					fmt.Println("There are no connectors defined.")
 				} else {
@@ -365,6 +464,13 @@ func NewCmdCheckConnection(newClient cobraFunc) *cobra.Command {
 				time.Sleep(time.Second)
 			}
 
+			if !isTableOutput() {
+				if connectors == nil {
+					connectors = []*types.ConnectorInspectResponse{}
+				}
+				return printStructured(connectors)
+			}
+
 			if len(connectors) == 0 {
 				if args[0] == "all" {
 					fmt.Println("There are no connectors configured or active")
@@ -400,7 +506,9 @@ func NewCmdStatus(newClient cobraFunc) *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
 			vir, err := cli.RouterInspect()
-			if err == nil {
+			if err == nil && !isTableOutput() {
+				return printStructured(vir)
+			} else if err == nil {
 				var modedesc string = " in interior mode"
 				if vir.Status.Mode == types.TransportModeEdge {
 					modedesc = " in edge mode"
@@ -432,8 +540,10 @@ func NewCmdStatus(newClient cobraFunc) *cobra.Command {
 				} else {
 					fmt.Printf(" It has %d exposed services.", vir.ExposedServices)
 				}
-				//TODO: provide console url
 				fmt.Println()
+				if vir.ConsoleUrl != "" {
+					fmt.Printf("The site console url is: %s\n", vir.ConsoleUrl)
+				}
 			} else {
 				return fmt.Errorf("Unable to retrieve skupper status: %w", err)
 			}
@@ -447,7 +557,7 @@ var exposeOpts types.ServiceInterfaceCreateOptions
 
 func NewCmdExpose(newClient cobraFunc) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:    "expose [container <name>|host-service]",
+		Use:    "expose [container <name>|host-service|selector <key=value>]",
 		Short:  "Expose a service through a Skupper address",
 		Args:   exposeTargetArgs,
 		PreRun: newClient,
@@ -457,8 +567,8 @@ func NewCmdExpose(newClient cobraFunc) *cobra.Command {
 			targetType, targetName := parseTargetTypeAndName(args)
 
 			if exposeOpts.Address == "" {
-				if targetType == "host-service" {
-					return fmt.Errorf("--address option is required for target type 'service'")
+				if targetType == "host-service" || targetType == "selector" {
+					return fmt.Errorf("--address option is required for target type '%s'", targetType)
 				}
 				exposeOpts.Address = targetName
 			}
@@ -472,8 +582,9 @@ func NewCmdExpose(newClient cobraFunc) *cobra.Command {
 	}
 	cmd.Flags().StringVar(&(exposeOpts.Protocol), "protocol", "tcp", "The protocol to proxy (tcp, http, or http2)")
 	cmd.Flags().StringVar(&(exposeOpts.Address), "address", "", "The Skupper address to expose")
-	cmd.Flags().IntVar(&(exposeOpts.Port), "port", 0, "The port to expose on")
-	cmd.Flags().IntVar(&(exposeOpts.TargetPort), "target-port", 0, "The port to target on pods")
+	cmd.Flags().IntSliceVar(&(exposeOpts.Ports), "port", []int{}, "The port to expose on, repeat it for a service with several ports")
+	cmd.Flags().IntSliceVar(&(exposeOpts.TargetPorts), "target-port", []int{}, "The port to target on pods, repeat it to match each --port")
+	cmd.Flags().BoolVar(&(exposeOpts.Headless), "headless", false, "Give each container bound to the service an address of its own (tcp only)")
 
 	return cmd
 }
@@ -482,7 +593,7 @@ var unexposeAddress string
 
 func NewCmdUnexpose(newClient cobraFunc) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:    "unexpose [container <name>|host-service <name>]",
+		Use:    "unexpose [container <name>|host-service <name>|selector <key=value>]",
 		Short:  "Unexpose a set of pods previously exposed through a Skupper address",
 		Args:   exposeTargetArgs,
 		PreRun: newClient,
@@ -491,8 +602,8 @@ func NewCmdUnexpose(newClient cobraFunc) *cobra.Command {
 
 			targetType, targetName := parseTargetTypeAndName(args)
 
-			if targetType == "host-service" && unexposeAddress == "" {
-				return fmt.Errorf("Unexpose host-service must specify address, use --address option to provide it")
+			if (targetType == "host-service" || targetType == "selector") && unexposeAddress == "" {
+				return fmt.Errorf("Unexpose %s must specify address, use --address option to provide it", targetType)
 			}
 
 			err := cli.ServiceInterfaceUnbind(targetType, targetName, unexposeAddress, true)
@@ -518,21 +629,26 @@ func NewCmdListExposed(newClient cobraFunc) *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
 			vsis, err := cli.ServiceInterfaceList()
-			if err == nil {
+			if err == nil && !isTableOutput() {
+				if vsis == nil {
+					vsis = []types.ServiceInterface{}
+				}
+				return printStructured(vsis)
+			} else if err == nil {
 				if len(vsis) == 0 {
 					fmt.Println("No service interfaces defined")
 				} else {
 					fmt.Println("Services exposed through Skupper:")
 					for _, si := range vsis {
 						if len(si.Targets) == 0 {
-							fmt.Printf("    %s (%s port %d)", si.Address, si.Protocol, si.Port)
+							fmt.Printf("    %s (%s port %s)", si.Address, si.Protocol, formatPorts(si.GetPorts()))
 							fmt.Println()
 						} else {
-							fmt.Printf("    %s (%s port %d) with targets", si.Address, si.Protocol, si.Port)
+							fmt.Printf("    %s (%s port %s) with targets", si.Address, si.Protocol, formatPorts(si.GetPorts()))
 							fmt.Println()
 							for _, t := range si.Targets {
 								var name string
-								if t.Name != "" {
+								if t.Name != "" && t.Name != t.Selector {
 									name = fmt.Sprintf("name=%s", t.Name)
 								}
 								fmt.Printf("      => %s %s", t.Selector, name)
@@ -569,7 +685,7 @@ var serviceToCreate types.ServiceInterface
 
 func NewCmdCreateService(newClient cobraFunc) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:    "create <name> <port>",
+		Use:    "create <name> <port>[,<port>...]",
 		Short:  "Create a skupper service",
 		Args:   createServiceArgs,
 		PreRun: newClient,
@@ -584,11 +700,11 @@ func NewCmdCreateService(newClient cobraFunc) *cobra.Command {
 				serviceToCreate.Address = args[0]
 				sPort = args[1]
 			}
-			servicePort, err := strconv.Atoi(sPort)
+			servicePorts, err := parsePorts(sPort)
 			if err != nil {
-				return fmt.Errorf("%s is not a valid port", sPort)
+				return err
 			} else {
-				serviceToCreate.Port = servicePort
+				serviceToCreate.SetPorts(servicePorts)
 				err = cli.ServiceInterfaceCreate(&serviceToCreate)
 				if err != nil {
 					return fmt.Errorf("%w", err)
@@ -622,7 +738,7 @@ func NewCmdDeleteService(newClient cobraFunc) *cobra.Command {
 	return cmd
 }
 
-var targetPort int
+var targetPorts []int
 var protocol string
 
 func NewCmdBind(newClient cobraFunc) *cobra.Command {
@@ -645,7 +761,7 @@ func NewCmdBind(newClient cobraFunc) *cobra.Command {
 				} else if service == nil {
 					return fmt.Errorf("Service %s not found", args[0])
 				} else {
-					err = cli.ServiceInterfaceBind(service, targetType, targetName, protocol, targetPort)
+					err = cli.ServiceInterfaceBind(service, targetType, targetName, protocol, targetPorts)
 					if err != nil {
 						return fmt.Errorf("%w", err)
 					}
@@ -655,7 +771,7 @@ func NewCmdBind(newClient cobraFunc) *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVar(&protocol, "protocol", "", "The protocol to proxy (tcp, http or http2).")
-	cmd.Flags().IntVar(&targetPort, "target-port", 0, "The port the target is listening on.")
+	cmd.Flags().IntSliceVar(&targetPorts, "target-port", []int{}, "The port the target is listening on, repeat it to match each port of the service.")
 
 	return cmd
 }
@@ -690,23 +806,754 @@ func NewCmdVersion(newClient cobraFunc) *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
 			vir, err := cli.RouterInspect()
+			if err != nil {
+				err = fmt.Errorf("Unable to retrieve skupper component versions: %w", err)
+			}
+			if !isTableOutput() {
+				// the client version is known whatever the state of the site
+				result := types.VersionInspectResponse{
+					ClientVersion: version,
+				}
+				if err == nil {
+					result.TransportVersion = vir.TransportVersion
+					result.ControllerVersion = vir.ControllerVersion
+				} else {
+					result.Error = err.Error()
+				}
+				if printErr := printStructured(result); printErr != nil {
+					return printErr
+				}
+				return err
+			}
 			fmt.Printf("%-30s %s\n", "client version", version)
-			if err == nil {
-				fmt.Printf("%-30s %s\n", "transport version", vir.TransportVersion)
-				fmt.Printf("%-30s %s\n", "controller version", vir.ControllerVersion)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-30s %s\n", "transport version", vir.TransportVersion)
+			fmt.Printf("%-30s %s\n", "controller version", vir.ControllerVersion)
+			return nil
+		},
+	}
+	return cmd
+}
+
+var routerUpdateOpts types.RouterUpdateOptions
+
+func NewCmdUpdate(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Move the router, controller and proxies of the site onto new images",
+		Long: `update pulls the router and controller images and re-creates the skupper containers on them,
+keeping the site id, certificates, connections and services. Images default to the ones the
+site runs, pulled again to pick up a newer build of the same tag.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			updates, err := cli.RouterUpdate(routerUpdateOpts)
+			if err == nil && !isTableOutput() {
+				return printStructured(updates)
+			}
+			for _, u := range updates {
+				if u.AfterVersion == "" {
+					continue
+				}
+				if u.Updated {
+					fmt.Printf("%-30s %s => %s\n", u.Name, u.BeforeVersion, u.AfterVersion)
+				} else {
+					fmt.Printf("%-30s %s (unchanged)\n", u.Name, u.AfterVersion)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("Unable to update skupper site: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&routerUpdateOpts.RouterImage, "router-image", "", "", "The router image to run, also used for proxies")
+	cmd.Flags().StringVarP(&routerUpdateOpts.ControllerImage, "controller-image", "", "", "The controller image to run")
+
+	return cmd
+}
+
+var certRotationOpts types.CertRotationOptions
+
+func printIssuedTokens(tokens []types.IssuedToken) {
+	for _, t := range tokens {
+		fmt.Printf("    %s (client identity %s, issued %s)\n", t.File, t.Subject, t.Issued)
+	}
+}
+
+func NewCmdRotateCerts(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate-certs",
+		Short: "Replace the site certificate authorities and the credentials they issued",
+		Long: `rotate-certs generates new skupper-ca and skupper-internal-ca authorities, re-issues the
+skupper-amqps, skupper and skupper-internal credentials and restarts the containers using them.
+Connection tokens issued by this site before the rotation are no longer accepted, unless
+--keep-old-ca is used to keep trusting the previous CA until 'rotate-certs --finish'.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			result, err := cli.RouterRotateCerts(certRotationOpts)
+			if err != nil {
+				return fmt.Errorf("Unable to rotate certificates: %w", err)
+			}
+			if !isTableOutput() {
+				return printStructured(result)
+			}
+			if len(result.RotatedCAs) > 0 {
+				fmt.Println("Rotated certificate authorities:", strings.Join(result.RotatedCAs, ", "))
+			}
+			fmt.Println("Re-issued credentials:", strings.Join(result.Credentials, ", "))
+			fmt.Println("Restarted containers:", strings.Join(result.Restarted, ", "))
+			if len(result.InvalidatedTokens) > 0 {
+				fmt.Println("Connection tokens no longer accepted by this site:")
+				printIssuedTokens(result.InvalidatedTokens)
+			}
+			if result.OldCATrusted {
+				fmt.Println("The previous CA is still trusted, connections from remote sites keep working until 'rotate-certs --finish'.")
+				if len(result.TrustedTokens) > 0 {
+					fmt.Println("Connection tokens accepted until then:")
+					printIssuedTokens(result.TrustedTokens)
+				}
+			} else if len(result.RotatedCAs) > 0 {
+				fmt.Println("Any connection token issued by this site before now is no longer accepted, remote sites need a new token.")
+			}
+			if result.UntrackedTokens {
+				fmt.Println("This site issued connection tokens before it kept a record of them, tokens not listed here may be affected too.")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&certRotationOpts.KeepOldCA, "keep-old-ca", "", false, "Keep accepting connections from tokens issued by the previous CA")
+	cmd.Flags().BoolVarP(&certRotationOpts.Finish, "finish", "", false, "Stop trusting the previous CA kept by an earlier --keep-old-ca rotation")
+
+	return cmd
+}
+
+func readSiteManifest(file string) (*types.SiteManifest, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read manifest: %w", err)
+	}
+	manifest := &types.SiteManifest{}
+	err = yaml.UnmarshalStrict(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse manifest %s: %w", file, err)
+	}
+	// tokens are relative to the manifest rather than the working directory
+	for i, conn := range manifest.Connections {
+		if conn.Token != "" && !filepath.IsAbs(conn.Token) {
+			manifest.Connections[i].Token = filepath.Join(filepath.Dir(file), conn.Token)
+		}
+	}
+	return manifest, nil
+}
+
+var manifestFile string
+var applyOpts types.SiteManifestApplyOptions
+
+var composeFile string
+var composeProject string
+
+func readComposeBindings() ([]client.ComposeBinding, error) {
+	compose, err := client.ReadComposeFile(composeFile)
+	if err != nil {
+		return nil, err
+	}
+	project, err := client.GetComposeProjectName(composeFile, composeProject, compose)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetComposeBindings(compose, project), nil
+}
+
+func NewCmdCompose() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compose expose|unexpose -f <docker-compose.yml>",
+		Short: "Expose the services of a docker compose project",
+	}
+	cmd.PersistentFlags().StringVarP(&composeFile, "file", "f", "docker-compose.yml", "The compose file of the project")
+	cmd.PersistentFlags().StringVarP(&composeProject, "project-name", "p", "", "The compose project name, defaults to the name of the directory of the compose file")
+	return cmd
+}
+
+func NewCmdComposeExpose(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "expose",
+		Short: "Expose the containers of every compose service with an x-skupper block",
+		Long: `expose reads the x-skupper block (address, port, protocol) of each service in the compose
+file and binds every container of that compose service to the Skupper address, including
+containers added later by scaling the service.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			bindings, err := readComposeBindings()
+			if err != nil {
+				return err
+			}
+			if len(bindings) == 0 {
+				return fmt.Errorf("No service of %s has an x-skupper block", composeFile)
+			}
+			for _, binding := range bindings {
+				err = expose(cli, "selector", binding.Selector, binding.Options)
+				if err != nil {
+					return fmt.Errorf("Unable to expose compose service %s: %w", binding.Service, err)
+				}
+				fmt.Printf("compose service %s exposed as %s\n", binding.Service, binding.Options.Address)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func NewCmdComposeUnexpose(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "unexpose",
+		Short:  "Unexpose the compose services previously exposed with 'compose expose'",
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			bindings, err := readComposeBindings()
+			if err != nil {
+				return err
+			}
+			for _, binding := range bindings {
+				err = cli.ServiceInterfaceUnbind("selector", binding.Selector, binding.Options.Address, true)
+				if err != nil {
+					return fmt.Errorf("Unable to unexpose compose service %s: %w", binding.Service, err)
+				}
+				fmt.Printf("compose service %s unexposed\n", binding.Service)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func NewCmdApply(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply -f <manifest>",
+		Short: "Reconcile the site with a declarative manifest of site options, services and connections",
+		Long: `apply creates the site if needed, then creates or updates the services and connections
+described in a YAML or JSON manifest. With --prune, locally defined services and connections
+that are not listed in the manifest are removed.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			if manifestFile == "" {
+				return fmt.Errorf("A manifest must be specified with --filename")
+			}
+			manifest, err := readSiteManifest(manifestFile)
+			if err != nil {
+				return err
+			}
+			changes, err := cli.SiteManifestApply(manifest, applyOpts)
+			if !isTableOutput() {
+				if perr := printStructured(changes); perr != nil {
+					return perr
+				}
 			} else {
-				return fmt.Errorf("Unable to retrieve skupper component versions: %w", err)
+				if len(changes) == 0 {
+					fmt.Println("Site is up to date with the manifest")
+				} else if applyOpts.DryRun {
+					fmt.Println("Planned changes (dry run):")
+				}
+				for _, c := range changes {
+					line := fmt.Sprintf("    %s %s %s", c.Action, c.Kind, c.Name)
+					if c.Detail != "" {
+						line = line + " (" + c.Detail + ")"
+					}
+					if !applyOpts.DryRun && !c.Applied {
+						line = line + " [not applied]"
+					}
+					fmt.Println(line)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to apply manifest: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&manifestFile, "filename", "f", "", "The YAML or JSON site manifest to apply")
+	cmd.Flags().BoolVar(&applyOpts.Prune, "prune", false, "Remove local services and connections that are not listed in the manifest")
+	cmd.Flags().BoolVar(&applyOpts.DryRun, "dry-run", false, "Only print the changes that would be made")
+
+	return cmd
+}
+
+func NewCmdDebug() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug dump <file.tar.gz>",
+		Short: "Debug skupper installation",
+	}
+	return cmd
+}
+
+func NewCmdDebugDump(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "dump <file.tar.gz>",
+		Short:  "Collect and save skupper logs, config files and router state to a support bundle",
+		Args:   requiredArg("save file"),
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			file, err := cli.SkupperDump(args[0], version)
+			if err != nil {
+				return fmt.Errorf("Unable to save skupper dump details: %w", err)
 			}
+			fmt.Println("Skupper dump details written to compressed archive: ", file)
 			return nil
 		},
 	}
 	return cmd
 }
 
+func NewCmdConsoleUser() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "console-user",
+		Short: "Manage the users of the site consoles (--console-auth=internal)",
+	}
+	return cmd
+}
+
+var consoleUserPasswordStdin bool
+
+// readConsolePassword reads the password of a console user from standard
+// input, prompting for it twice without echo when that is a terminal
+func readConsolePassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("Failed to read password: %w", err)
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", fmt.Errorf("No password given on standard input")
+		}
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read password: %w", err)
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirmed, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read password: %w", err)
+	}
+	if len(password) == 0 {
+		return "", fmt.Errorf("The password cannot be empty")
+	}
+	if string(password) != string(confirmed) {
+		return "", fmt.Errorf("The passwords do not match")
+	}
+	return string(password), nil
+}
+
+// consolePassword is the password given for a console user, or an empty one
+// to have it generated
+func consolePassword() (string, error) {
+	if !consoleUserPasswordStdin {
+		return "", nil
+	}
+	return readConsolePassword()
+}
+
+// printConsolePassword shows a generated password, which is not stored
+// anywhere it could be read back from
+func printConsolePassword(user string, password string) {
+	if !consoleUserPasswordStdin {
+		fmt.Printf("The password of console user %s is %s, it is not shown again.\n", user, password)
+	}
+}
+
+func NewCmdConsoleUserAdd(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "add <user>",
+		Short:  "Add a console user, with a generated password unless --password-stdin is given",
+		Args:   requiredArg("user"),
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			password, err := consolePassword()
+			if err != nil {
+				return err
+			}
+			password, err = cli.ConsoleUserAdd(args[0], password)
+			if err != nil {
+				return fmt.Errorf("Unable to add console user: %w", err)
+			}
+			fmt.Println("Console user '" + args[0] + "' has been added")
+			printConsolePassword(args[0], password)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&consoleUserPasswordStdin, "password-stdin", false, "Read the password of the user from standard input, prompting for it on a terminal. Generated if not given")
+	return cmd
+}
+
+func NewCmdConsoleUserSetPassword(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "set-password <user>",
+		Short:  "Change the password of a console user, to a generated one unless --password-stdin is given",
+		Args:   requiredArg("user"),
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			password, err := consolePassword()
+			if err != nil {
+				return err
+			}
+			password, err = cli.ConsoleUserSetPassword(args[0], password)
+			if err != nil {
+				return fmt.Errorf("Unable to set console user password: %w", err)
+			}
+			fmt.Println("Password of console user '" + args[0] + "' has been changed")
+			printConsolePassword(args[0], password)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&consoleUserPasswordStdin, "password-stdin", false, "Read the new password of the user from standard input, prompting for it on a terminal. Generated if not given")
+	return cmd
+}
+
+func NewCmdConsoleUserRemove(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "remove <user>",
+		Short:  "Remove a console user",
+		Args:   requiredArg("user"),
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			err := cli.ConsoleUserRemove(args[0])
+			if err != nil {
+				return fmt.Errorf("Unable to remove console user: %w", err)
+			}
+			fmt.Println("Console user '" + args[0] + "' has been removed")
+			return nil
+		},
+	}
+	return cmd
+}
+
+func NewCmdConsoleUserList(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "list",
+		Short:  "List the console users",
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			users, err := cli.ConsoleUserList()
+			if err != nil {
+				return fmt.Errorf("Unable to retrieve console users: %w", err)
+			}
+			if !isTableOutput() {
+				return printStructured(users)
+			}
+			if len(users) == 0 {
+				fmt.Println("There are no console users defined.")
+				return nil
+			}
+			fmt.Println("Console users:")
+			for _, user := range users {
+				fmt.Println("    " + user)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+var statsWatch bool
+var statsInterval time.Duration
+
+func printStats(stats []types.ServiceInterfaceStats) {
+	if len(stats) == 0 {
+		fmt.Println("No service interfaces defined")
+		return
+	}
+	fmt.Printf("%-30s %-8s %8s %8s %10s %12s %12s %6s\n", "ADDRESS", "PROTOCOL", "ACTIVE", "TOTAL", "REQUESTS", "BYTES IN", "BYTES OUT", "LINKS")
+	for _, s := range stats {
+		fmt.Printf("%-30s %-8s %8d %8d %10d %12d %12d %6d\n", s.Address, s.Protocol, s.ActiveConnections, s.TotalConnections, s.Requests, s.BytesIn, s.BytesOut, s.Links)
+	}
+}
+
+func NewCmdStats(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show traffic statistics for the services exposed over the Skupper network",
+		Long: `stats reports, for each service, the open and total tcp connections, http requests and bytes
+carried by the proxies of this site, along with the number of router links for the service address.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			for {
+				stats, err := cli.ServiceInterfaceStats()
+				if err != nil {
+					return fmt.Errorf("Could not retrieve service statistics: %w", err)
+				}
+				if statsWatch && isTableOutput() {
+					// clear the terminal so the table refreshes in place
+					fmt.Print("\033[H\033[2J")
+					fmt.Printf("Every %s: skupper-docker stats\n\n", statsInterval)
+				}
+				if !isTableOutput() {
+					if err := printStructured(stats); err != nil {
+						return err
+					}
+				} else {
+					printStats(stats)
+				}
+				if !statsWatch {
+					return nil
+				}
+				time.Sleep(statsInterval)
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&statsWatch, "watch", "w", false, "Keep refreshing the statistics")
+	cmd.Flags().DurationVarP(&statsInterval, "interval", "", 2*time.Second, "Time between refreshes in watch mode")
+	return cmd
+}
+
+var networkStatusFormat string
+
+func getSiteLabel(siteName string, siteId string) string {
+	if siteId == "" {
+		return "unknown site"
+	} else if siteName == "" {
+		return siteId
+	}
+	return fmt.Sprintf("%s (%s)", siteName, siteId)
+}
+
+func getSiteServices(status *types.NetworkStatusResponse, siteId string) []string {
+	for _, site := range status.Sites {
+		if site.SiteId == siteId {
+			return site.Services
+		}
+	}
+	return nil
+}
+
+// printNetworkTree shows the routers of the network as a tree rooted at the
+// site router, each router hanging off its next hop
+func printNetworkTree(status *types.NetworkStatusResponse) {
+	children := map[string][]types.NetworkRouterStatus{}
+	var root *types.NetworkRouterStatus
+	for i, r := range status.Routers {
+		if r.Local {
+			root = &status.Routers[i]
+		}
+	}
+	if root == nil {
+		fmt.Println("Site router not found in the network")
+		return
+	}
+	for _, r := range status.Routers {
+		if r.Local {
+			continue
+		}
+		parent := r.NextHop
+		if parent == "" {
+			parent = root.Id
+		}
+		children[parent] = append(children[parent], r)
+	}
+
+	var printRouter func(r types.NetworkRouterStatus, prefix string, connector string, childPrefix string)
+	printRouter = func(r types.NetworkRouterStatus, prefix string, connector string, childPrefix string) {
+		line := fmt.Sprintf("%s%s%s site %s", prefix, connector, r.Id, getSiteLabel(r.SiteName, r.SiteId))
+		if r.Local {
+			line += " (this site)"
+		} else {
+			line += fmt.Sprintf(" cost %d", r.Cost)
+		}
+		fmt.Println(line)
+		kids := children[r.Id]
+		for _, svc := range getSiteServices(status, r.SiteId) {
+			branch := "    "
+			if len(kids) > 0 {
+				branch = "│   "
+			}
+			fmt.Printf("%s%s%s=> %s\n", prefix, childPrefix, branch, svc)
+		}
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				printRouter(child, prefix+childPrefix, "└── ", "    ")
+			} else {
+				printRouter(child, prefix+childPrefix, "├── ", "│   ")
+			}
+		}
+	}
+	printRouter(*root, "", "", "")
+
+	// sites behind edge routers are only known from the services they provide
+	others := []types.NetworkSiteStatus{}
+	for _, site := range status.Sites {
+		if len(site.Routers) == 0 {
+			others = append(others, site)
+		}
+	}
+	if len(others) > 0 {
+		fmt.Println()
+		fmt.Println("Sites reached through edge routers:")
+		for _, site := range others {
+			fmt.Printf("    %s\n", getSiteLabel(site.SiteName, site.SiteId))
+			for _, svc := range site.Services {
+				fmt.Printf("      => %s\n", svc)
+			}
+		}
+	}
+}
+
+// printNetworkDot writes the network as a Graphviz graph, with the services
+// of each site attached to its routers
+func printNetworkDot(status *types.NetworkStatusResponse) {
+	fmt.Println("graph skupper {")
+	local := ""
+	for _, r := range status.Routers {
+		label := r.Id + "\n" + getSiteLabel(r.SiteName, r.SiteId)
+		if r.Local {
+			local = r.Id
+			fmt.Printf("    %q [label=%q, style=bold];\n", r.Id, label)
+		} else {
+			fmt.Printf("    %q [label=%q];\n", r.Id, label)
+		}
+	}
+	links := map[string]bool{}
+	addLink := func(a string, b string) {
+		if a > b {
+			a, b = b, a
+		}
+		key := a + " -- " + b
+		if a == b || links[key] {
+			return
+		}
+		links[key] = true
+		fmt.Printf("    %q -- %q;\n", a, b)
+	}
+	for _, r := range status.Routers {
+		if len(r.LinkState) > 0 {
+			for _, neighbour := range r.LinkState {
+				addLink(r.Id, neighbour)
+			}
+		} else if !r.Local {
+			parent := r.NextHop
+			if parent == "" {
+				parent = local
+			}
+			addLink(r.Id, parent)
+		}
+	}
+	for _, site := range status.Sites {
+		attachTo := site.Routers
+		if len(attachTo) == 0 {
+			// a site behind an edge router
+			siteNode := "site:" + site.SiteId
+			fmt.Printf("    %q [label=%q, style=dashed];\n", siteNode, getSiteLabel(site.SiteName, site.SiteId))
+			attachTo = []string{siteNode}
+		}
+		for _, svc := range site.Services {
+			svcNode := "service:" + site.SiteId + ":" + svc
+			fmt.Printf("    %q [label=%q, shape=box];\n", svcNode, svc)
+			for _, r := range attachTo {
+				fmt.Printf("    %q -- %q [style=dashed];\n", r, svcNode)
+			}
+		}
+	}
+	fmt.Println("}")
+}
+
+func NewCmdNetwork() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "network",
+		Short: "Show the skupper network",
+	}
+	return cmd
+}
+
+func NewCmdNetworkStatus(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the routers of the skupper network and the services each site provides",
+		Long: `status lists every router known to the site router with its site, next hop and cost, as a
+tree rooted at this site. Use --format dot to export the network as a Graphviz graph.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			if networkStatusFormat != "tree" && networkStatusFormat != "dot" {
+				return fmt.Errorf("format must be one of: [tree, dot]")
+			}
+			status, err := cli.NetworkStatus()
+			if err != nil {
+				return fmt.Errorf("Unable to retrieve network status: %w", err)
+			}
+			if !isTableOutput() {
+				return printStructured(status)
+			}
+			if networkStatusFormat == "dot" {
+				printNetworkDot(status)
+			} else {
+				printNetworkTree(status)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&networkStatusFormat, "format", "", "tree", "Rendering of the network, one of: 'tree', 'dot'")
+	return cmd
+}
+
 type cobraFunc func(cmd *cobra.Command, args []string)
 
+var containerRuntime string
+
+var connectOptions libdocker.ConnectOptions
+
+var siteName string
+
+var validSiteName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// verifySite selects the site every command works on, its name prefixes the
+// containers, network, volumes and state directory of the site
+func verifySite(cmd *cobra.Command, args []string) error {
+	if siteName != "" && !validSiteName.MatchString(siteName) {
+		return fmt.Errorf("site name %q must consist of lower case alphanumeric characters or '-'", siteName)
+	}
+	return os.Setenv("SKUPPER_SITE", siteName)
+}
+
+func verifyConnectOptions(cmd *cobra.Command, args []string) error {
+	if connectOptions.Host != "" && connectOptions.Context != "" {
+		return fmt.Errorf("--docker-host and --context cannot be used together")
+	}
+	return nil
+}
+
 func newClient(cmd *cobra.Command, args []string) {
-	cli, _ = client.NewClient()
+	options := connectOptions
+	options.Runtime = containerRuntime
+	var err error
+	cli, err = client.NewClientWithOptions(options)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 }
 
 var rootCmd *cobra.Command
@@ -730,13 +1577,59 @@ func init() {
 	cmdBind := NewCmdBind(newClient)
 	cmdUnbind := NewCmdUnbind(newClient)
 	cmdVersion := NewCmdVersion(newClient)
+	cmdUpdate := NewCmdUpdate(newClient)
+	cmdRotateCerts := NewCmdRotateCerts(newClient)
+	cmdStats := NewCmdStats(newClient)
+	cmdNetworkStatus := NewCmdNetworkStatus(newClient)
+
+	cmdDebugDump := NewCmdDebugDump(newClient)
+	cmdApply := NewCmdApply(newClient)
 
 	cmdService := NewCmdService()
 	cmdService.AddCommand(cmdCreateService)
 	cmdService.AddCommand(cmdDeleteService)
 
-	rootCmd = &cobra.Command{Use: "skupper-docker"}
+	cmdDebug := NewCmdDebug()
+	cmdDebug.AddCommand(cmdDebugDump)
+
+	cmdNetwork := NewCmdNetwork()
+	cmdNetwork.AddCommand(cmdNetworkStatus)
+
+	cmdCompose := NewCmdCompose()
+	cmdCompose.AddCommand(NewCmdComposeExpose(newClient))
+	cmdCompose.AddCommand(NewCmdComposeUnexpose(newClient))
+
+	cmdConsoleUser := NewCmdConsoleUser()
+	cmdConsoleUser.AddCommand(NewCmdConsoleUserAdd(newClient))
+	cmdConsoleUser.AddCommand(NewCmdConsoleUserRemove(newClient))
+	cmdConsoleUser.AddCommand(NewCmdConsoleUserList(newClient))
+	cmdConsoleUser.AddCommand(NewCmdConsoleUserSetPassword(newClient))
+
+	rootCmd = &cobra.Command{
+		Use: "skupper-docker",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := verifyOutputFormat(cmd, args); err != nil {
+				return err
+			}
+			if err := verifyRuntime(cmd, args); err != nil {
+				return err
+			}
+			if err := verifyConnectOptions(cmd, args); err != nil {
+				return err
+			}
+			return verifySite(cmd, args)
+		},
+	}
 	rootCmd.Version = version
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format for status, list and version commands. One of: 'table', 'json', 'yaml'")
+	rootCmd.PersistentFlags().StringVar(&containerRuntime, "runtime", os.Getenv("SKUPPER_RUNTIME"), "Container runtime to use, one of: 'docker', 'podman'. Detected from the available socket by default")
+	rootCmd.PersistentFlags().StringVar(&siteName, "site", os.Getenv("SKUPPER_SITE"), "Name of the site to work on, several sites with different names can share a daemon. The default site has no name")
+	rootCmd.PersistentFlags().StringVarP(&connectOptions.Host, "docker-host", "H", "", "Daemon to connect to, e.g. tcp://host:2376. Defaults to DOCKER_HOST or the current docker context")
+	rootCmd.PersistentFlags().StringVar(&connectOptions.Context, "context", "", "Name of the docker context to connect with, overrides DOCKER_HOST and the current context")
+	rootCmd.PersistentFlags().BoolVar(&connectOptions.TLSVerify, "tls-verify", os.Getenv("DOCKER_TLS_VERIFY") != "", "Use TLS and verify the daemon certificate")
+	rootCmd.PersistentFlags().StringVar(&connectOptions.CACert, "tls-ca-cert", "", "Trust certificates signed by this CA")
+	rootCmd.PersistentFlags().StringVar(&connectOptions.Cert, "tls-cert", "", "Path to the TLS client certificate")
+	rootCmd.PersistentFlags().StringVar(&connectOptions.Key, "tls-key", "", "Path to the TLS client key")
 	rootCmd.AddCommand(cmdInit,
 		cmdDelete,
 		cmdConnectionToken,
@@ -751,7 +1644,15 @@ func init() {
 		cmdService,
 		cmdBind,
 		cmdUnbind,
-		cmdVersion)
+		cmdVersion,
+		cmdDebug,
+		cmdApply,
+		cmdUpdate,
+		cmdRotateCerts,
+		cmdStats,
+		cmdNetwork,
+		cmdCompose,
+		cmdConsoleUser)
 }
 
 func main() {
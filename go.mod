@@ -12,18 +12,21 @@ require (
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/interconnectedcloud/go-amqp v0.12.6-0.20200506124159-f51e540008b5
+	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/morikuni/aec v1.0.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0-rc1 // indirect
 	github.com/opencontainers/image-spec v1.0.1 // indirect
 	github.com/sirupsen/logrus v1.5.0 // indirect
 	github.com/skupperproject/skupper v0.0.0-20201023150448-6cc66218c765
 	github.com/spf13/cobra v0.0.6
+	golang.org/x/crypto v0.0.0-20191206172530-e9b2fee46413
 	google.golang.org/genproto v0.0.0-20190819201941-24fa4b261c55 // indirect
 	google.golang.org/grpc v1.21.1 // indirect
 	gotest.tools v2.2.0+incompatible
 	gotest.tools/v3 v3.0.3 // indirect
 	k8s.io/apimachinery v0.17.0
 	k8s.io/client-go v0.17.0
+	sigs.k8s.io/yaml v1.1.0
 )
 
 module github.com/skupperproject/skupper-docker
@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
 	dockercontainer "github.com/docker/docker/api/types/container"
+	dockerfilters "github.com/docker/docker/api/types/filters"
 	dockermounttypes "github.com/docker/docker/api/types/mount"
 	dockernetworktypes "github.com/docker/docker/api/types/network"
 	"github.com/docker/go-connections/nat"
@@ -34,6 +37,68 @@ func ListContainers(opts dockertypes.ContainerListOptions, dd libdocker.Interfac
 	return dd.ListContainers(opts)
 }
 
+// ListSiteContainers lists the containers matching opts that belong to the
+// current site, leaving out those of other sites on the same daemon
+func ListSiteContainers(opts dockertypes.ContainerListOptions, dd libdocker.Interface) ([]dockertypes.Container, error) {
+	containers, err := dd.ListContainers(opts)
+	if err != nil {
+		return nil, err
+	}
+	site := []dockertypes.Container{}
+	for _, container := range containers {
+		if IsSiteContainer(container.Labels) {
+			site = append(site, container)
+		}
+	}
+	return site, nil
+}
+
+// ParseLabelSelector splits a selector such as app=web,tier=front into
+// the label filters understood by docker
+func ParseLabelSelector(selector string) ([]string, error) {
+	labels := []string{}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		kv := strings.SplitN(part, "=", 2)
+		if kv[0] == "" || (len(kv) == 2 && kv[1] == "") {
+			return nil, fmt.Errorf("Invalid label selector %q, expected key=value[,key=value]", selector)
+		}
+		labels = append(labels, part)
+	}
+	return labels, nil
+}
+
+// SelectContainers returns the sorted names of the running containers of the
+// site matching the label selector, skupper's own containers are left out.
+// Like labelled containers, a container belongs to the site named in its
+// skupper.io/site label or to the default site when there is none.
+func SelectContainers(selector string, dd libdocker.Interface) ([]string, error) {
+	labels, err := ParseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	filters := dockerfilters.NewArgs()
+	for _, label := range labels {
+		filters.Add("label", label)
+	}
+	containers, err := dd.ListContainers(dockertypes.ContainerListOptions{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, container := range containers {
+		if _, ok := container.Labels["skupper.io/component"]; ok {
+			continue
+		}
+		if !IsSiteContainer(container.Labels) {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(container.Names[0], "/"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 func ConnectContainerToNetwork(network string, name string, dd libdocker.Interface) error {
 	return dd.ConnectContainerToNetwork(network, name)
 }
@@ -58,6 +123,79 @@ func WaitContainer(name string, dd libdocker.Interface) error {
 	return dd.WaitContainer(name, 10*time.Second)
 }
 
+// stateMount mounts an area of the site state, or the directory dir within
+// it, below target. Volumes cannot be mounted in part, so with volume storage
+// the whole area is mounted and dir is found at the same place.
+func stateMount(p types.Path, dir string, target string) dockermounttypes.Mount {
+	if types.GetSkupperStorage() == types.StorageVolume {
+		return dockermounttypes.Mount{
+			Type:   dockermounttypes.TypeVolume,
+			Source: types.GetSkupperVolume(p),
+			Target: target,
+		}
+	}
+	return dockermounttypes.Mount{
+		Type:   dockermounttypes.TypeBind,
+		Source: filepath.Join(types.GetSkupperPath(p), dir),
+		Target: filepath.Join(target, dir),
+	}
+}
+
+// specMounts turns the source to target mounts of a router spec into
+// bind mounts for host paths and volume mounts for volume names
+func specMounts(specified map[string]string) []dockermounttypes.Mount {
+	mounts := []dockermounttypes.Mount{}
+	for source, target := range specified {
+		mountType := dockermounttypes.TypeBind
+		if !filepath.IsAbs(source) {
+			mountType = dockermounttypes.TypeVolume
+		}
+		mounts = append(mounts, dockermounttypes.Mount{
+			Type:   mountType,
+			Source: source,
+			Target: target,
+		})
+	}
+	sort.Slice(mounts, func(i, j int) bool {
+		return mounts[i].Target < mounts[j].Target
+	})
+	return mounts
+}
+
+// currentMounts returns the mounts of a container to re-create it with
+func currentMounts(current *dockertypes.ContainerJSON) []dockermounttypes.Mount {
+	mounts := []dockermounttypes.Mount{}
+	for _, v := range current.Mounts {
+		source := v.Source
+		if v.Type == dockermounttypes.TypeVolume {
+			// the source of a volume is its location on the daemon host
+			source = v.Name
+		}
+		mounts = append(mounts, dockermounttypes.Mount{
+			Type:   v.Type,
+			Source: source,
+			Target: v.Destination,
+		})
+	}
+	return mounts
+}
+
+// IsSiteContainer reports whether a skupper container belongs to the current
+// site, the containers of the default site carry no site label
+func IsSiteContainer(labels map[string]string) bool {
+	return labels[types.SiteQualifier] == types.GetSiteName()
+}
+
+// siteEndpoints attaches a container to the network of the site, where it is
+// also known by the given aliases whatever the site prefix of its name
+func siteEndpoints(aliases ...string) map[string]*dockernetworktypes.EndpointSettings {
+	return map[string]*dockernetworktypes.EndpointSettings{
+		types.GetTransportNetworkName(): {
+			Aliases: aliases,
+		},
+	}
+}
+
 // TODO: should skupper containers be here or in another package?
 
 func getLabels(service types.ServiceInterface, isLocal bool) map[string]string {
@@ -82,27 +220,19 @@ func getLabels(service types.ServiceInterface, isLocal bool) map[string]string {
 		"internal.skupper.io/service": service.Address,
 		"skupper.io/origin":           service.Origin,
 		"skupper.io/last-applied":     string(lastApplied),
+		types.SiteQualifier:           types.GetSiteName(),
 	}
 }
 
-func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig string, mapToHost bool, osType string) *dockertypes.ContainerCreateConfig {
-	var imageName string
+func getProxyImage() string {
 	if os.Getenv("QDROUTERD_IMAGE") != "" {
-		imageName = os.Getenv("QDROUTERD_IMAGE")
-	} else {
-		imageName = types.DefaultTransportImage
-	}
-
-	labels := getLabels(service, true)
-	envVars := []string{}
-	envVars = append(envVars, os.Getenv("SKUPPER_TMPDIR"))
-	envVars = append(envVars, "QDROUTERD_CONF="+qdrConfig)
-	envVars = append(envVars, "QDROUTERD_CONF_TYPE=json")
-	envVars = append(envVars, "NAMESPACE=skupper")
-	if os.Getenv("PN_TRACE_FRM") != "" {
-		envVars = append(envVars, "PN_TRACE_FRM=1")
+		return os.Getenv("QDROUTERD_IMAGE")
 	}
+	return types.DefaultTransportImage
+}
 
+// getExtraHosts maps the host-service targets of a service to their address
+func getExtraHosts(service types.ServiceInterface, osType string) []string {
 	var host string
 	if os.Getenv("SKUPPER_HOST") != "" {
 		host = os.Getenv("SKUPPER_HOST")
@@ -123,6 +253,23 @@ func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig str
 			}
 		}
 	}
+	return extraHosts
+}
+
+func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig string, mapToHost bool, osType string) *dockertypes.ContainerCreateConfig {
+	imageName := getProxyImage()
+
+	labels := getLabels(service, true)
+	envVars := []string{}
+	envVars = append(envVars, os.Getenv("SKUPPER_TMPDIR"))
+	envVars = append(envVars, "QDROUTERD_CONF="+qdrConfig)
+	envVars = append(envVars, "QDROUTERD_CONF_TYPE=json")
+	envVars = append(envVars, "NAMESPACE=skupper")
+	if os.Getenv("PN_TRACE_FRM") != "" {
+		envVars = append(envVars, "PN_TRACE_FRM=1")
+	}
+
+	extraHosts := getExtraHosts(service, osType)
 
 	containerCfg := &dockercontainer.Config{
 		Hostname: service.Address,
@@ -132,38 +279,36 @@ func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig str
 	}
 	if mapToHost {
 		containerCfg.ExposedPorts = make(map[nat.Port]struct{})
-		containerCfg.ExposedPorts[nat.Port(strconv.Itoa(service.Port)+"/"+service.Protocol)] = struct{}{}
+		for _, port := range service.GetPorts() {
+			containerCfg.ExposedPorts[nat.Port(strconv.Itoa(port)+"/"+service.Protocol)] = struct{}{}
+		}
 	}
 
 	hostCfg := &dockercontainer.HostConfig{
 		Mounts: []dockermounttypes.Mount{
-			{
-				Type:   dockermounttypes.TypeBind,
-				Source: types.GetSkupperPath(types.CertsPath) + "/" + "skupper-internal",
-				Target: "/etc/qpid-dispatch-certs/skupper-internal/",
-			},
+			stateMount(types.CertsPath, "skupper-internal", "/etc/qpid-dispatch-certs"),
 		},
-		NetworkMode: "skupper-network",
+		NetworkMode: dockercontainer.NetworkMode(types.GetTransportNetworkName()),
 		ExtraHosts:  extraHosts,
 		Privileged:  true,
 	}
 	if mapToHost {
 		hostCfg.PortBindings = make(map[nat.Port][]nat.PortBinding)
-		hostCfg.PortBindings[nat.Port(strconv.Itoa(service.Port)+"/"+service.Protocol)] = []nat.PortBinding{
-			{
-				HostPort: strconv.Itoa(service.Port),
-			},
+		for _, port := range service.GetPorts() {
+			hostCfg.PortBindings[nat.Port(strconv.Itoa(port)+"/"+service.Protocol)] = []nat.PortBinding{
+				{
+					HostPort: strconv.Itoa(port),
+				},
+			}
 		}
 	}
 
 	networkCfg := &dockernetworktypes.NetworkingConfig{
-		EndpointsConfig: map[string]*dockernetworktypes.EndpointSettings{
-			types.TransportNetworkName: {},
-		},
+		EndpointsConfig: siteEndpoints(service.Address),
 	}
 
 	opts := &dockertypes.ContainerCreateConfig{
-		Name:             service.Address,
+		Name:             types.GetSiteScopedName(service.Address),
 		Config:           containerCfg,
 		HostConfig:       hostCfg,
 		NetworkingConfig: networkCfg,
@@ -188,30 +333,230 @@ func NewProxyContainer(svcDef types.ServiceInterface, qdrConfig string, mapToHos
 
 }
 
-func RestartControllerContainer(dd libdocker.Interface) error {
-	current, err := InspectContainer(types.ControllerDeploymentName, dd)
+func getBridgeContainerCreateConfig(services []types.ServiceInterface, mapToHost bool, osType string) *dockertypes.ContainerCreateConfig {
+	envVars := []string{
+		"QDROUTERD_CONF=/etc/qpid-dispatch/bridge/" + types.BridgeConfigFile,
+		"QDROUTERD_CONF_TYPE=json",
+		"NAMESPACE=skupper",
+	}
+	if os.Getenv("PN_TRACE_FRM") != "" {
+		envVars = append(envVars, "PN_TRACE_FRM=1")
+	}
+
+	// every address resolves to the bridge router on the skupper network
+	aliases := []string{}
+	extraHosts := []string{}
+	ports := nat.PortSet{}
+	portBindings := nat.PortMap{}
+	for _, service := range services {
+		aliases = append(aliases, service.Address)
+		extraHosts = append(extraHosts, getExtraHosts(service, osType)...)
+		if mapToHost {
+			for _, p := range service.GetPorts() {
+				port := nat.Port(strconv.Itoa(p) + "/tcp")
+				ports[port] = struct{}{}
+				portBindings[port] = []nat.PortBinding{
+					{
+						HostPort: strconv.Itoa(p),
+					},
+				}
+			}
+		}
+	}
+
+	containerCfg := &dockercontainer.Config{
+		Hostname:     types.BridgeDeploymentName,
+		Image:        getProxyImage(),
+		Env:          envVars,
+		ExposedPorts: ports,
+		Labels: map[string]string{
+			"application":              types.BridgeDeploymentName,
+			"skupper.io/component":     "proxy",
+			"internal.skupper.io/type": "bridge",
+			types.SiteQualifier:        types.GetSiteName(),
+		},
+	}
+
+	hostCfg := &dockercontainer.HostConfig{
+		Mounts: []dockermounttypes.Mount{
+			stateMount(types.CertsPath, "skupper-internal", "/etc/qpid-dispatch-certs"),
+			stateMount(types.ServicesPath, "", "/etc/qpid-dispatch/bridge"),
+		},
+		NetworkMode:  dockercontainer.NetworkMode(types.GetTransportNetworkName()),
+		ExtraHosts:   extraHosts,
+		PortBindings: portBindings,
+		Privileged:   true,
+	}
+
+	return &dockertypes.ContainerCreateConfig{
+		Name:       types.GetBridgeDeploymentName(),
+		Config:     containerCfg,
+		HostConfig: hostCfg,
+		NetworkingConfig: &dockernetworktypes.NetworkingConfig{
+			EndpointsConfig: siteEndpoints(aliases...),
+		},
+	}
+}
+
+// NewBridgeContainer creates the router shared by the given services, its
+// config is read from the bridge config file in the services directory
+func NewBridgeContainer(services []types.ServiceInterface, mapToHost bool, dd libdocker.Interface) (*dockertypes.ContainerCreateConfig, error) {
+	version, err := dd.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	opts := getBridgeContainerCreateConfig(services, mapToHost, version.Os)
+
+	_, err = dd.CreateContainer(*opts)
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// BridgeContainerCovers reports whether the bridge container already has the
+// network aliases, host entries and port bindings needed by the services, as
+// none of these can be added to a container once it is created
+func BridgeContainerCovers(current *dockertypes.ContainerJSON, services []types.ServiceInterface, mapToHost bool, dd libdocker.Interface) (bool, error) {
+	version, err := dd.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	desired := getBridgeContainerCreateConfig(services, mapToHost, version.Os)
+
+	aliases := map[string]bool{}
+	if current.NetworkSettings != nil {
+		if network, ok := current.NetworkSettings.Networks[types.GetTransportNetworkName()]; ok && network != nil {
+			for _, alias := range network.Aliases {
+				aliases[alias] = true
+			}
+		}
+	}
+	for _, alias := range desired.NetworkingConfig.EndpointsConfig[types.GetTransportNetworkName()].Aliases {
+		if !aliases[alias] {
+			return false, nil
+		}
+	}
+
+	extraHosts := map[string]bool{}
+	for _, h := range current.HostConfig.ExtraHosts {
+		extraHosts[h] = true
+	}
+	for _, h := range desired.HostConfig.ExtraHosts {
+		if !extraHosts[h] {
+			return false, nil
+		}
+	}
+
+	for port := range desired.HostConfig.PortBindings {
+		if _, ok := current.HostConfig.PortBindings[port]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RecreateProxyContainer replaces a proxy container with one running the given
+// image, keeping its router config, labels, port bindings and host entries
+func RecreateProxyContainer(name string, image string, dd libdocker.Interface) error {
+	current, err := InspectContainer(name, dd)
 	if err != nil {
 		return err
 	}
 
-	mounts := []dockermounttypes.Mount{}
-	for _, v := range current.Mounts {
-		mounts = append(mounts, dockermounttypes.Mount{
-			Type:   v.Type,
-			Source: v.Source,
-			Target: v.Destination,
-		})
+	mounts := currentMounts(current)
+	hostCfg := &dockercontainer.HostConfig{
+		Mounts:       mounts,
+		NetworkMode:  current.HostConfig.NetworkMode,
+		ExtraHosts:   current.HostConfig.ExtraHosts,
+		PortBindings: current.HostConfig.PortBindings,
+		Privileged:   true,
+	}
+
+	containerCfg := &dockercontainer.Config{
+		Hostname:     current.Config.Hostname,
+		Image:        image,
+		Env:          current.Config.Env,
+		Labels:       current.Config.Labels,
+		ExposedPorts: current.Config.ExposedPorts,
+	}
+
+	err = StopContainer(name, dd)
+	if err != nil {
+		log.Println("Failed to stop proxy container", err.Error())
+	}
+
+	err = RemoveContainer(name, dd)
+	if err != nil {
+		return fmt.Errorf("Failed to remove proxy container %s: %w", name, err)
+	}
+
+	// keep the service aliases of a proxy or shared bridge router
+	endpoint := &dockernetworktypes.EndpointSettings{}
+	if current.NetworkSettings != nil {
+		if network, ok := current.NetworkSettings.Networks[types.GetTransportNetworkName()]; ok && network != nil {
+			for _, alias := range network.Aliases {
+				if alias != name && !strings.HasPrefix(current.ID, alias) {
+					endpoint.Aliases = append(endpoint.Aliases, alias)
+				}
+			}
+		}
+	}
+
+	opts := &dockertypes.ContainerCreateConfig{
+		Name:       name,
+		Config:     containerCfg,
+		HostConfig: hostCfg,
+		NetworkingConfig: &dockernetworktypes.NetworkingConfig{
+			EndpointsConfig: map[string]*dockernetworktypes.EndpointSettings{
+				types.GetTransportNetworkName(): endpoint,
+			},
+		},
 	}
+
+	_, err = CreateContainer(opts, dd)
+	if err != nil {
+		return fmt.Errorf("Failed to re-create proxy container %s: %w", name, err)
+	}
+
+	return StartContainer(name, dd)
+}
+
+func RestartControllerContainer(dd libdocker.Interface) error {
+	return RecreateControllerContainer("", []string{"SKUPPER_PROXY_CONTROLLER_RESTART=true"}, dd)
+}
+
+// RecreateControllerContainer replaces the controller container with one
+// running the given image (or the current one if empty), reusing its mounts
+// and labels. The env entries, in NAME=value form, are set on top of the
+// current environment.
+func RecreateControllerContainer(image string, env []string, dd libdocker.Interface) error {
+	current, err := InspectContainer(types.GetControllerDeploymentName(), dd)
+	if err != nil {
+		return err
+	}
+	if image == "" {
+		image = current.Config.Image
+	}
+
+	mounts := currentMounts(current)
 	hostCfg := &dockercontainer.HostConfig{
-		Mounts:     mounts,
-		Privileged: true,
+		Mounts:       mounts,
+		Privileged:   true,
+		PortBindings: keptPortBindings(current),
 	}
 
-	newEnv := SetEnvVar(current.Config.Env, "SKUPPER_PROXY_CONTROLLER_RESTART", "true")
+	newEnv := current.Config.Env
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 2 {
+			newEnv = SetEnvVar(newEnv, parts[0], parts[1])
+		}
+	}
 
 	containerCfg := &dockercontainer.Config{
 		Hostname:     current.Config.Hostname,
-		Image:        current.Config.Image,
+		Image:        image,
 		Cmd:          current.Config.Cmd,
 		Labels:       current.Config.Labels,
 		ExposedPorts: current.Config.ExposedPorts,
@@ -219,24 +564,22 @@ func RestartControllerContainer(dd libdocker.Interface) error {
 	}
 
 	// remove current and create new container
-	err = StopContainer(types.ControllerDeploymentName, dd)
+	err = StopContainer(types.GetControllerDeploymentName(), dd)
 	if err != nil {
 		log.Println("Failed to stop controller container", err.Error())
 	}
 
-	err = RemoveContainer(types.ControllerDeploymentName, dd)
+	err = RemoveContainer(types.GetControllerDeploymentName(), dd)
 	if err != nil {
 		log.Println("Failed to remove controller container", err.Error())
 	}
 
 	opts := &dockertypes.ContainerCreateConfig{
-		Name:       types.ControllerDeploymentName,
+		Name:       types.GetControllerDeploymentName(),
 		Config:     containerCfg,
 		HostConfig: hostCfg,
 		NetworkingConfig: &dockernetworktypes.NetworkingConfig{
-			EndpointsConfig: map[string]*dockernetworktypes.EndpointSettings{
-				types.TransportNetworkName: {},
-			},
+			EndpointsConfig: siteEndpoints(types.ControllerDeploymentName),
 		},
 	}
 
@@ -245,7 +588,7 @@ func RestartControllerContainer(dd libdocker.Interface) error {
 		log.Println("Failed to re-create controller container", err.Error())
 	}
 
-	err = StartContainer(types.ControllerDeploymentName, dd)
+	err = StartContainer(types.GetControllerDeploymentName(), dd)
 	if err != nil {
 		log.Println("Failed to re-start controller container", err.Error())
 	}
@@ -254,38 +597,77 @@ func RestartControllerContainer(dd libdocker.Interface) error {
 }
 
 func getControllerContainerCreateConfig(van *types.RouterSpec) *dockertypes.ContainerCreateConfig {
-	mounts := []dockermounttypes.Mount{}
-	for source, target := range van.Controller.Mounts {
-		mounts = append(mounts, dockermounttypes.Mount{
-			Type:   dockermounttypes.TypeBind,
-			Source: source,
-			Target: target,
-		})
-	}
+	mounts := specMounts(van.Controller.Mounts)
 
 	opts := &dockertypes.ContainerCreateConfig{
-		Name: types.ControllerDeploymentName,
+		Name: types.GetControllerDeploymentName(),
 		Config: &dockercontainer.Config{
-			Hostname: types.ControllerDeploymentName,
-			Image:    van.Controller.Image,
-			Cmd:      []string{"/app/controller"},
-			Env:      van.Controller.EnvVar,
-			Labels:   van.Controller.Labels,
+			Hostname:     types.ControllerDeploymentName,
+			Image:        van.Controller.Image,
+			Cmd:          []string{"/app/controller"},
+			Env:          van.Controller.EnvVar,
+			Labels:       van.Controller.Labels,
+			ExposedPorts: van.Controller.Ports,
 		},
 		HostConfig: &dockercontainer.HostConfig{
-			Mounts:     mounts,
-			Privileged: true,
+			Mounts:       mounts,
+			Privileged:   true,
+			PortBindings: publishedPorts(van.Controller.Ports, van.Controller.HostIP),
 		},
 		NetworkingConfig: &dockernetworktypes.NetworkingConfig{
-			EndpointsConfig: map[string]*dockernetworktypes.EndpointSettings{
-				types.TransportNetworkName: {},
-			},
+			EndpointsConfig: siteEndpoints(types.ControllerDeploymentName),
 		},
 	}
 
 	return opts
 }
 
+// publishedPorts binds each of the ports to a host port chosen by the daemon,
+// so that several sites on one host do not compete for the same one. The
+// ports are published on hostIP, or on all addresses of the host if empty.
+func publishedPorts(ports nat.PortSet, hostIP string) nat.PortMap {
+	if len(ports) == 0 {
+		return nil
+	}
+	bindings := nat.PortMap{}
+	for port := range ports {
+		bindings[port] = []nat.PortBinding{{HostIP: hostIP}}
+	}
+	return bindings
+}
+
+// keptPortBindings returns the port bindings of the container with the host
+// ports the daemon chose for it, so that a re-created container keeps them
+func keptPortBindings(container *dockertypes.ContainerJSON) nat.PortMap {
+	if len(container.HostConfig.PortBindings) == 0 {
+		return container.HostConfig.PortBindings
+	}
+	bindings := nat.PortMap{}
+	for port, current := range container.HostConfig.PortBindings {
+		for _, binding := range current {
+			if binding.HostPort == "" {
+				binding.HostPort = PublishedPort(container, port)
+			}
+			bindings[port] = append(bindings[port], binding)
+		}
+	}
+	return bindings
+}
+
+// PublishedPort returns the host port a container port is published on, or
+// an empty string when it is not published
+func PublishedPort(container *dockertypes.ContainerJSON, port nat.Port) string {
+	if container.NetworkSettings == nil {
+		return ""
+	}
+	for _, binding := range container.NetworkSettings.Ports[port] {
+		if binding.HostPort != "" {
+			return binding.HostPort
+		}
+	}
+	return ""
+}
+
 // TODO: unify the two news
 func NewControllerContainer(van *types.RouterSpec, dd libdocker.Interface) (*dockertypes.ContainerCreateConfig, error) {
 	opts := getControllerContainerCreateConfig(van)
@@ -301,19 +683,22 @@ func NewControllerContainer(van *types.RouterSpec, dd libdocker.Interface) (*doc
 }
 
 func RestartTransportContainer(dd libdocker.Interface) error {
-	current, err := InspectContainer("skupper-router", dd)
+	return RecreateTransportContainer("", dd)
+}
+
+// RecreateTransportContainer replaces the router container with one running the
+// given image (or the current one if empty), reusing its mounts, labels and
+// environment so the site state is preserved
+func RecreateTransportContainer(image string, dd libdocker.Interface) error {
+	current, err := InspectContainer(types.GetTransportDeploymentName(), dd)
 	if err != nil {
 		return err
 	}
-
-	mounts := []dockermounttypes.Mount{}
-	for _, v := range current.Mounts {
-		mounts = append(mounts, dockermounttypes.Mount{
-			Type:   v.Type,
-			Source: v.Source,
-			Target: v.Destination,
-		})
+	if image == "" {
+		image = current.Config.Image
 	}
+
+	mounts := currentMounts(current)
 	hostCfg := &dockercontainer.HostConfig{
 		Mounts:     mounts,
 		Privileged: true,
@@ -321,7 +706,7 @@ func RestartTransportContainer(dd libdocker.Interface) error {
 
 	containerCfg := &dockercontainer.Config{
 		Hostname: current.Config.Hostname,
-		Image:    current.Config.Image,
+		Image:    image,
 		Healthcheck: &dockercontainer.HealthConfig{
 			Test:        []string{"curl --fail -s http://localhost:9090/healthz || exit 1"},
 			StartPeriod: (time.Duration(60) * time.Second),
@@ -332,24 +717,22 @@ func RestartTransportContainer(dd libdocker.Interface) error {
 	}
 
 	// remove current and create new container
-	err = StopContainer("skupper-router", dd)
+	err = StopContainer(types.GetTransportDeploymentName(), dd)
 	if err != nil {
 		log.Println("Failed to stop transport container", err.Error())
 	}
 
-	err = RemoveContainer("skupper-router", dd)
+	err = RemoveContainer(types.GetTransportDeploymentName(), dd)
 	if err != nil {
 		log.Println("Failed to remove transport container", err.Error())
 	}
 
 	opts := &dockertypes.ContainerCreateConfig{
-		Name:       "skupper-router",
+		Name:       types.GetTransportDeploymentName(),
 		Config:     containerCfg,
 		HostConfig: hostCfg,
 		NetworkingConfig: &dockernetworktypes.NetworkingConfig{
-			EndpointsConfig: map[string]*dockernetworktypes.EndpointSettings{
-				types.TransportNetworkName: {},
-			},
+			EndpointsConfig: siteEndpoints(types.TransportDeploymentName),
 		},
 	}
 
@@ -358,7 +741,20 @@ func RestartTransportContainer(dd libdocker.Interface) error {
 		log.Println("Failed to re-create transport container", err.Error())
 	}
 
-	err = StartContainer("skupper-router", dd)
+	// stay on the networks of the sites on this host it is connected to
+	if current.NetworkSettings != nil {
+		for network := range current.NetworkSettings.Networks {
+			if network == types.GetTransportNetworkName() {
+				continue
+			}
+			err = ConnectContainerToNetwork(network, types.GetTransportDeploymentName(), dd)
+			if err != nil {
+				log.Printf("Failed to re-connect transport container to %s: %s", network, err.Error())
+			}
+		}
+	}
+
+	err = StartContainer(types.GetTransportDeploymentName(), dd)
 	if err != nil {
 		log.Println("Failed to re-start transport container", err.Error())
 	}
@@ -367,17 +763,10 @@ func RestartTransportContainer(dd libdocker.Interface) error {
 }
 
 func getTransportContainerCreateConfig(van *types.RouterSpec) *dockertypes.ContainerCreateConfig {
-	mounts := []dockermounttypes.Mount{}
-	for source, target := range van.Transport.Mounts {
-		mounts = append(mounts, dockermounttypes.Mount{
-			Type:   dockermounttypes.TypeBind,
-			Source: source,
-			Target: target,
-		})
-	}
+	mounts := specMounts(van.Transport.Mounts)
 
 	opts := &dockertypes.ContainerCreateConfig{
-		Name: types.TransportDeploymentName,
+		Name: types.GetTransportDeploymentName(),
 		Config: &dockercontainer.Config{
 			Hostname: types.TransportDeploymentName,
 			Image:    van.Transport.Image,
@@ -394,9 +783,7 @@ func getTransportContainerCreateConfig(van *types.RouterSpec) *dockertypes.Conta
 			Privileged: true,
 		},
 		NetworkingConfig: &dockernetworktypes.NetworkingConfig{
-			EndpointsConfig: map[string]*dockernetworktypes.EndpointSettings{
-				types.TransportNetworkName: {},
-			},
+			EndpointsConfig: siteEndpoints(types.TransportDeploymentName),
 		},
 	}
 
@@ -438,6 +825,10 @@ func GetImageVersion(image string, dd libdocker.Interface) (string, error) {
 		return "", err
 	}
 
+	// locally built images have no digest to report
+	if len(iibd.RepoDigests) == 0 {
+		return image, nil
+	}
 	digest := iibd.RepoDigests[0]
 	parts := strings.Split(digest, "@")
 	if len(parts) > 1 && len(parts[1]) >= 19 {
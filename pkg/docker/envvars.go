@@ -15,12 +15,17 @@ func FindEnvVar(env []string, name string) string {
 
 func SetEnvVar(current []string, name string, value string) []string {
 	updated := []string{}
+	found := false
 	for _, v := range current {
-		if strings.HasPrefix(v, name) {
+		if strings.HasPrefix(v, name+"=") {
 			updated = append(updated, name+"="+value)
+			found = true
 		} else {
 			updated = append(updated, v)
 		}
 	}
+	if !found {
+		updated = append(updated, name+"="+value)
+	}
 	return updated
 }
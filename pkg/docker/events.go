@@ -0,0 +1,12 @@
+package docker
+
+import (
+	dockertypes "github.com/docker/docker/api/types"
+	dockerevents "github.com/docker/docker/api/types/events"
+
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+)
+
+func Events(options dockertypes.EventsOptions, stopCh <-chan struct{}, dd libdocker.Interface) (<-chan dockerevents.Message, <-chan error) {
+	return dd.Events(options, stopCh)
+}
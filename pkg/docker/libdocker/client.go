@@ -1,15 +1,23 @@
 package libdocker
 
 import (
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
 	dockercontainer "github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
 
 	//dockerimagetypes "github.com/docker/docker/api/types/image"
 	//dockernetworktypes "github.com/docker/docker/api/types/network"
 	dockerapi "github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
 )
 
 type Interface interface {
@@ -40,21 +48,181 @@ type Interface interface {
 	DisconnectContainerFromNetwork(id string, containerid string, force bool) error
 	RemoveNetwork(id string) error
 	ServerVersion() (dockertypes.Version, error)
+	Events(options dockertypes.EventsOptions, stopCh <-chan struct{}) (<-chan dockerevents.Message, <-chan error)
+	CreateVolume(name string, labels map[string]string) (dockertypes.Volume, error)
+	InspectVolume(name string) (dockertypes.Volume, error)
+	RemoveVolume(name string, force bool) error
+	CopyToContainer(id string, path string, content io.Reader) error
+	CopyFromContainer(id string, path string) (io.ReadCloser, error)
+	RuntimeInfo() RuntimeInfo
 }
 
-func getDockerClient(dockerEndpoint string) (*dockerapi.Client, error) {
-	if len(dockerEndpoint) > 0 {
-		log.Printf("Connection to docker on %s", dockerEndpoint)
-		log.Println()
-		return dockerapi.NewClient(dockerEndpoint, "", nil, nil)
+// Container runtimes supported behind the Interface
+const (
+	RuntimeDocker string = "docker"
+	RuntimePodman string = "podman"
+)
+
+// RuntimeInfo describes the container runtime an Interface talks to
+type RuntimeInfo struct {
+	// Name is one of RuntimeDocker or RuntimePodman
+	Name string
+	// Socket is the path of the unix socket of the runtime, if any
+	Socket string
+	// Rootless is set when the runtime runs as an unprivileged user
+	Rootless bool
+	// Host is the address the daemon is reached on
+	Host string
+	// Remote is set when the daemon is not reached on a local socket, so it
+	// does not share the filesystem of the client
+	Remote bool
+}
+
+const dockerSocket = "/var/run/docker.sock"
+
+// podmanSockets returns the candidate podman API sockets, the one of the
+// user first for rootless podman
+func podmanSockets() []string {
+	sockets := []string{}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	return append(sockets, "/run/podman/podman.sock")
+}
+
+// getEndpoint picks the socket to connect to for the runtime, an empty
+// result leaves the choice to DOCKER_HOST or the docker default
+func getEndpoint(runtime string) string {
+	if os.Getenv("DOCKER_HOST") != "" || runtime == RuntimeDocker {
+		return ""
+	}
+	if runtime == "" {
+		if _, err := os.Stat(dockerSocket); err == nil {
+			return ""
+		}
 	}
-	return dockerapi.NewClientWithOpts(dockerapi.FromEnv, dockerapi.WithAPIVersionNegotiation())
+	for _, socket := range podmanSockets() {
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return ""
+}
+
+// isPodman reports whether the daemon behind the docker compatible API is podman
+func isPodman(version dockertypes.Version) bool {
+	for _, c := range version.Components {
+		if strings.HasPrefix(c.Name, "Podman") {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectOptions select the daemon to connect to, the zero value follows
+// DOCKER_HOST, DOCKER_CONTEXT and the current docker context
+type ConnectOptions struct {
+	// Runtime is one of RuntimeDocker or RuntimePodman, detected if empty
+	Runtime string
+	// Host is the daemon address, e.g. tcp://host:2376
+	Host string
+	// Context is the name of a docker context to read the host and TLS material from
+	Context string
+	// TLSVerify verifies the certificate of the daemon against CACert
+	TLSVerify bool
+	CACert    string
+	Cert      string
+	Key       string
+}
+
+func (o ConnectOptions) hasTLS() bool {
+	return o.TLSVerify || o.CACert != "" || o.Cert != "" || o.Key != ""
+}
+
+func getDockerClient(options ConnectOptions) (*dockerapi.Client, error) {
+	if options.Host == "" && os.Getenv("DOCKER_HOST") == "" {
+		endpoint, err := getContextEndpoint(options.Context)
+		if err != nil {
+			return nil, err
+		}
+		if endpoint != nil {
+			options.Host = endpoint.Host
+			// contexts without TLS material talk plain http
+			if !options.hasTLS() && (endpoint.CACert != "" || endpoint.Cert != "") {
+				options.TLSVerify = !endpoint.SkipTLSVerify
+				options.CACert, options.Cert, options.Key = endpoint.CACert, endpoint.Cert, endpoint.Key
+			}
+		}
+	}
+	if options.Host == "" {
+		options.Host = getEndpoint(options.Runtime)
+	}
+	if strings.HasPrefix(options.Host, "ssh://") {
+		return nil, fmt.Errorf("ssh hosts are not supported, expose the daemon on tcp:// with TLS instead")
+	}
+
+	opts := []dockerapi.Opt{dockerapi.FromEnv, dockerapi.WithAPIVersionNegotiation()}
+	if options.hasTLS() {
+		tlsc, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             options.CACert,
+			CertFile:           options.Cert,
+			KeyFile:            options.Key,
+			InsecureSkipVerify: !options.TLSVerify,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load TLS configuration: %w", err)
+		}
+		opts = append(opts, dockerapi.WithHTTPClient(&http.Client{
+			Transport:     &http.Transport{TLSClientConfig: tlsc},
+			CheckRedirect: dockerapi.CheckRedirect,
+		}))
+	}
+	if options.Host != "" {
+		opts = append(opts, dockerapi.WithHost(options.Host))
+	}
+	return dockerapi.NewClientWithOpts(opts...)
 }
 
 func ConnectToDockerOrDie(requestTimeout, imagePullProgressDeadline time.Duration) Interface {
-	client, err := dockerapi.NewClientWithOpts(dockerapi.FromEnv, dockerapi.WithAPIVersionNegotiation())
+	return ConnectToRuntimeOrDie(os.Getenv("SKUPPER_RUNTIME"), requestTimeout, imagePullProgressDeadline)
+}
+
+// ConnectToRuntimeOrDie connects to the docker or podman API. With an empty
+// runtime the docker socket is preferred, the podman one used otherwise, and
+// the runtime is detected from the version reported by the daemon.
+func ConnectToRuntimeOrDie(runtime string, requestTimeout, imagePullProgressDeadline time.Duration) Interface {
+	return ConnectOrDie(ConnectOptions{Runtime: runtime}, requestTimeout, imagePullProgressDeadline)
+}
+
+// ConnectOrDie connects to the daemon selected by options
+func ConnectOrDie(options ConnectOptions, requestTimeout, imagePullProgressDeadline time.Duration) Interface {
+	runtime := options.Runtime
+	if runtime != "" && runtime != RuntimeDocker && runtime != RuntimePodman {
+		log.Fatalf("Unsupported container runtime %q, use %s or %s", runtime, RuntimeDocker, RuntimePodman)
+	}
+	client, err := getDockerClient(options)
 	if err != nil {
-		log.Fatalf("Couldn't connect to docker: %v", err)
+		log.Fatalf("Couldn't connect to %s: %v", runtimeOrDefault(runtime), err)
+	}
+	skup := newSkupDockerClient(client, requestTimeout, imagePullProgressDeadline).(*skupDockerClient)
+	if runtime == "" {
+		runtime = RuntimeDocker
+		if version, err := skup.ServerVersion(); err == nil && isPodman(version) {
+			runtime = RuntimePodman
+		}
+	}
+	// the daemon is asked once, RuntimeInfo is called for most commands
+	info := skup.runtimeInfo(runtime)
+	skup.info = &info
+	if runtime == RuntimePodman {
+		return newPodmanClient(skup)
+	}
+	return skup
+}
+
+func runtimeOrDefault(runtime string) string {
+	if runtime == "" {
+		return RuntimeDocker
 	}
-	return newSkupDockerClient(client, requestTimeout, imagePullProgressDeadline)
+	return runtime
 }
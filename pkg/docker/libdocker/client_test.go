@@ -0,0 +1,46 @@
+package libdocker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestConnectCachesRuntimeInfo(t *testing.T) {
+	infoRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.40")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			infoRequests++
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"SecurityOptions": ["name=seccomp,profile=default", "name=rootless"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host := "tcp://" + strings.TrimPrefix(server.URL, "http://")
+	dd := ConnectOrDie(ConnectOptions{Runtime: RuntimeDocker, Host: host}, 5*time.Second, 5*time.Second)
+	for i := 0; i < 3; i++ {
+		assert.DeepEqual(t, dd.RuntimeInfo(), RuntimeInfo{
+			Name:     RuntimeDocker,
+			Rootless: true,
+			Host:     host,
+			Remote:   true,
+		})
+	}
+	assert.Equal(t, infoRequests, 1, "the daemon should only be asked when connecting")
+
+	podman := ConnectOrDie(ConnectOptions{Runtime: RuntimePodman, Host: host}, 5*time.Second, 5*time.Second)
+	assert.Equal(t, podman.RuntimeInfo().Name, RuntimePodman)
+	podman.RuntimeInfo()
+	assert.Equal(t, infoRequests, 2)
+}
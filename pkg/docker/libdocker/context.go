@@ -0,0 +1,97 @@
+package libdocker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// contextEndpoint is the docker endpoint of a docker context
+type contextEndpoint struct {
+	Host          string
+	SkipTLSVerify bool
+	CACert        string
+	Cert          string
+	Key           string
+}
+
+// contextMeta is the part of the metadata of a docker context we need, as
+// stored by the docker cli under contexts/meta/<sha256 of the name>/meta.json
+type contextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker")
+}
+
+// currentContext returns the context selected with DOCKER_CONTEXT or
+// 'docker context use'
+func currentContext() string {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dockerConfigDir(), "config.json"))
+	if err != nil {
+		return ""
+	}
+	config := struct {
+		CurrentContext string `json:"currentContext"`
+	}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ""
+	}
+	return config.CurrentContext
+}
+
+// getContextEndpoint reads the docker endpoint of the named context, or of
+// the current one when name is empty. The default context has no endpoint
+// of its own and yields nil.
+func getContextEndpoint(name string) (*contextEndpoint, error) {
+	if name == "" {
+		name = currentContext()
+	}
+	if name == "" || name == "default" {
+		return nil, nil
+	}
+	digest := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(digest[:])
+	data, err := ioutil.ReadFile(filepath.Join(dockerConfigDir(), "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Docker context %q not found", name)
+		}
+		return nil, fmt.Errorf("Failed to read docker context %q: %w", name, err)
+	}
+	meta := contextMeta{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("Failed to decode docker context %q: %w", name, err)
+	}
+	docker, ok := meta.Endpoints["docker"]
+	if !ok {
+		return nil, fmt.Errorf("Docker context %q has no docker endpoint", name)
+	}
+	endpoint := &contextEndpoint{
+		Host:          docker.Host,
+		SkipTLSVerify: docker.SkipTLSVerify,
+	}
+	tlsDir := filepath.Join(dockerConfigDir(), "contexts", "tls", id, "docker")
+	for file, field := range map[string]*string{"ca.pem": &endpoint.CACert, "cert.pem": &endpoint.Cert, "key.pem": &endpoint.Key} {
+		if _, err := os.Stat(filepath.Join(tlsDir, file)); err == nil {
+			*field = filepath.Join(tlsDir, file)
+		}
+	}
+	return endpoint, nil
+}
@@ -0,0 +1,44 @@
+package libdocker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestGetContextEndpoint(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "docker-config")
+	assert.Check(t, err)
+	defer os.RemoveAll(configDir)
+	os.Setenv("DOCKER_CONFIG", configDir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	digest := sha256.Sum256([]byte("remote"))
+	id := hex.EncodeToString(digest[:])
+	metaDir := filepath.Join(configDir, "contexts", "meta", id)
+	tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+	assert.Check(t, os.MkdirAll(metaDir, 0755))
+	assert.Check(t, os.MkdirAll(tlsDir, 0755))
+	meta := `{"Name":"remote","Endpoints":{"docker":{"Host":"tcp://remote:2376","SkipTLSVerify":false}}}`
+	assert.Check(t, ioutil.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0644))
+	assert.Check(t, ioutil.WriteFile(filepath.Join(tlsDir, "ca.pem"), []byte("ca"), 0644))
+	assert.Check(t, ioutil.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"currentContext":"remote"}`), 0644))
+
+	endpoint, err := getContextEndpoint("")
+	assert.Check(t, err)
+	assert.Equal(t, endpoint.Host, "tcp://remote:2376")
+	assert.Equal(t, endpoint.CACert, filepath.Join(tlsDir, "ca.pem"))
+	assert.Equal(t, endpoint.Cert, "")
+
+	endpoint, err = getContextEndpoint("default")
+	assert.Check(t, err)
+	assert.Assert(t, endpoint == nil)
+
+	_, err = getContextEndpoint("missing")
+	assert.Error(t, err, `Docker context "missing" not found`)
+}
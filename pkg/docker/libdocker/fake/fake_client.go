@@ -0,0 +1,921 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
+	dockermounttypes "github.com/docker/docker/api/types/mount"
+	dockernetworktypes "github.com/docker/docker/api/types/network"
+	dockerstdcopy "github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+)
+
+// ExecResult is the canned outcome of a command exec'd into a fake container
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExecHandler produces the result for cmd run in the named container
+type ExecHandler func(container string, cmd []string) ExecResult
+
+type fakeSubscriber struct {
+	options  dockertypes.EventsOptions
+	messages chan dockerevents.Message
+	errs     chan error
+}
+
+type fakeExec struct {
+	container string
+	cmd       []string
+	result    *ExecResult
+}
+
+// DockerClient is an in-memory implementation of libdocker.Interface. It keeps
+// track of containers, networks, images and execs so that the skupper client and
+// controller can be exercised without a docker daemon, and is primarily derived
+// from the kubelet FakeDockerClient.
+type DockerClient struct {
+	sync.Mutex
+	containers map[string]*dockertypes.ContainerJSON
+	networks   map[string]*dockertypes.NetworkResource
+	images     map[string]*dockertypes.ImageInspect
+	execs      map[string]*fakeExec
+	logs       map[string]string
+	errors     map[string]error
+	called     []string
+	nextID     int
+	nextIP     int
+	nextPort   int
+	watchers   []*fakeSubscriber
+	volumes    map[string]*fakeVolume
+
+	// ExecHandler is invoked for every exec, a nil handler returns empty output
+	ExecHandler ExecHandler
+	// Hostname is reported as the daemon name by Info
+	Hostname string
+	// Os is reported as the daemon operating system by Version and ServerVersion
+	Os string
+	// Runtime is reported by RuntimeInfo
+	Runtime libdocker.RuntimeInfo
+}
+
+// Make sure that DockerClient implemented the Interface.
+var _ libdocker.Interface = &DockerClient{}
+
+func NewDockerClient() *DockerClient {
+	return &DockerClient{
+		containers: map[string]*dockertypes.ContainerJSON{},
+		networks:   map[string]*dockertypes.NetworkResource{},
+		images:     map[string]*dockertypes.ImageInspect{},
+		execs:      map[string]*fakeExec{},
+		volumes:    map[string]*fakeVolume{},
+		logs:       map[string]string{},
+		errors:     map[string]error{},
+		Hostname:   "fake-docker-host",
+		Os:         "linux",
+		Runtime: libdocker.RuntimeInfo{
+			Name:   libdocker.RuntimeDocker,
+			Socket: "/var/run/docker.sock",
+		},
+	}
+}
+
+func (f *DockerClient) RuntimeInfo() libdocker.RuntimeInfo {
+	f.Lock()
+	defer f.Unlock()
+	return f.Runtime
+}
+
+// InjectError makes the next call to the named Interface method fail with err
+func (f *DockerClient) InjectError(fn string, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.errors[fn] = err
+}
+
+// Called returns the names of the Interface methods invoked so far, in order
+func (f *DockerClient) Called() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string{}, f.called...)
+}
+
+// ClearCalls resets the record of invoked methods
+func (f *DockerClient) ClearCalls() {
+	f.Lock()
+	defer f.Unlock()
+	f.called = []string{}
+}
+
+// SetLogs sets the output returned by Logs for the named container
+func (f *DockerClient) SetLogs(name string, logs string) {
+	f.Lock()
+	defer f.Unlock()
+	f.logs[strings.TrimPrefix(name, "/")] = logs
+}
+
+// AddImage registers an image as already present on the fake daemon
+func (f *DockerClient) AddImage(image string) {
+	f.Lock()
+	defer f.Unlock()
+	f.addImage(image)
+}
+
+// EmitEvent delivers msg to the Events subscribers whose filters match it
+func (f *DockerClient) EmitEvent(msg dockerevents.Message) {
+	f.Lock()
+	defer f.Unlock()
+	for _, w := range f.watchers {
+		if eventMatches(w.options, msg) {
+			w.messages <- msg
+		}
+	}
+}
+
+// FailEvents ends every Events subscription with err
+func (f *DockerClient) FailEvents(err error) {
+	f.Lock()
+	defer f.Unlock()
+	for _, w := range f.watchers {
+		w.errs <- err
+	}
+	f.watchers = nil
+}
+
+func eventMatches(options dockertypes.EventsOptions, msg dockerevents.Message) bool {
+	if !options.Filters.ExactMatch("type", msg.Type) || !options.Filters.ExactMatch("event", msg.Action) {
+		return false
+	}
+	if options.Filters.Contains("network") {
+		if msg.Type != dockerevents.NetworkEventType {
+			return false
+		}
+		return options.Filters.ExactMatch("network", msg.Actor.ID) || options.Filters.ExactMatch("network", msg.Actor.Attributes["name"])
+	}
+	return true
+}
+
+// SetImageConfig sets the container config recorded in the metadata of an image
+func (f *DockerClient) SetImageConfig(image string, config *dockercontainer.Config) {
+	f.Lock()
+	defer f.Unlock()
+	ii := f.addImage(image)
+	ii.Config = config
+}
+
+// SetNetworkGateway sets the IPAM gateway of a network, creating it if needed
+func (f *DockerClient) SetNetworkGateway(name string, gateway string) {
+	f.Lock()
+	defer f.Unlock()
+	n, ok := f.lookupNetwork(name)
+	if !ok {
+		n = &dockertypes.NetworkResource{
+			Name:       name,
+			ID:         f.newID(),
+			Created:    time.Now(),
+			Scope:      "local",
+			Driver:     "bridge",
+			Containers: map[string]dockertypes.EndpointResource{},
+			Options:    map[string]string{},
+			Labels:     map[string]string{},
+		}
+		f.networks[n.ID] = n
+	}
+	n.IPAM = dockernetworktypes.IPAM{
+		Driver: "default",
+		Config: []dockernetworktypes.IPAMConfig{{Gateway: gateway}},
+	}
+}
+
+// call records the invocation and returns any error injected for it, the lock must be held
+func (f *DockerClient) call(fn string) error {
+	f.called = append(f.called, fn)
+	if err, ok := f.errors[fn]; ok {
+		delete(f.errors, fn)
+		return err
+	}
+	return nil
+}
+
+func (f *DockerClient) newID() string {
+	f.nextID++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("fake-%d-%d", f.nextID, time.Now().UnixNano())))
+	return fmt.Sprintf("%x", sum)
+}
+
+func (f *DockerClient) newIP() string {
+	f.nextIP++
+	return fmt.Sprintf("172.18.%d.%d", f.nextIP/254, f.nextIP%254+1)
+}
+
+func containerNotFound(id string) error {
+	return fmt.Errorf("Error: No such container: %s", id)
+}
+
+func networkNotFound(id string) error {
+	return fmt.Errorf("Error: No such network: %s", id)
+}
+
+// lookupContainer finds a container by name, id or id prefix, the lock must be held
+func (f *DockerClient) lookupContainer(id string) (*dockertypes.ContainerJSON, bool) {
+	name := "/" + strings.TrimPrefix(id, "/")
+	for cid, c := range f.containers {
+		if c.Name == name || cid == id || (len(id) >= 12 && strings.HasPrefix(cid, id)) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func (f *DockerClient) lookupNetwork(id string) (*dockertypes.NetworkResource, bool) {
+	for _, n := range f.networks {
+		if n.Name == id || n.ID == id {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func (f *DockerClient) addImage(image string) *dockertypes.ImageInspect {
+	if ii, ok := f.images[image]; ok {
+		return ii
+	}
+	sum := sha256.Sum256([]byte(image))
+	repo := strings.SplitN(image, ":", 2)[0]
+	ii := &dockertypes.ImageInspect{
+		ID:          fmt.Sprintf("sha256:%x", sum),
+		RepoTags:    []string{image},
+		RepoDigests: []string{fmt.Sprintf("%s@sha256:%x", repo, sum)},
+		Os:          f.Os,
+		Created:     time.Now().Format(time.RFC3339Nano),
+		Config:      &dockercontainer.Config{Labels: map[string]string{}},
+	}
+	f.images[image] = ii
+	return ii
+}
+
+func (f *DockerClient) connect(n *dockertypes.NetworkResource, c *dockertypes.ContainerJSON, aliases []string) {
+	if _, ok := n.Containers[c.ID]; ok {
+		return
+	}
+	ip := f.newIP()
+	n.Containers[c.ID] = dockertypes.EndpointResource{
+		Name:        strings.TrimPrefix(c.Name, "/"),
+		EndpointID:  f.newID(),
+		IPv4Address: ip + "/16",
+	}
+	c.NetworkSettings.Networks[n.Name] = &dockernetworktypes.EndpointSettings{
+		Aliases:     aliases,
+		NetworkID:   n.ID,
+		IPAddress:   ip,
+		IPPrefixLen: 16,
+	}
+}
+
+func (f *DockerClient) disconnect(n *dockertypes.NetworkResource, c *dockertypes.ContainerJSON) {
+	delete(n.Containers, c.ID)
+	delete(c.NetworkSettings.Networks, n.Name)
+}
+
+func asContainer(c *dockertypes.ContainerJSON) dockertypes.Container {
+	networks := map[string]*dockernetworktypes.EndpointSettings{}
+	for k, v := range c.NetworkSettings.Networks {
+		networks[k] = v
+	}
+	return dockertypes.Container{
+		ID:              c.ID,
+		Names:           []string{c.Name},
+		Image:           c.Config.Image,
+		ImageID:         c.Image,
+		Command:         strings.Join(c.Config.Cmd, " "),
+		Labels:          c.Config.Labels,
+		State:           c.State.Status,
+		Status:          c.State.Status,
+		NetworkSettings: &dockertypes.SummaryNetworkSettings{Networks: networks},
+		Mounts:          c.Mounts,
+	}
+}
+
+func (f *DockerClient) ListContainers(options dockertypes.ContainerListOptions) ([]dockertypes.Container, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("ListContainers"); err != nil {
+		return nil, err
+	}
+	containers := []dockertypes.Container{}
+	for _, c := range f.containers {
+		if !options.All && !c.State.Running {
+			continue
+		}
+		if options.Filters.Contains("label") && !options.Filters.MatchKVList("label", c.Config.Labels) {
+			continue
+		}
+		if options.Filters.Contains("name") && !options.Filters.Match("name", strings.TrimPrefix(c.Name, "/")) {
+			continue
+		}
+		if options.Filters.Contains("status") && !options.Filters.ExactMatch("status", c.State.Status) {
+			continue
+		}
+		containers = append(containers, asContainer(c))
+	}
+	return containers, nil
+}
+
+func (f *DockerClient) InspectContainer(id string) (*dockertypes.ContainerJSON, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("InspectContainer"); err != nil {
+		return nil, err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return nil, containerNotFound(id)
+	}
+	return c, nil
+}
+
+func (f *DockerClient) CreateContainer(opts dockertypes.ContainerCreateConfig) (*dockercontainer.ContainerCreateCreatedBody, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("CreateContainer"); err != nil {
+		return nil, err
+	}
+	if opts.Config == nil {
+		return nil, fmt.Errorf("Config cannot be empty in order to create a container")
+	}
+	if opts.Name != "" {
+		if _, ok := f.lookupContainer(opts.Name); ok {
+			return nil, fmt.Errorf("Conflict. The container name \"/%s\" is already in use", opts.Name)
+		}
+	}
+	hostConfig := opts.HostConfig
+	if hostConfig == nil {
+		hostConfig = &dockercontainer.HostConfig{}
+	}
+	networks := []*dockertypes.NetworkResource{}
+	aliases := map[string][]string{}
+	if opts.NetworkingConfig != nil {
+		for name, endpoint := range opts.NetworkingConfig.EndpointsConfig {
+			n, ok := f.lookupNetwork(name)
+			if !ok {
+				return nil, fmt.Errorf("network %s not found", name)
+			}
+			networks = append(networks, n)
+			if endpoint != nil {
+				aliases[n.Name] = endpoint.Aliases
+			}
+		}
+	}
+
+	id := f.newID()
+	name := opts.Name
+	if name == "" {
+		name = id[:12]
+	}
+	image := f.addImage(opts.Config.Image)
+	mounts := []dockertypes.MountPoint{}
+	for _, m := range hostConfig.Mounts {
+		if m.Type == dockermounttypes.TypeVolume {
+			f.addVolume(m.Source, nil)
+		}
+		mounts = append(mounts, dockertypes.MountPoint{
+			Type:        m.Type,
+			Name:        m.Source,
+			Source:      m.Source,
+			Destination: m.Target,
+			RW:          !m.ReadOnly,
+		})
+	}
+	c := &dockertypes.ContainerJSON{
+		ContainerJSONBase: &dockertypes.ContainerJSONBase{
+			ID:         id,
+			Created:    time.Now().Format(time.RFC3339Nano),
+			Name:       "/" + name,
+			Image:      image.ID,
+			HostConfig: hostConfig,
+			State: &dockertypes.ContainerState{
+				Status: "created",
+			},
+		},
+		Mounts: mounts,
+		Config: opts.Config,
+		NetworkSettings: &dockertypes.NetworkSettings{
+			Networks: map[string]*dockernetworktypes.EndpointSettings{},
+		},
+	}
+	f.containers[id] = c
+	for _, n := range networks {
+		f.connect(n, c, append([]string{name}, aliases[n.Name]...))
+	}
+	return &dockercontainer.ContainerCreateCreatedBody{ID: id}, nil
+}
+
+func (f *DockerClient) StartContainer(id string) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("StartContainer"); err != nil {
+		return err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return containerNotFound(id)
+	}
+	c.State.Status = "running"
+	c.State.Running = true
+	c.State.Pid = 4242
+	c.State.ExitCode = 0
+	c.State.StartedAt = time.Now().Format(time.RFC3339Nano)
+	f.publish(c)
+	return nil
+}
+
+// publish reports the host ports of the port bindings of a started container,
+// ports left to the daemon are allocated from the ephemeral range
+func (f *DockerClient) publish(c *dockertypes.ContainerJSON) {
+	ports := nat.PortMap{}
+	for port, bindings := range c.HostConfig.PortBindings {
+		for _, b := range bindings {
+			if b.HostPort == "" {
+				f.nextPort++
+				b.HostPort = strconv.Itoa(32767 + f.nextPort)
+			}
+			if b.HostIP == "" {
+				b.HostIP = "0.0.0.0"
+			}
+			ports[port] = append(ports[port], b)
+		}
+	}
+	c.NetworkSettings.Ports = ports
+}
+
+func (f *DockerClient) RestartContainer(id string, timeout time.Duration) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("RestartContainer"); err != nil {
+		return err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return containerNotFound(id)
+	}
+	c.State.Status = "running"
+	c.State.Running = true
+	c.RestartCount++
+	c.State.StartedAt = time.Now().Format(time.RFC3339Nano)
+	return nil
+}
+
+func (f *DockerClient) StopContainer(id string, timeout time.Duration) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("StopContainer"); err != nil {
+		return err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return containerNotFound(id)
+	}
+	c.State.Status = "exited"
+	c.State.Running = false
+	c.State.Pid = 0
+	c.State.FinishedAt = time.Now().Format(time.RFC3339Nano)
+	return nil
+}
+
+func (f *DockerClient) WaitContainer(id string, timeout time.Duration) error {
+	f.Lock()
+	defer f.Unlock()
+	return f.call("WaitContainer")
+}
+
+func (f *DockerClient) UpdateContainerResources(id string, updateConfig dockercontainer.UpdateConfig) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("UpdateContainerResources"); err != nil {
+		return err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return containerNotFound(id)
+	}
+	c.HostConfig.Resources = updateConfig.Resources
+	return nil
+}
+
+func (f *DockerClient) RemoveContainer(id string, opts dockertypes.ContainerRemoveOptions) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("RemoveContainer"); err != nil {
+		return err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return containerNotFound(id)
+	}
+	if c.State.Running && !opts.Force {
+		return fmt.Errorf("You cannot remove a running container %s. Stop the container before attempting removal or force remove", c.ID)
+	}
+	for _, n := range f.networks {
+		f.disconnect(n, c)
+	}
+	delete(f.containers, c.ID)
+	return nil
+}
+
+func (f *DockerClient) inspectImage(ref string) (*dockertypes.ImageInspect, error) {
+	for name, ii := range f.images {
+		if name == ref || ii.ID == ref {
+			return ii, nil
+		}
+	}
+	return nil, libdocker.ImageNotFoundError{ID: ref}
+}
+
+func (f *DockerClient) InspectImageByRef(imageRef string) (*dockertypes.ImageInspect, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("InspectImageByRef"); err != nil {
+		return nil, err
+	}
+	return f.inspectImage(imageRef)
+}
+
+func (f *DockerClient) InspectImageByID(imageID string) (*dockertypes.ImageInspect, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("InspectImageByID"); err != nil {
+		return nil, err
+	}
+	return f.inspectImage(imageID)
+}
+
+func (f *DockerClient) ListImages(opts dockertypes.ImageListOptions) ([]dockertypes.ImageSummary, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("ListImages"); err != nil {
+		return nil, err
+	}
+	images := []dockertypes.ImageSummary{}
+	for _, ii := range f.images {
+		images = append(images, dockertypes.ImageSummary{
+			ID:          ii.ID,
+			RepoTags:    ii.RepoTags,
+			RepoDigests: ii.RepoDigests,
+			Labels:      ii.Config.Labels,
+		})
+	}
+	return images, nil
+}
+
+func (f *DockerClient) PullImage(image string, auth dockertypes.AuthConfig, opts dockertypes.ImagePullOptions) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("PullImage"); err != nil {
+		return err
+	}
+	f.addImage(image)
+	return nil
+}
+
+func (f *DockerClient) RemoveImage(image string, opts dockertypes.ImageRemoveOptions) ([]dockertypes.ImageDeleteResponseItem, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("RemoveImage"); err != nil {
+		return nil, err
+	}
+	ii, err := f.inspectImage(image)
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range f.images {
+		if v == ii {
+			delete(f.images, name)
+		}
+	}
+	return []dockertypes.ImageDeleteResponseItem{{Deleted: ii.ID}}, nil
+}
+
+func (f *DockerClient) Logs(id string, opts dockertypes.ContainerLogsOptions, sopts libdocker.StreamOptions) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("Logs"); err != nil {
+		return err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return containerNotFound(id)
+	}
+	if sopts.OutputStream != nil {
+		_, err := io.WriteString(sopts.OutputStream, f.logs[strings.TrimPrefix(c.Name, "/")])
+		return err
+	}
+	return nil
+}
+
+func (f *DockerClient) Version() (*dockertypes.Version, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("Version"); err != nil {
+		return nil, err
+	}
+	return &dockertypes.Version{
+		Version:    "19.03.0-fake",
+		APIVersion: "1.40",
+		Os:         f.Os,
+		Arch:       "amd64",
+	}, nil
+}
+
+func (f *DockerClient) Info() (*dockertypes.Info, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("Info"); err != nil {
+		return nil, err
+	}
+	return &dockertypes.Info{
+		ID:              "FAKE:DOCKER:CLIENT",
+		Name:            f.Hostname,
+		Containers:      len(f.containers),
+		Images:          len(f.images),
+		OSType:          f.Os,
+		OperatingSystem: "fake",
+		ServerVersion:   "19.03.0-fake",
+	}, nil
+}
+
+// runExec evaluates the exec through ExecHandler once and caches the result, the lock must be held
+func (f *DockerClient) runExec(id string) (*ExecResult, error) {
+	e, ok := f.execs[id]
+	if !ok {
+		return nil, fmt.Errorf("No such exec instance: %s", id)
+	}
+	if e.result == nil {
+		result := ExecResult{}
+		if f.ExecHandler != nil {
+			result = f.ExecHandler(e.container, e.cmd)
+		}
+		e.result = &result
+	}
+	return e.result, nil
+}
+
+func (f *DockerClient) AttachExec(id string, opts dockertypes.ExecStartCheck) (*dockertypes.HijackedResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("AttachExec"); err != nil {
+		return nil, err
+	}
+	result, err := f.runExec(id)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if opts.Tty {
+		buf.WriteString(result.Stdout + result.Stderr)
+	} else {
+		dockerstdcopy.NewStdWriter(&buf, dockerstdcopy.Stdout).Write([]byte(result.Stdout))
+		dockerstdcopy.NewStdWriter(&buf, dockerstdcopy.Stderr).Write([]byte(result.Stderr))
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return &dockertypes.HijackedResponse{
+		Conn:   client,
+		Reader: bufio.NewReader(&buf),
+	}, nil
+}
+
+func (f *DockerClient) CreateExec(id string, opts dockertypes.ExecConfig) (*dockertypes.IDResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("CreateExec"); err != nil {
+		return nil, err
+	}
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return nil, containerNotFound(id)
+	}
+	if !c.State.Running {
+		return nil, fmt.Errorf("Container %s is not running", c.ID)
+	}
+	execID := f.newID()
+	f.execs[execID] = &fakeExec{
+		container: strings.TrimPrefix(c.Name, "/"),
+		cmd:       opts.Cmd,
+	}
+	c.ExecIDs = append(c.ExecIDs, execID)
+	return &dockertypes.IDResponse{ID: execID}, nil
+}
+
+func (f *DockerClient) StartExec(startExec string, opts dockertypes.ExecStartCheck, sopts libdocker.StreamOptions) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("StartExec"); err != nil {
+		return err
+	}
+	result, err := f.runExec(startExec)
+	if err != nil {
+		return err
+	}
+	if opts.Detach {
+		return nil
+	}
+	if sopts.OutputStream != nil {
+		io.WriteString(sopts.OutputStream, result.Stdout)
+	}
+	if sopts.ErrorStream != nil {
+		io.WriteString(sopts.ErrorStream, result.Stderr)
+	}
+	return nil
+}
+
+func (f *DockerClient) InspectExec(id string) (*dockertypes.ContainerExecInspect, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("InspectExec"); err != nil {
+		return nil, err
+	}
+	e, ok := f.execs[id]
+	if !ok {
+		return nil, fmt.Errorf("No such exec instance: %s", id)
+	}
+	inspect := &dockertypes.ContainerExecInspect{
+		ExecID:      id,
+		ContainerID: e.container,
+	}
+	if e.result != nil {
+		inspect.ExitCode = e.result.ExitCode
+	} else {
+		inspect.Running = true
+	}
+	return inspect, nil
+}
+
+func (f *DockerClient) InspectNetwork(id string) (dockertypes.NetworkResource, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("InspectNetwork"); err != nil {
+		return dockertypes.NetworkResource{}, err
+	}
+	n, ok := f.lookupNetwork(id)
+	if !ok {
+		return dockertypes.NetworkResource{}, networkNotFound(id)
+	}
+	result := *n
+	result.Containers = map[string]dockertypes.EndpointResource{}
+	for k, v := range n.Containers {
+		result.Containers[k] = v
+	}
+	return result, nil
+}
+
+func (f *DockerClient) CreateNetwork(id string) (dockertypes.NetworkCreateResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("CreateNetwork"); err != nil {
+		return dockertypes.NetworkCreateResponse{}, err
+	}
+	if _, ok := f.lookupNetwork(id); ok {
+		return dockertypes.NetworkCreateResponse{}, fmt.Errorf("network with name %s already exists", id)
+	}
+	n := &dockertypes.NetworkResource{
+		Name:       id,
+		ID:         f.newID(),
+		Created:    time.Now(),
+		Scope:      "local",
+		Driver:     "bridge",
+		Containers: map[string]dockertypes.EndpointResource{},
+		Options:    map[string]string{},
+		Labels:     map[string]string{},
+	}
+	f.networks[n.ID] = n
+	return dockertypes.NetworkCreateResponse{ID: n.ID}, nil
+}
+
+func (f *DockerClient) ConnectContainerToNetwork(id string, containerid string) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("ConnectContainerToNetwork"); err != nil {
+		return err
+	}
+	n, ok := f.lookupNetwork(id)
+	if !ok {
+		return networkNotFound(id)
+	}
+	c, ok := f.lookupContainer(containerid)
+	if !ok {
+		return containerNotFound(containerid)
+	}
+	if _, ok := n.Containers[c.ID]; ok {
+		return fmt.Errorf("endpoint with name %s already exists in network %s", strings.TrimPrefix(c.Name, "/"), n.Name)
+	}
+	f.connect(n, c, nil)
+	return nil
+}
+
+func (f *DockerClient) DisconnectContainerFromNetwork(id string, containerid string, force bool) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("DisconnectContainerFromNetwork"); err != nil {
+		return err
+	}
+	n, ok := f.lookupNetwork(id)
+	if !ok {
+		return networkNotFound(id)
+	}
+	c, ok := f.lookupContainer(containerid)
+	if !ok {
+		return containerNotFound(containerid)
+	}
+	if _, ok := n.Containers[c.ID]; !ok {
+		return fmt.Errorf("container %s is not connected to network %s", c.ID, n.Name)
+	}
+	f.disconnect(n, c)
+	return nil
+}
+
+func (f *DockerClient) RemoveNetwork(id string) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("RemoveNetwork"); err != nil {
+		return err
+	}
+	n, ok := f.lookupNetwork(id)
+	if !ok {
+		return networkNotFound(id)
+	}
+	if len(n.Containers) > 0 {
+		return fmt.Errorf("error while removing network: network %s id %s has active endpoints", n.Name, n.ID)
+	}
+	delete(f.networks, n.ID)
+	return nil
+}
+
+func (f *DockerClient) ServerVersion() (dockertypes.Version, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("ServerVersion"); err != nil {
+		return dockertypes.Version{}, err
+	}
+	return dockertypes.Version{
+		Version:    "19.03.0-fake",
+		APIVersion: "1.40",
+		Os:         f.Os,
+		Arch:       "amd64",
+	}, nil
+}
+
+func (f *DockerClient) Events(options dockertypes.EventsOptions, stopCh <-chan struct{}) (<-chan dockerevents.Message, <-chan error) {
+	f.Lock()
+	defer f.Unlock()
+	w := &fakeSubscriber{
+		options:  options,
+		messages: make(chan dockerevents.Message, 100),
+		errs:     make(chan error, 1),
+	}
+	if err := f.call("Events"); err != nil {
+		w.errs <- err
+		return w.messages, w.errs
+	}
+	f.watchers = append(f.watchers, w)
+	go func() {
+		<-stopCh
+		f.Lock()
+		defer f.Unlock()
+		for i, other := range f.watchers {
+			if other == w {
+				f.watchers = append(f.watchers[:i], f.watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return w.messages, w.errs
+}
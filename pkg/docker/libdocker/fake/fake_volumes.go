@@ -0,0 +1,201 @@
+package fake
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockermounttypes "github.com/docker/docker/api/types/mount"
+)
+
+// fakeVolume keeps the files of a named volume in memory, keyed by their
+// path relative to the root of the volume, directories having nil content
+type fakeVolume struct {
+	labels map[string]string
+	files  map[string][]byte
+}
+
+func volumeNotFound(name string) error {
+	return fmt.Errorf("Error: No such volume: %s", name)
+}
+
+// addVolume creates the named volume if needed, the lock must be held
+func (f *DockerClient) addVolume(name string, labels map[string]string) *fakeVolume {
+	if v, ok := f.volumes[name]; ok {
+		return v
+	}
+	v := &fakeVolume{
+		labels: labels,
+		files:  map[string][]byte{},
+	}
+	f.volumes[name] = v
+	return v
+}
+
+// VolumeFiles returns the content of the files of a volume by relative path
+func (f *DockerClient) VolumeFiles(name string) map[string]string {
+	f.Lock()
+	defer f.Unlock()
+	files := map[string]string{}
+	if v, ok := f.volumes[name]; ok {
+		for p, data := range v.files {
+			if data != nil {
+				files[p] = string(data)
+			}
+		}
+	}
+	return files
+}
+
+func (f *DockerClient) CreateVolume(name string, labels map[string]string) (dockertypes.Volume, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("CreateVolume"); err != nil {
+		return dockertypes.Volume{}, err
+	}
+	v := f.addVolume(name, labels)
+	return dockertypes.Volume{Name: name, Driver: "local", Labels: v.labels}, nil
+}
+
+func (f *DockerClient) InspectVolume(name string) (dockertypes.Volume, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("InspectVolume"); err != nil {
+		return dockertypes.Volume{}, err
+	}
+	v, ok := f.volumes[name]
+	if !ok {
+		return dockertypes.Volume{}, volumeNotFound(name)
+	}
+	return dockertypes.Volume{Name: name, Driver: "local", Labels: v.labels}, nil
+}
+
+func (f *DockerClient) RemoveVolume(name string, force bool) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("RemoveVolume"); err != nil {
+		return err
+	}
+	if _, ok := f.volumes[name]; !ok {
+		if force {
+			return nil
+		}
+		return volumeNotFound(name)
+	}
+	for _, c := range f.containers {
+		for _, m := range c.Mounts {
+			if m.Type == dockermounttypes.TypeVolume && m.Name == name {
+				return fmt.Errorf("Error response from daemon: remove %s: volume is in use - [%s]", name, c.ID)
+			}
+		}
+	}
+	delete(f.volumes, name)
+	return nil
+}
+
+// lookupVolumePath resolves a path of a container to a volume mounted there
+// and the path relative to its root, the lock must be held
+func (f *DockerClient) lookupVolumePath(id string, p string) (*fakeVolume, string, error) {
+	c, ok := f.lookupContainer(id)
+	if !ok {
+		return nil, "", containerNotFound(id)
+	}
+	p = path.Clean(p)
+	for _, m := range c.Mounts {
+		if m.Type != dockermounttypes.TypeVolume {
+			continue
+		}
+		target := path.Clean(m.Destination)
+		if p == target || strings.HasPrefix(p, target+"/") {
+			return f.addVolume(m.Name, nil), strings.TrimPrefix(strings.TrimPrefix(p, target), "/"), nil
+		}
+	}
+	return nil, "", fmt.Errorf("Error: No such container:path: %s:%s", id, p)
+}
+
+func (f *DockerClient) CopyToContainer(id string, p string, content io.Reader) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("CopyToContainer"); err != nil {
+		return err
+	}
+	v, rel, err := f.lookupVolumePath(id, p)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path.Join(rel, hdr.Name), "/")
+		if hdr.Typeflag == tar.TypeDir {
+			v.files[name] = nil
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		v.files[name] = data
+	}
+}
+
+func (f *DockerClient) CopyFromContainer(id string, p string) (io.ReadCloser, error) {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.call("CopyFromContainer"); err != nil {
+		return nil, err
+	}
+	v, rel, err := f.lookupVolumePath(id, p)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.files[rel]; rel != "" && !ok {
+		return nil, fmt.Errorf("Error: No such container:path: %s:%s", id, p)
+	}
+	names := []string{}
+	for name := range v.files {
+		if rel == "" || strings.HasPrefix(name, rel+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	base := path.Base(path.Clean(p))
+	if err := tw.WriteHeader(&tar.Header{Name: base + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		entry := path.Join(base, strings.TrimPrefix(strings.TrimPrefix(name, rel), "/"))
+		data := v.files[name]
+		if data == nil {
+			if err := tw.WriteHeader(&tar.Header{Name: entry + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: entry, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(&buf), nil
+}
@@ -0,0 +1,44 @@
+package libdocker
+
+import (
+	dockertypes "github.com/docker/docker/api/types"
+)
+
+// podmanClient talks to the docker compatible REST API of podman, it only
+// overrides the calls where podman departs from docker. The libpod endpoints
+// are not used, so what the compatible API of podman lacks is not available.
+type podmanClient struct {
+	*skupDockerClient
+}
+
+// Make sure that podmanClient implemented the Interface.
+var _ Interface = &podmanClient{}
+
+func newPodmanClient(skup *skupDockerClient) Interface {
+	return &podmanClient{
+		skupDockerClient: skup,
+	}
+}
+
+// CreateNetwork creates a plain bridge network, podman rejects the docker
+// specific bridge options
+func (d *podmanClient) CreateNetwork(id string) (dockertypes.NetworkCreateResponse, error) {
+	ctx, cancel := d.getTimeoutContext()
+	defer cancel()
+	ncr, err := d.client.NetworkCreate(ctx, id, dockertypes.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+	})
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return ncr, ctxErr
+	}
+	if err != nil {
+		return ncr, err
+	}
+	return ncr, nil
+}
+
+// RuntimeInfo reports the podman socket and whether podman runs rootless
+func (d *podmanClient) RuntimeInfo() RuntimeInfo {
+	return d.getRuntimeInfo(RuntimePodman)
+}
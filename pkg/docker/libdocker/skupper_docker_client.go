@@ -9,14 +9,17 @@ import (
 	"io"
 	"io/ioutil"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
 	dockercontainer "github.com/docker/docker/api/types/container"
+	dockerevents "github.com/docker/docker/api/types/events"
 
 	// dockerimagetypes "github.com/docker/docker/api/types/image"
 	dockernetworktypes "github.com/docker/docker/api/types/network"
+	dockervolumetypes "github.com/docker/docker/api/types/volume"
 	dockerapi "github.com/docker/docker/client"
 	dockermessage "github.com/docker/docker/pkg/jsonmessage"
 	dockerstdcopy "github.com/docker/docker/pkg/stdcopy"
@@ -34,6 +37,9 @@ type skupDockerClient struct {
 	// between progress updates.
 	imagePullProgressDeadline time.Duration
 	client                    *dockerapi.Client
+	// info is the runtime found when connecting, it does not change for the
+	// life of the client
+	info *RuntimeInfo
 }
 
 // Make sure that skupDockerClient implemented the Interface.
@@ -147,9 +153,17 @@ func (d *skupDockerClient) WaitContainer(id string, timeout time.Duration) error
 	ctx, cancel := d.getTimeoutContext()
 	defer cancel()
 
-	_, errC := d.client.ContainerWait(ctx, "skupper-router", "")
-	if waitErr := <-errC; waitErr != nil {
+	statusC, errC := d.client.ContainerWait(ctx, id, "")
+	select {
+	case waitErr := <-errC:
 		return waitErr
+	case status := <-statusC:
+		if status.Error != nil {
+			return fmt.Errorf("%s", status.Error.Message)
+		}
+		if status.StatusCode != 0 {
+			return fmt.Errorf("Container %s exited with status %d", id, status.StatusCode)
+		}
 	}
 	return nil
 }
@@ -240,6 +254,124 @@ func (d *skupDockerClient) ServerVersion() (dockertypes.Version, error) {
 	return version, nil
 }
 
+func (d *skupDockerClient) CreateVolume(name string, labels map[string]string) (dockertypes.Volume, error) {
+	ctx, cancel := d.getTimeoutContext()
+	defer cancel()
+	volume, err := d.client.VolumeCreate(ctx, dockervolumetypes.VolumeCreateBody{
+		Name:   name,
+		Labels: labels,
+	})
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return volume, ctxErr
+	}
+	if err != nil {
+		return volume, err
+	}
+	return volume, nil
+}
+
+func (d *skupDockerClient) InspectVolume(name string) (dockertypes.Volume, error) {
+	ctx, cancel := d.getTimeoutContext()
+	defer cancel()
+	volume, err := d.client.VolumeInspect(ctx, name)
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return volume, ctxErr
+	}
+	if err != nil {
+		return volume, err
+	}
+	return volume, nil
+}
+
+func (d *skupDockerClient) RemoveVolume(name string, force bool) error {
+	ctx, cancel := d.getTimeoutContext()
+	defer cancel()
+	err := d.client.VolumeRemove(ctx, name, force)
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CopyToContainer extracts the tar archive content into the directory path
+// of the container, which need not be running
+func (d *skupDockerClient) CopyToContainer(id string, path string, content io.Reader) error {
+	ctx, cancel := d.getCancelableContext()
+	defer cancel()
+	return d.client.CopyToContainer(ctx, id, path, content, dockertypes.CopyToContainerOptions{})
+}
+
+// CopyFromContainer returns a tar archive of path in the container, the
+// entries are rooted at the base name of path
+func (d *skupDockerClient) CopyFromContainer(id string, path string) (io.ReadCloser, error) {
+	ctx, cancel := d.getCancelableContext()
+	reader, _, err := d.client.CopyFromContainer(ctx, id, path)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelReadCloser{ReadCloser: reader, cancel: cancel}, nil
+}
+
+// cancelReadCloser releases the context of a streamed response on Close
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// RuntimeInfo reports the socket docker is reached on and whether it runs rootless
+func (d *skupDockerClient) RuntimeInfo() RuntimeInfo {
+	return d.getRuntimeInfo(RuntimeDocker)
+}
+
+// getRuntimeInfo returns the runtime found when connecting, asking the daemon
+// only when the client was not made by ConnectOrDie
+func (d *skupDockerClient) getRuntimeInfo(name string) RuntimeInfo {
+	if d.info == nil {
+		info := d.runtimeInfo(name)
+		d.info = &info
+	}
+	return *d.info
+}
+
+func (d *skupDockerClient) runtimeInfo(name string) RuntimeInfo {
+	host := d.client.DaemonHost()
+	info := RuntimeInfo{
+		Name: name,
+		Host: host,
+	}
+	if strings.HasPrefix(host, "unix://") {
+		info.Socket = strings.TrimPrefix(host, "unix://")
+	}
+	info.Remote = !strings.HasPrefix(host, "unix://") && !strings.HasPrefix(host, "npipe://")
+	if daemon, err := d.Info(); err == nil {
+		for _, option := range daemon.SecurityOptions {
+			if option == "name=rootless" {
+				info.Rootless = true
+			}
+		}
+	}
+	return info
+}
+
+// Events streams the daemon events matching options until stopCh is closed
+func (d *skupDockerClient) Events(options dockertypes.EventsOptions, stopCh <-chan struct{}) (<-chan dockerevents.Message, <-chan error) {
+	ctx, cancel := d.getCancelableContext()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	return d.client.Events(ctx, options)
+}
+
 func base64EncodeAuth(auth dockertypes.AuthConfig) (string, error) {
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(auth); err != nil {
@@ -6,6 +6,7 @@ import (
 	dockertypes "github.com/docker/docker/api/types"
 
 	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+	"github.com/skupperproject/skupper-docker/pkg/utils"
 )
 
 func InspectNetwork(name string, dd libdocker.Interface) (dockertypes.NetworkResource, error) {
@@ -36,3 +37,43 @@ func NewTransportNetwork(name string, dd libdocker.Interface) (dockertypes.Netwo
 		return nw, fmt.Errorf("Unable to create network")
 	}
 }
+
+// slirp4netnsHost is the address rootless podman containers reach the host on
+const slirp4netnsHost = "10.0.2.2"
+
+// defaultBridgeNetworks are the networks containers join by default, whose
+// gateway is the host
+var defaultBridgeNetworks = map[string]string{
+	libdocker.RuntimeDocker: "bridge",
+	libdocker.RuntimePodman: "podman",
+}
+
+// HostGatewayAddress returns the address containers reach the host on: the
+// docker0 or podman bridge, or the slirp4netns gateway for rootless podman
+// which has no bridge on the host. The interfaces of a remote daemon are not
+// those of this host, so its default bridge network is asked for its gateway,
+// or the daemon left to resolve host-gateway itself.
+func HostGatewayAddress(dd libdocker.Interface) string {
+	runtime := dd.RuntimeInfo()
+	if runtime.Remote {
+		if network, err := dd.InspectNetwork(defaultBridgeNetworks[runtime.Name]); err == nil {
+			for _, config := range network.IPAM.Config {
+				if config.Gateway != "" {
+					return config.Gateway
+				}
+			}
+		}
+		return "host-gateway"
+	}
+	if runtime.Name != libdocker.RuntimePodman {
+		return utils.GetInternalIP("docker0")
+	}
+	if !runtime.Rootless {
+		for _, iface := range []string{"podman0", "cni-podman0"} {
+			if ip := utils.GetInternalIP(iface); ip != "" {
+				return ip
+			}
+		}
+	}
+	return slirp4netnsHost
+}
@@ -0,0 +1,315 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	dockermounttypes "github.com/docker/docker/api/types/mount"
+
+	"github.com/skupperproject/skupper-docker/api/types"
+	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
+)
+
+// the state volumes are reached through a helper container that is only
+// created, archives can be copied in and out of a container that never ran
+const (
+	stateContainerName string = "skupper-state"
+	stateRoot          string = "/skupper-state"
+)
+
+func stateContainer() string {
+	return types.GetSiteScopedName(stateContainerName)
+}
+
+func stateTarget(p types.Path) string {
+	return path.Join(stateRoot, types.GetSkupperVolume(p))
+}
+
+// stateImage returns the image of the running router, any image will do for
+// the helper container as long as it is present and has a shell toolbox
+func stateImage(dd libdocker.Interface) string {
+	if router, err := InspectContainer(types.GetTransportDeploymentName(), dd); err == nil && router.Config != nil {
+		return router.Config.Image
+	}
+	return getProxyImage()
+}
+
+func newStateContainer(entrypoint []string, dd libdocker.Interface) error {
+	// a helper left behind by an interrupted command is of no use
+	dd.RemoveContainer(stateContainer(), dockertypes.ContainerRemoveOptions{Force: true})
+
+	mounts := []dockermounttypes.Mount{}
+	for _, p := range types.StatePaths {
+		mounts = append(mounts, dockermounttypes.Mount{
+			Type:   dockermounttypes.TypeVolume,
+			Source: types.GetSkupperVolume(p),
+			Target: stateTarget(p),
+		})
+	}
+	_, err := dd.CreateContainer(dockertypes.ContainerCreateConfig{
+		Name: stateContainer(),
+		Config: &dockercontainer.Config{
+			Image:      stateImage(dd),
+			Entrypoint: entrypoint,
+			Labels: map[string]string{
+				"application":          types.TransportDeploymentName,
+				"skupper.io/component": "state",
+				types.SiteQualifier:    types.GetSiteName(),
+			},
+		},
+		HostConfig: &dockercontainer.HostConfig{
+			Mounts: mounts,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to create state helper container: %w", err)
+	}
+	return nil
+}
+
+func removeStateContainer(dd libdocker.Interface) {
+	dd.RemoveContainer(stateContainer(), dockertypes.ContainerRemoveOptions{Force: true})
+}
+
+// NewStateVolumes creates the volumes holding the site state
+func NewStateVolumes(dd libdocker.Interface) error {
+	for _, p := range types.StatePaths {
+		_, err := dd.CreateVolume(types.GetSkupperVolume(p), map[string]string{
+			"application":       types.TransportDeploymentName,
+			types.SiteQualifier: types.GetSiteName(),
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to create volume %s: %w", types.GetSkupperVolume(p), err)
+		}
+	}
+	return nil
+}
+
+// StateVolumesExist reports whether the site state has been placed in volumes
+func StateVolumesExist(dd libdocker.Interface) bool {
+	_, err := dd.InspectVolume(types.GetSkupperVolume(types.SitesPath))
+	return err == nil
+}
+
+// RemoveStateVolumes removes the volumes holding the site state
+func RemoveStateVolumes(dd libdocker.Interface) error {
+	removeStateContainer(dd)
+	for _, p := range types.StatePaths {
+		err := dd.RemoveVolume(types.GetSkupperVolume(p), true)
+		if err != nil {
+			return fmt.Errorf("Failed to remove volume %s: %w", types.GetSkupperVolume(p), err)
+		}
+	}
+	return nil
+}
+
+// archiveDir writes the content of dir to a tar archive, the entries are
+// relative to dir
+func archiveDir(dir string) (*bytes.Buffer, map[string]bool, error) {
+	var buf bytes.Buffer
+	entries := map[string]bool{}
+	tw := tar.NewWriter(&buf)
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entries[rel] = true
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if info.IsDir() {
+			hdr.Name = rel + "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return &buf, entries, nil
+}
+
+// volumeEntries lists the paths held in the volume of an area, relative to its root
+func volumeEntries(p types.Path, dd libdocker.Interface) ([]string, error) {
+	reader, err := dd.CopyFromContainer(stateContainer(), stateTarget(p))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	entries := []string{}
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rel := stripArchiveRoot(hdr.Name); rel != "" {
+			entries = append(entries, rel)
+		}
+	}
+}
+
+// stripArchiveRoot removes the directory an archive copied out of a container is rooted at
+func stripArchiveRoot(name string) string {
+	parts := strings.SplitN(strings.Trim(name, "/"), "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// CopyStateToVolumes makes the volumes of the given areas mirror the
+// working copy of the site state under SKUPPER_TMPDIR
+func CopyStateToVolumes(paths []types.Path, dd libdocker.Interface) error {
+	if err := NewStateVolumes(dd); err != nil {
+		return err
+	}
+	if err := newStateContainer([]string{"true"}, dd); err != nil {
+		return err
+	}
+	stale := []string{}
+	for _, p := range paths {
+		archive, entries, err := archiveDir(types.GetSkupperPath(p))
+		if os.IsNotExist(err) {
+			archive, entries, err = &bytes.Buffer{}, map[string]bool{}, nil
+			tar.NewWriter(archive).Close()
+		}
+		if err != nil {
+			removeStateContainer(dd)
+			return fmt.Errorf("Failed to archive %s: %w", types.GetSkupperPath(p), err)
+		}
+		if err := dd.CopyToContainer(stateContainer(), stateTarget(p), archive); err != nil {
+			removeStateContainer(dd)
+			return fmt.Errorf("Failed to copy %s to volume %s: %w", types.GetSkupperPath(p), types.GetSkupperVolume(p), err)
+		}
+		current, err := volumeEntries(p, dd)
+		if err != nil {
+			removeStateContainer(dd)
+			return fmt.Errorf("Failed to list volume %s: %w", types.GetSkupperVolume(p), err)
+		}
+		removed := map[string]bool{}
+		for _, entry := range current {
+			entry = strings.TrimSuffix(entry, "/")
+			if entries[entry] || removed[path.Dir(entry)] {
+				removed[entry] = removed[path.Dir(entry)]
+				continue
+			}
+			removed[entry] = true
+			stale = append(stale, path.Join(stateTarget(p), entry))
+		}
+	}
+	removeStateContainer(dd)
+	if len(stale) == 0 {
+		return nil
+	}
+
+	// archives cannot remove anything, the helper has to run for that
+	if err := newStateContainer(append([]string{"rm", "-rf", "--"}, stale...), dd); err != nil {
+		return err
+	}
+	defer removeStateContainer(dd)
+	if err := dd.StartContainer(stateContainer()); err != nil {
+		return fmt.Errorf("Failed to start state helper container: %w", err)
+	}
+	if err := dd.WaitContainer(stateContainer(), 30*time.Second); err != nil {
+		return fmt.Errorf("Failed to remove stale state from volumes: %w", err)
+	}
+	return nil
+}
+
+// CopyStateFromVolumes replaces the working copy of the given areas of the
+// site state with the content of their volumes
+func CopyStateFromVolumes(paths []types.Path, dd libdocker.Interface) error {
+	if err := newStateContainer([]string{"true"}, dd); err != nil {
+		return err
+	}
+	defer removeStateContainer(dd)
+	for _, p := range paths {
+		dir := types.GetSkupperPath(p)
+		reader, err := dd.CopyFromContainer(stateContainer(), stateTarget(p))
+		if err != nil {
+			return fmt.Errorf("Failed to copy volume %s: %w", types.GetSkupperVolume(p), err)
+		}
+		err = extractArchive(reader, dir)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to extract volume %s to %s: %w", types.GetSkupperVolume(p), dir, err)
+		}
+	}
+	return nil
+}
+
+func extractArchive(reader io.Reader, dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel := stripArchiveRoot(hdr.Name)
+		if rel == "" || strings.HasPrefix(path.Clean(rel), "..") {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if hdr.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -15,17 +15,23 @@ limitations under the License.
 package qdr
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/skupperproject/skupper-docker/api/types"
 	"github.com/skupperproject/skupper-docker/pkg/docker/libdocker"
 )
 
 type RouterNode struct {
-	Id      string `json:"id"`
-	Name    string `json:"name"`
-	NextHop string `json:"nextHop"`
+	Id        string   `json:"id"`
+	Name      string   `json:"name"`
+	NextHop   string   `json:"nextHop"`
+	Cost      int      `json:"cost"`
+	LinkState []string `json:"linkState"`
 }
 
 type ConnectedSites struct {
@@ -43,6 +49,59 @@ type Connection struct {
 	Dir        string `json:"dir"`
 }
 
+// RouterAddress is a router.address entity, its name is the address with a
+// prefix giving the address class (e.g. M for mobile addresses)
+type RouterAddress struct {
+	Name              string `json:"name"`
+	DeliveriesIngress int    `json:"deliveriesIngress"`
+	DeliveriesEgress  int    `json:"deliveriesEgress"`
+	DeliveriesTransit int    `json:"deliveriesTransit"`
+}
+
+// RouterLink is a router.link entity
+type RouterLink struct {
+	Name          string `json:"name"`
+	LinkType      string `json:"linkType"`
+	LinkDir       string `json:"linkDir"`
+	OwningAddr    string `json:"owningAddr"`
+	DeliveryCount int    `json:"deliveryCount"`
+}
+
+// TcpConnection is a tcpConnection entity, one per open connection on a tcp
+// listener (direction in) or connector (direction out)
+type TcpConnection struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Host      string `json:"host"`
+	Direction string `json:"direction"`
+	BytesIn   int64  `json:"bytesIn"`
+	BytesOut  int64  `json:"bytesOut"`
+}
+
+// HttpRequestInfo is an httpRequestInfo entity, the requests to an address
+// from or to one host
+type HttpRequestInfo struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Host      string `json:"host"`
+	Site      string `json:"site"`
+	Direction string `json:"direction"`
+	Requests  int64  `json:"requests"`
+	BytesIn   int64  `json:"bytesIn"`
+	BytesOut  int64  `json:"bytesOut"`
+}
+
+// GetAddressName strips the address class prefix (and the phase of mobile
+// addresses) from the name of a router.address or the owningAddr of a link
+func GetAddressName(name string) string {
+	if strings.HasPrefix(name, "M0") || strings.HasPrefix(name, "M1") {
+		return name[2:]
+	} else if len(name) > 1 {
+		return name[1:]
+	}
+	return name
+}
+
 func getQuery(typename string) []string {
 	return []string{
 		"qdmanage",
@@ -52,6 +111,150 @@ func getQuery(typename string) []string {
 	}
 }
 
+func getManageCommand(operation string, typename string, name string, attributes []string) []string {
+	return append([]string{
+		"qdmanage",
+		operation,
+		"--type",
+		typename,
+		"--name",
+		name,
+	}, attributes...)
+}
+
+// asAttributes renders an entity as name=value arguments for qdmanage, using
+// the same attribute names as the json config file
+func asAttributes(entity interface{}) ([]string, error) {
+	record := map[string]interface{}{}
+	if err := convert(entity, &record); err != nil {
+		return nil, err
+	}
+	attributes := []string{}
+	for k, v := range record {
+		if k == "name" {
+			continue
+		}
+		attributes = append(attributes, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(attributes)
+	return attributes, nil
+}
+
+func manage(operation string, typename string, name string, attributes []string, dd libdocker.Interface) error {
+	return manageContainer(types.GetTransportDeploymentName(), operation, typename, name, attributes, dd)
+}
+
+// manageContainer creates or deletes the named entity on the router running in
+// the container
+func manageContainer(container string, operation string, typename string, name string, attributes []string, dd libdocker.Interface) error {
+	execResult, err := containerExec(container, getManageCommand(operation, typename, name, attributes), dd)
+	if err != nil {
+		return err
+	}
+	if execResult.ExitCode != 0 {
+		return fmt.Errorf("%s %s %s failed: %s", operation, typename, name, strings.TrimSpace(execResult.Stderr()))
+	}
+	return nil
+}
+
+// CreateSslProfile adds the sslProfile to the running router
+func CreateSslProfile(profile SslProfile, dd libdocker.Interface) error {
+	attributes, err := asAttributes(profile)
+	if err != nil {
+		return err
+	}
+	return manage("create", "sslProfile", profile.Name, attributes, dd)
+}
+
+// DeleteSslProfile removes the sslProfile from the running router
+func DeleteSslProfile(name string, dd libdocker.Interface) error {
+	return manage("delete", "sslProfile", name, nil, dd)
+}
+
+// CreateConnector adds the connector to the running router, which starts
+// establishing the link straight away
+func CreateConnector(connector Connector, dd libdocker.Interface) error {
+	attributes, err := asAttributes(connector)
+	if err != nil {
+		return err
+	}
+	return manage("create", "connector", connector.Name, attributes, dd)
+}
+
+// DeleteConnector removes the connector from the running router, closing its link
+func DeleteConnector(name string, dd libdocker.Interface) error {
+	return manage("delete", "connector", name, nil, dd)
+}
+
+type bridgeEntity struct {
+	typename string
+	name     string
+	record   interface{}
+}
+
+// bridgeEntities keys the bridges of the config by management type and name
+func bridgeEntities(bc BridgeConfig) map[string]bridgeEntity {
+	entities := map[string]bridgeEntity{}
+	for name, e := range bc.TcpListeners {
+		entities["tcpListener/"+name] = bridgeEntity{"tcpListener", name, e}
+	}
+	for name, e := range bc.TcpConnectors {
+		entities["tcpConnector/"+name] = bridgeEntity{"tcpConnector", name, e}
+	}
+	for name, e := range bc.HttpListeners {
+		entities["httpListener/"+name] = bridgeEntity{"httpListener", name, e}
+	}
+	for name, e := range bc.HttpConnectors {
+		entities["httpConnector/"+name] = bridgeEntity{"httpConnector", name, e}
+	}
+	return entities
+}
+
+// UpdateRouterBridges moves the router running in the named container from the
+// bridges of config to the desired ones, deleting removed or changed bridges
+// before creating the new ones under the same name. It returns false when
+// UpdateBridgeConfig finds nothing to change.
+func UpdateRouterBridges(container string, config *RouterConfig, desired BridgeConfig, dd libdocker.Interface) (bool, error) {
+	previous := bridgeEntities(config.Bridges)
+	if !config.UpdateBridgeConfig(desired) {
+		return false, nil
+	}
+	current := bridgeEntities(desired)
+
+	deleted := []string{}
+	for key, e := range previous {
+		if c, ok := current[key]; !ok || !reflect.DeepEqual(c.record, e.record) {
+			deleted = append(deleted, key)
+		}
+	}
+	added := []string{}
+	for key, e := range current {
+		if p, ok := previous[key]; !ok || !reflect.DeepEqual(p.record, e.record) {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(deleted)
+	sort.Strings(added)
+
+	for _, key := range deleted {
+		e := previous[key]
+		if err := manageContainer(container, "delete", e.typename, e.name, nil, dd); err != nil {
+			return true, err
+		}
+	}
+	for _, key := range added {
+		e := current[key]
+		attributes, err := asAttributes(e.record)
+		if err != nil {
+			return true, err
+		}
+		if err := manageContainer(container, "create", e.typename, e.name, attributes, dd); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
 func GetConnectedSites(dd libdocker.Interface) (types.TransportConnectedSites, error) {
 	result := types.TransportConnectedSites{}
 	nodes, err := GetNodes(dd)
@@ -86,6 +289,32 @@ func GetNodes(dd libdocker.Interface) ([]RouterNode, error) {
 	}
 }
 
+// GetRouterMetadata returns the router entity of the router with the given
+// id, which can be any router in the network, or of the site router if the id
+// is empty
+func GetRouterMetadata(id string, dd libdocker.Interface) (RouterMetadata, error) {
+	command := getQuery("router")
+	if id != "" {
+		command = append(command, "--router", id)
+	}
+	execResult, err := routerExec(command, dd)
+	if err != nil {
+		return RouterMetadata{}, err
+	}
+	if execResult.ExitCode != 0 {
+		return RouterMetadata{}, fmt.Errorf("Query for router %s failed: %s", id, strings.TrimSpace(execResult.Stderr()))
+	}
+	results := []RouterMetadata{}
+	err = json.Unmarshal(execResult.outBuffer.Bytes(), &results)
+	if err != nil {
+		return RouterMetadata{}, fmt.Errorf("Failed to parse router query result: %w", err)
+	}
+	if len(results) == 0 {
+		return RouterMetadata{}, fmt.Errorf("Router %s not found", id)
+	}
+	return results[0], nil
+}
+
 func GetInterRouterOrEdgeConnection(host string, connections []Connection) *Connection {
 	for _, c := range connections {
 		if (c.Role == "inter-router" || c.Role == "edge") && c.Host == host {
@@ -112,9 +341,74 @@ func GetConnections(dd libdocker.Interface) ([]Connection, error) {
 	}
 }
 
+// QueryEntities returns the raw json output of a management query for the
+// given entity type (e.g. node, connection, router.link) on the site router
+func QueryEntities(typename string, dd libdocker.Interface) ([]byte, error) {
+	execResult, err := routerExec(getQuery(typename), dd)
+	if err != nil {
+		return nil, err
+	}
+	if execResult.ExitCode != 0 {
+		return nil, fmt.Errorf("Query for %s failed: %s", typename, execResult.Stderr())
+	}
+	return execResult.outBuffer.Bytes(), nil
+}
+
+// queryContainer runs a management query on the router in the named container
+// and decodes the entities into results. Entity types the router does not know
+// about, which qdmanage reports with a NotFoundStatus, yield no entities.
+func queryContainer(name string, typename string, results interface{}, dd libdocker.Interface) error {
+	execResult, err := containerExec(name, getQuery(typename), dd)
+	if err != nil {
+		return err
+	}
+	if execResult.ExitCode != 0 {
+		if strings.HasPrefix(strings.TrimSpace(execResult.Stderr()), "NotFoundStatus:") {
+			return nil
+		}
+		return fmt.Errorf("Query for %s failed: %s", typename, strings.TrimSpace(execResult.Stderr()))
+	}
+	if len(bytes.TrimSpace(execResult.outBuffer.Bytes())) == 0 {
+		return nil
+	}
+	err = json.Unmarshal(execResult.outBuffer.Bytes(), results)
+	if err != nil {
+		return fmt.Errorf("Failed to parse %s query result: %w", typename, err)
+	}
+	return nil
+}
+
+func GetAddresses(name string, dd libdocker.Interface) ([]RouterAddress, error) {
+	results := []RouterAddress{}
+	err := queryContainer(name, "router.address", &results, dd)
+	return results, err
+}
+
+func GetLinks(name string, dd libdocker.Interface) ([]RouterLink, error) {
+	results := []RouterLink{}
+	err := queryContainer(name, "router.link", &results, dd)
+	return results, err
+}
+
+func GetTcpConnections(name string, dd libdocker.Interface) ([]TcpConnection, error) {
+	results := []TcpConnection{}
+	err := queryContainer(name, "tcpConnection", &results, dd)
+	return results, err
+}
+
+func GetHttpRequestInfo(name string, dd libdocker.Interface) ([]HttpRequestInfo, error) {
+	results := []HttpRequestInfo{}
+	err := queryContainer(name, "httpRequestInfo", &results, dd)
+	return results, err
+}
+
 func routerExec(command []string, dd libdocker.Interface) (ExecResult, error) {
+	return containerExec(types.GetTransportDeploymentName(), command, dd)
+}
+
+func containerExec(name string, command []string, dd libdocker.Interface) (ExecResult, error) {
 
-	current, err := dd.InspectContainer("skupper-router")
+	current, err := dd.InspectContainer(name)
 	if err != nil {
 		fmt.Println("Error retrieving skupper router container: ", err.Error())
 		return ExecResult{}, err
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -205,6 +206,32 @@ type RouterMetadata struct {
 	Metadata string `json:"metadata,omitempty"`
 }
 
+// SiteMetadata identifies the site of a router, it is carried as json in the
+// metadata attribute of the router entity
+type SiteMetadata struct {
+	Id   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// GetSiteMetadata encodes the site id and name for RouterMetadata.Metadata
+func GetSiteMetadata(siteId string, siteName string) string {
+	encoded, err := json.Marshal(SiteMetadata{Id: siteId, Name: siteName})
+	if err != nil {
+		return siteId
+	}
+	return string(encoded)
+}
+
+// ParseSiteMetadata decodes RouterMetadata.Metadata, routers of older sites
+// carry just the site id
+func ParseSiteMetadata(metadata string) SiteMetadata {
+	site := SiteMetadata{}
+	if err := json.Unmarshal([]byte(metadata), &site); err != nil {
+		return SiteMetadata{Id: metadata}
+	}
+	return site
+}
+
 type SslProfile struct {
 	Name           string `json:"name,omitempty"`
 	CertFile       string `json:"certFile,omitempty"`
@@ -459,122 +486,129 @@ func MarshalRouterConfig(config RouterConfig) (string, error) {
 	return string(data), nil
 }
 
-func GetRouterConfigForProxy(definition types.ServiceInterface, siteId string) (string, error) {
-	config := InitialConfig("$HOSTNAME", siteId, true)
-	//add edge-connector
-	config.AddSslProfile(SslProfile{
-		Name: types.InterRouterProfile,
-	})
-	config.AddConnector(Connector{
-		Name:       "uplink",
-		SslProfile: types.InterRouterProfile,
-		Host:       "skupper-router",
-		Port:       strconv.Itoa(int(types.EdgeListenerPort)),
-		Role:       RoleEdge,
-	})
-	config.AddListener(Listener{
-		Name: "amqp",
-		Host: "localhost",
-		Port: 5672,
-	})
-	port := definition.Port
-	if definition.Origin == "" {
+// addServiceBridges adds the tcp or http listener and connectors that carry
+// each port of the service, local services also get a connector per target.
+// Every port of a service with several has its own address and bridge names
+func addServiceBridges(bc *BridgeConfig, definition types.ServiceInterface, siteId string, ingressName string, egressName func(string) string) {
+	ports := definition.GetPorts()
+	for _, port := range ports {
+		if len(ports) == 1 {
+			addPortBridges(bc, definition, port, definition.Address, siteId, ingressName, egressName)
+			continue
+		}
+		suffix := ":" + strconv.Itoa(port)
+		addPortBridges(bc, definition, port, definition.Address+suffix, siteId, ingressName+suffix, func(host string) string {
+			return egressName(host) + suffix
+		})
+	}
+}
+
+// addPortBridges adds the listener and connectors for one port of a service
+func addPortBridges(bc *BridgeConfig, definition types.ServiceInterface, port int, address string, siteId string, ingressName string, egressName func(string) string) {
+	if types.IsLocalOrigin(definition.Origin) {
 		host := definition.Address
 		switch definition.Protocol {
 		case "tcp":
-			config.AddTcpListener(TcpEndpoint{
-				Name:    "ingress",
+			bc.AddTcpListener(TcpEndpoint{
+				Name:    ingressName,
 				Host:    "0.0.0.0",
 				Port:    strconv.Itoa(port),
-				Address: definition.Address,
+				Address: address,
 				SiteId:  siteId,
 			})
 			for _, t := range definition.Targets {
-				tport := definition.Port
-				if t.TargetPort != 0 {
-					tport = t.TargetPort
-				}
+				tport := definition.GetTargetPort(t, port)
 				if t.Selector == "internal.skupper.io/container" {
-					config.AddTcpConnector(TcpEndpoint{
-						Name:    "egress-" + t.Name,
+					bc.AddTcpConnector(TcpEndpoint{
+						Name:    egressName(t.Name),
 						Host:    t.Name,
 						Port:    strconv.Itoa(tport),
-						Address: definition.Address,
+						Address: address,
 						SiteId:  siteId,
 					})
 				} else if t.Selector == "internal.skupper.io/host-service" {
 					thost := strings.Split(t.Name, ":")
-					config.AddTcpConnector(TcpEndpoint{
-						Name:    "egress-" + thost[0],
+					bc.AddTcpConnector(TcpEndpoint{
+						Name:    egressName(thost[0]),
 						Host:    thost[0],
 						Port:    strconv.Itoa(tport),
-						Address: definition.Address,
+						Address: address,
+						SiteId:  siteId,
+					})
+				}
+			}
+			// each instance of a headless service is reachable on its own address
+			if definition.Headless != nil {
+				for _, t := range instanceTargets(definition) {
+					tport := definition.GetTargetPort(t, port)
+					if definition.Headless.TargetPort != 0 && port == definition.Port {
+						tport = definition.Headless.TargetPort
+					}
+					bc.AddTcpConnector(TcpEndpoint{
+						Name:    egressName(definition.GetInstanceAddress(*t.Instance, definition.Address)),
+						Host:    t.Name,
+						Port:    strconv.Itoa(tport),
+						Address: definition.GetInstanceAddress(*t.Instance, address),
 						SiteId:  siteId,
 					})
 				}
 			}
 		case "http":
-			config.AddHttpListener(HttpEndpoint{
-				Name:    "ingress",
+			bc.AddHttpListener(HttpEndpoint{
+				Name:    ingressName,
 				Host:    host,
 				Port:    strconv.Itoa(port),
-				Address: definition.Address,
+				Address: address,
 				SiteId:  siteId,
 			})
 			for _, t := range definition.Targets {
-				tport := definition.Port
-				if t.TargetPort != 0 {
-					tport = t.TargetPort
-				}
+				tport := definition.GetTargetPort(t, port)
 				if t.Selector == "internal.skupper.io/container" {
-					config.AddHttpConnector(HttpEndpoint{
-						Name:    "egress-" + t.Name,
+					bc.AddHttpConnector(HttpEndpoint{
+						Name:    egressName(t.Name),
 						Host:    t.Name,
 						Port:    strconv.Itoa(tport),
-						Address: definition.Address,
+						Address: address,
 						SiteId:  siteId,
 					})
 				} else if t.Selector == "internal.skupper.io/host-service" {
 					thost := strings.Split(t.Name, ":")
-					config.AddHttpConnector(HttpEndpoint{
-						Name:    "egress-" + thost[0],
+					bc.AddHttpConnector(HttpEndpoint{
+						Name:    egressName(thost[0]),
 						Host:    thost[0],
 						Port:    strconv.Itoa(tport),
-						Address: definition.Address,
+						Address: address,
 						SiteId:  siteId,
 					})
 				}
 			}
 		case "http2":
-			config.AddHttpListener(HttpEndpoint{
-				Name:            "ingress",
+			bc.AddHttpListener(HttpEndpoint{
+				Name:            ingressName,
 				Host:            host,
 				Port:            strconv.Itoa(port),
-				Address:         definition.Address,
+				Address:         address,
 				ProtocolVersion: "HTTP/2.0",
 				SiteId:          siteId,
 			})
 			for _, t := range definition.Targets {
-				tport := definition.Port
-				if t.TargetPort != 0 {
-					tport = t.TargetPort
-				}
+				tport := definition.GetTargetPort(t, port)
 				if t.Selector == "internal.skupper.io/container" {
-					config.AddHttpConnector(HttpEndpoint{
-						Name:            "egress-" + t.Name,
+					bc.AddHttpConnector(HttpEndpoint{
+						Name:            egressName(t.Name),
 						Host:            t.Name,
 						Port:            strconv.Itoa(tport),
-						Address:         definition.Address,
+						Address:         address,
 						ProtocolVersion: "HTTP/2.0",
 						SiteId:          siteId,
 					})
 				} else if t.Selector == "internal.skupper.io/host-service" {
 					thost := strings.Split(t.Name, ":")
-					config.AddHttpConnector(HttpEndpoint{
-						Name:            "egress-" + thost[0],
+					bc.AddHttpConnector(HttpEndpoint{
+						Name:            egressName(thost[0]),
 						Host:            thost[0],
 						Port:            strconv.Itoa(tport),
-						Address:         definition.Address,
+						Address:         address,
 						ProtocolVersion: "HTTP/2.0",
 						SiteId:          siteId,
 					})
@@ -587,36 +621,169 @@ func GetRouterConfigForProxy(definition types.ServiceInterface, siteId string) (
 		//in all other sites, just have ingress bindings
 		switch definition.Protocol {
 		case "tcp":
-			config.AddTcpListener(TcpEndpoint{
-				Name:    "ingress",
+			bc.AddTcpListener(TcpEndpoint{
+				Name:    ingressName,
 				Host:    host,
 				Port:    strconv.Itoa(port),
-				Address: definition.Address,
+				Address: address,
 				SiteId:  siteId,
 			})
 		case "http":
-			config.AddHttpListener(HttpEndpoint{
-				Name:    "ingress",
+			bc.AddHttpListener(HttpEndpoint{
+				Name:    ingressName,
 				Host:    host,
 				Port:    strconv.Itoa(port),
-				Address: definition.Address,
+				Address: address,
 				SiteId:  siteId,
 			})
 		case "http2":
-			config.AddHttpListener(HttpEndpoint{
-				Name:            "ingress",
+			bc.AddHttpListener(HttpEndpoint{
+				Name:            ingressName,
 				Host:            host,
 				Port:            strconv.Itoa(port),
-				Address:         definition.Address,
+				Address:         address,
 				ProtocolVersion: "HTTP/2.0",
 				SiteId:          siteId,
 			})
 		default:
 		}
 	}
+}
+
+// newProxyConfig returns the config of an edge router attached to the site router
+func newProxyConfig(siteId string) RouterConfig {
+	config := InitialConfig("$HOSTNAME", siteId, true)
+	//add edge-connector
+	config.AddSslProfile(SslProfile{
+		Name: types.InterRouterProfile,
+	})
+	config.AddConnector(Connector{
+		Name:       "uplink",
+		SslProfile: types.InterRouterProfile,
+		Host:       "skupper-router",
+		Port:       strconv.Itoa(int(types.EdgeListenerPort)),
+		Role:       RoleEdge,
+	})
+	config.AddListener(Listener{
+		Name: "amqp",
+		Host: "localhost",
+		Port: 5672,
+	})
+	return config
+}
+
+func GetRouterConfigForProxy(definition types.ServiceInterface, siteId string) (string, error) {
+	config := newProxyConfig(siteId)
+	addServiceBridges(&config.Bridges, definition, siteId, "ingress", func(host string) string {
+		return "egress-" + host
+	})
+	return MarshalRouterConfig(config)
+}
+
+// GetRouterConfigForHeadlessProxy returns the config of the proxy standing
+// for one instance of a headless service, which listens on each port of the
+// service for the address of the instance
+func GetRouterConfigForHeadlessProxy(definition types.ServiceInterface, instance int, siteId string) (string, error) {
+	config := newProxyConfig(siteId)
+	ports := definition.GetPorts()
+	for _, port := range ports {
+		name := "ingress"
+		address := definition.Address
+		if len(ports) > 1 {
+			name = name + ":" + strconv.Itoa(port)
+			address = address + ":" + strconv.Itoa(port)
+		}
+		config.Bridges.AddTcpListener(TcpEndpoint{
+			Name:    name,
+			Host:    "0.0.0.0",
+			Port:    strconv.Itoa(port),
+			Address: definition.GetInstanceAddress(instance, address),
+			SiteId:  siteId,
+		})
+	}
 	return MarshalRouterConfig(config)
 }
 
+// instanceTargets returns the containers standing for the instances of a
+// headless service ordered by instance, definitions saved before targets kept
+// their instance get them assigned
+func instanceTargets(definition types.ServiceInterface) []types.ServiceInterfaceTarget {
+	numbered := definition
+	headless := *definition.Headless
+	numbered.Headless = &headless
+	numbered.Targets = append([]types.ServiceInterfaceTarget{}, definition.Targets...)
+	numbered.AssignInstances()
+
+	targets := []types.ServiceInterfaceTarget{}
+	for _, t := range numbered.Targets {
+		if t.Selector == "internal.skupper.io/container" {
+			targets = append(targets, t)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return *targets[i].Instance < *targets[j].Instance
+	})
+	return targets
+}
+
+// GetBridgeConfigForService returns the bridges for a service named after its
+// address, so that those of several services can be merged in one router
+func GetBridgeConfigForService(definition types.ServiceInterface, siteId string) BridgeConfig {
+	bc := NewBridgeConfig()
+	addServiceBridges(&bc, definition, siteId, definition.Address, func(host string) string {
+		return definition.Address + "@" + host
+	})
+	// the shared router answers for every address, so listen on all of them
+	for name, l := range bc.TcpListeners {
+		l.Host = "0.0.0.0"
+		bc.TcpListeners[name] = l
+	}
+	for name, l := range bc.HttpListeners {
+		l.Host = "0.0.0.0"
+		bc.HttpListeners[name] = l
+	}
+	return bc
+}
+
+// Merge adds all the bridges of other to the config
+func (bc *BridgeConfig) Merge(other BridgeConfig) {
+	for _, e := range other.TcpListeners {
+		bc.AddTcpListener(e)
+	}
+	for _, e := range other.TcpConnectors {
+		bc.AddTcpConnector(e)
+	}
+	for _, e := range other.HttpListeners {
+		bc.AddHttpListener(e)
+	}
+	for _, e := range other.HttpConnectors {
+		bc.AddHttpConnector(e)
+	}
+}
+
+// GetRouterConfigForBridge returns the config of an edge router that hosts the
+// given bridges, linked to the site router like a proxy
+func GetRouterConfigForBridge(bridges BridgeConfig, siteId string) RouterConfig {
+	config := InitialConfig("$HOSTNAME", siteId, true)
+	config.AddSslProfile(SslProfile{
+		Name: types.InterRouterProfile,
+	})
+	config.AddConnector(Connector{
+		Name:       "uplink",
+		SslProfile: types.InterRouterProfile,
+		Host:       "skupper-router",
+		Port:       strconv.Itoa(int(types.EdgeListenerPort)),
+		Role:       RoleEdge,
+	})
+	config.AddListener(Listener{
+		Name: "amqp",
+		Host: "localhost",
+		Port: 5672,
+	})
+	config.Bridges = bridges
+	return config
+}
+
 func (r *RouterConfig) WriteToConfigFile(configFile string) error {
 	marshalled, err := MarshalRouterConfig(*r)
 	if err != nil {